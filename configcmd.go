@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/johnsiilver/netcrawl/explorer/config"
+)
+
+const configUsage = `usage: netcrawl config [--config path] validate
+       netcrawl config [--to format] convert <file> [output]
+
+  validate  loads and merges the config files and reports every problem with them
+  convert   translates a config file between JSON, YAML and TOML, writing to output or stdout
+
+The config is ` + etcConfig + `, then ` + localConfig + `, then --config, with later files
+overriding earlier ones. Files ending in .yaml or .yml are YAML, .toml is TOML and anything
+else is JSON. The standard files may also be YAML or TOML, such as ./netcrawl.yaml.`
+
+// runConfig runs the config subcommand.
+func runConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	confPath := fs.String("config", "", "A config file, merged over "+localConfig+" and "+etcConfig)
+	to := fs.String("to", "", "The format to convert to: json, yaml or toml. Defaults to the format of output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, configUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	switch {
+	case fs.Arg(0) == "validate" && fs.NArg() == 1:
+		files, err := configFiles(*confPath)
+		if err != nil {
+			exitf(err.Error())
+		}
+		if _, err := config.Load(files...); err != nil {
+			exitf("%s", err)
+		}
+		fmt.Printf("config is valid: %s\n", strings.Join(files, ", "))
+	case fs.Arg(0) == "convert" && (fs.NArg() == 2 || fs.NArg() == 3):
+		convertConfig(fs.Arg(1), fs.Arg(2), *to)
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+}
+
+// convertConfig converts the config file at in to format, writing it to out, or stdout if
+// out is empty. If format is empty, it comes from out's extension.
+func convertConfig(in, out, format string) {
+	var f config.Format
+	switch {
+	case format != "":
+		var err error
+		if f, err = config.ParseFormat(format); err != nil {
+			exitf("--to: %s", err)
+		}
+	case out != "":
+		f = config.FormatOf(out)
+	default:
+		exitf("--to must be given when writing to stdout")
+	}
+
+	b, err := ioutil.ReadFile(in)
+	if err != nil {
+		exitf("could not read config: %s", err)
+	}
+	b, err = config.Convert(in, b, f)
+	if err != nil {
+		exitf("%s", err)
+	}
+	if out == "" {
+		os.Stdout.Write(b)
+		return
+	}
+	// Configs can have credentials in them, so only the owner can read the new file.
+	if err := ioutil.WriteFile(out, b, 0600); err != nil {
+		exitf("could not write config: %s", err)
+	}
+}
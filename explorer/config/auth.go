@@ -0,0 +1,207 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	sshCDP "github.com/johnsiilver/netcrawl/explorer/internal/cli/cdp"
+	"github.com/johnsiilver/netcrawl/explorer/internal/hostkey"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// authMethods returns the ssh.AuthMethods configured in s. Key based methods are tried first,
+// then the ssh-agent and finally password or keyboard-interactive. ag is only opened if
+// s uses the agent.
+func (s SSH) authMethods(ag *sshAgent) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if s.KeyFile != "" {
+		signer, err := s.signer()
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	} else if s.CertFile != "" {
+		return nil, fmt.Errorf("SSH config for user %s has a CertFile but no KeyFile", s.User)
+	}
+
+	if s.Agent {
+		if err := ag.open(); err != nil {
+			return nil, fmt.Errorf("SSH config for user %s: %s", s.User, err)
+		}
+		methods = append(methods, ssh.PublicKeysCallback(ag.client.Signers))
+	}
+
+	if s.Pass != "" {
+		if s.KeyboardInteractive {
+			methods = append(methods, ssh.KeyboardInteractive(keyboardInteractive(s.Pass)))
+		} else {
+			methods = append(methods, ssh.Password(s.Pass))
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("SSH config for user %s has no authentication methods configured", s.User)
+	}
+	return methods, nil
+}
+
+// signer reads our private key, and if provided, wraps it with our certificate.
+func (s SSH) signer() (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read SSH KeyFile: %s", err)
+	}
+
+	var signer ssh.Signer
+	if s.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(s.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse SSH KeyFile %s: %s", s.KeyFile, err)
+	}
+
+	if s.CertFile == "" {
+		return signer, nil
+	}
+
+	b, err = ioutil.ReadFile(s.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read SSH CertFile: %s", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse SSH CertFile %s: %s", s.CertFile, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("SSH CertFile %s is not a certificate", s.CertFile)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("SSH CertFile %s does not match KeyFile %s: %s", s.CertFile, s.KeyFile, err)
+	}
+	return certSigner, nil
+}
+
+// sshAgent is a connection to the ssh-agent listening on SSH_AUTH_SOCK. It is opened the first
+// time an SSH config needs it and shared by all of them, as agent clients are safe for
+// concurrent use.
+type sshAgent struct {
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// open connects to the ssh-agent, if that hasn't been done.
+func (a *sshAgent) open() error {
+	if a.client != nil {
+		return nil
+	}
+	sock, err := agentSocket()
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return fmt.Errorf("could not connect to ssh-agent at %s: %s", sock, err)
+	}
+	a.conn, a.client = conn, agent.NewClient(conn)
+	return nil
+}
+
+// Close implements io.Closer.
+func (a *sshAgent) Close() error {
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.Close()
+}
+
+// agentSocket returns the path of the ssh-agent's socket.
+func agentSocket() (string, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return "", fmt.Errorf("the ssh-agent is used, but SSH_AUTH_SOCK is not set")
+	}
+	return sock, nil
+}
+
+// keyboardInteractive answers any questions that don't echo (password prompts) with pass.
+func keyboardInteractive(pass string) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			if !echos[i] {
+				answers[i] = pass
+			}
+		}
+		return answers, nil
+	}
+}
+
+// Host key checking modes for HostKeys.Mode.
+const (
+	// HostKeyStrict only allows hosts whose keys are in HostKeys.KnownHosts.
+	HostKeyStrict = "strict"
+	// HostKeyTOFU trusts a host's key the first time it is seen and records it in HostKeys.TOFUFile.
+	HostKeyTOFU = "tofu"
+	// HostKeyInsecure accepts any host key. Only use this in a lab.
+	HostKeyInsecure = "insecure"
+)
+
+// HostKeys configures how SSH host keys are verified. A host that fails verification is
+// recorded in the crawl results and is not logged into.
+type HostKeys struct {
+	// Mode is HostKeyStrict, HostKeyTOFU or HostKeyInsecure. Defaults to HostKeyStrict.
+	Mode string
+	// KnownHosts are known_hosts files to verify keys against. Defaults to ~/.ssh/known_hosts
+	// in strict mode.
+	KnownHosts []string
+	// TOFUFile is the netcrawl managed known_hosts file that new keys are written to in
+	// tofu mode. Defaults to ~/.netcrawl/known_hosts.
+	TOFUFile string
+}
+
+// callback returns the host key callback for h and, like OpenSSH, the host key algorithms
+// of the keys already known for each host, so a host with several keys sends the one we know.
+func (h HostKeys) callback() (ssh.HostKeyCallback, sshCDP.HostKeyAlgorithms, error) {
+	switch h.Mode {
+	case "", HostKeyStrict:
+		files := h.KnownHosts
+		if len(files) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, fmt.Errorf("HostKeys.KnownHosts not set and can't find home directory: %s", err)
+			}
+			files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+		}
+		k, err := hostkey.NewKnownHosts(files...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return k.Callback, k.Algorithms, nil
+	case HostKeyTOFU:
+		file := h.TOFUFile
+		if file == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, fmt.Errorf("HostKeys.TOFUFile not set and can't find home directory: %s", err)
+			}
+			file = filepath.Join(home, ".netcrawl", "known_hosts")
+		}
+		t, err := hostkey.NewTOFU(file, h.KnownHosts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t.Callback, t.Algorithms, nil
+	case HostKeyInsecure:
+		return hostkey.Insecure(), nil, nil
+	}
+	return nil, nil, fmt.Errorf("HostKeys.Mode %q is not valid", h.Mode)
+}
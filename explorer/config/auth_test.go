@@ -0,0 +1,305 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newKey returns a new ed25519 private key and its ssh.Signer.
+func newKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, signer
+}
+
+// authServer returns a server config that accepts user "admin" with authorized's key, any
+// certificate signed by ca, the password "pass" or keyboard-interactive with "pass". The
+// method used is put in the Permissions as "method".
+func authServer(t *testing.T, authorized ssh.PublicKey, ca ssh.PublicKey) *ssh.ServerConfig {
+	method := func(m string) *ssh.Permissions {
+		return &ssh.Permissions{Extensions: map[string]string{"method": m}}
+	}
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(k ssh.PublicKey) bool { return bytes.Equal(k.Marshal(), ca.Marshal()) },
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if _, ok := key.(*ssh.Certificate); ok {
+				if _, err := checker.Authenticate(c, key); err != nil {
+					return nil, err
+				}
+				return method("certificate"), nil
+			}
+			if !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, fmt.Errorf("key not authorized")
+			}
+			return method("publickey"), nil
+		},
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return method("password"), nil
+		},
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("admin", "", []string{"Username: ", "Password: "}, []bool{true, false})
+			if err != nil {
+				return nil, err
+			}
+			if answers[1] != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return method("keyboard-interactive"), nil
+		},
+	}
+	_, hostKey := newKey(t)
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// login logs into an in-process server as "admin" with methods and returns the method the
+// server accepted.
+func login(methods []ssh.AuthMethod, server *ssh.ServerConfig) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			ch <- ""
+			return
+		}
+		defer conn.Close()
+		sc, chans, reqs, err := ssh.NewServerConn(conn, server)
+		if err != nil {
+			ch <- ""
+			return
+		}
+		defer sc.Close()
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			for c := range chans {
+				c.Reject(ssh.Prohibited, "no channels")
+			}
+		}()
+		ch <- sc.Permissions.Extensions["method"]
+	}()
+
+	client, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            methods,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	method := <-ch
+	if err != nil {
+		return "", err
+	}
+	client.Close()
+	return method, nil
+}
+
+// serveAgent serves keyring as an ssh-agent on a socket in dir and returns its path.
+func serveAgent(t *testing.T, dir string, keyring agent.Agent) string {
+	t.Helper()
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return sock
+}
+
+func TestAuthMethods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, b []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// key is authorized on the server.
+	key, keySigner := newKey(t)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := write("key", pem.EncodeToMemory(block))
+	block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encFile := write("key.enc", pem.EncodeToMemory(block))
+
+	// certKey isn't authorized, only its certificate is.
+	certKey, certKeySigner := newKey(t)
+	block, err = ssh.MarshalPrivateKey(certKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certKeyFile := write("certkey", pem.EncodeToMemory(block))
+	_, ca := newKey(t)
+	cert := &ssh.Certificate{
+		Key:             certKeySigner.PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           "admin",
+		ValidPrincipals: []string{"admin"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	certFile := write("certkey-cert.pub", ssh.MarshalAuthorizedKey(cert))
+	pubFile := write("certkey.pub", ssh.MarshalAuthorizedKey(certKeySigner.PublicKey()))
+
+	// The agent holds the authorized key.
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	sock := serveAgent(t, dir, keyring)
+
+	server := authServer(t, keySigner.PublicKey(), ca.PublicKey())
+
+	tests := []struct {
+		desc string
+		ssh  SSH
+		// noAgent unsets SSH_AUTH_SOCK.
+		noAgent bool
+		// want is the method the server accepts, "" if login fails.
+		want    string
+		wantErr bool
+	}{
+		{desc: "Key", ssh: SSH{KeyFile: keyFile}, want: "publickey"},
+		{desc: "Encrypted key", ssh: SSH{KeyFile: encFile, KeyPassphrase: "secret"}, want: "publickey"},
+		{desc: "Encrypted key with wrong passphrase", ssh: SSH{KeyFile: encFile, KeyPassphrase: "wrong"}, wantErr: true},
+		{desc: "Encrypted key without passphrase", ssh: SSH{KeyFile: encFile}, wantErr: true},
+		{desc: "Missing key", ssh: SSH{KeyFile: filepath.Join(dir, "none")}, wantErr: true},
+		{desc: "Unauthorized key", ssh: SSH{KeyFile: certKeyFile}},
+		{desc: "Certificate", ssh: SSH{KeyFile: certKeyFile, CertFile: certFile}, want: "certificate"},
+		{desc: "Certificate for another key", ssh: SSH{KeyFile: keyFile, CertFile: certFile}, wantErr: true},
+		{desc: "CertFile is not a certificate", ssh: SSH{KeyFile: certKeyFile, CertFile: pubFile}, wantErr: true},
+		{desc: "CertFile without KeyFile", ssh: SSH{CertFile: certFile}, wantErr: true},
+		{desc: "Agent", ssh: SSH{Agent: true}, want: "publickey"},
+		{desc: "Agent without SSH_AUTH_SOCK", ssh: SSH{Agent: true}, noAgent: true, wantErr: true},
+		{desc: "Password", ssh: SSH{Pass: "pass"}, want: "password"},
+		{desc: "Wrong password", ssh: SSH{Pass: "wrong"}},
+		{desc: "Keyboard-interactive", ssh: SSH{Pass: "pass", KeyboardInteractive: true}, want: "keyboard-interactive"},
+		{desc: "Keyboard-interactive with wrong password", ssh: SSH{Pass: "wrong", KeyboardInteractive: true}},
+		{desc: "Key is tried before password", ssh: SSH{KeyFile: keyFile, Pass: "pass"}, want: "publickey"},
+		{desc: "No methods", ssh: SSH{}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		if test.noAgent {
+			t.Setenv("SSH_AUTH_SOCK", "")
+		} else {
+			t.Setenv("SSH_AUTH_SOCK", sock)
+		}
+
+		test.ssh.User = "admin"
+		ag := &sshAgent{}
+		methods, err := test.ssh.authMethods(ag)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestAuthMethods(%s): got err == nil, want err != nil", test.desc)
+			ag.Close()
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestAuthMethods(%s): got err == %s, want err == nil", test.desc, err)
+			ag.Close()
+			continue
+		case err != nil:
+			ag.Close()
+			continue
+		}
+
+		got, err := login(methods, server)
+		ag.Close()
+		switch {
+		case err != nil && test.want != "":
+			t.Errorf("TestAuthMethods(%s): login had error: %s", test.desc, err)
+		case err == nil && test.want == "":
+			t.Errorf("TestAuthMethods(%s): login succeeded with %s, want it to fail", test.desc, got)
+		case got != test.want:
+			t.Errorf("TestAuthMethods(%s): got login with %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestSSHAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := newKey(t)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", serveAgent(t, dir, keyring))
+
+	// Configs share one connection to the agent.
+	ag := &sshAgent{}
+	if _, err := (SSH{User: "admin", Agent: true}).authMethods(ag); err != nil {
+		t.Fatalf("TestSSHAgent: authMethods() had error: %s", err)
+	}
+	conn := ag.conn
+	if _, err := (SSH{User: "ops", Agent: true}).authMethods(ag); err != nil || ag.conn != conn {
+		t.Errorf("TestSSHAgent: authMethods() opened another connection to the agent")
+	}
+	if _, err := ag.client.List(); err != nil {
+		t.Fatalf("TestSSHAgent: List() had error: %s", err)
+	}
+
+	if err := ag.Close(); err != nil {
+		t.Errorf("TestSSHAgent: Close() had error: %s", err)
+	}
+	if _, err := ag.client.List(); err == nil {
+		t.Errorf("TestSSHAgent: agent connection was not closed by Close()")
+	}
+}
@@ -3,11 +3,16 @@ package config
 import (
 	"context"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
+	"github.com/gosnmp/gosnmp"
 	sshCDP "github.com/johnsiilver/netcrawl/explorer/internal/cli/cdp"
+	"github.com/johnsiilver/netcrawl/explorer/internal/snmp"
 	"github.com/johnsiilver/netcrawl/network"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/time/rate"
 )
 
 type Discover interface {
@@ -19,68 +24,515 @@ type Config struct {
 	// SSHConn provides a list of possible ssh configurations that would
 	// allow connection to the device.
 	SSHConn []SSH
-	// SNMPConn []SNMP
+	// SNMPConn provides a list of possible SNMP configurations that would
+	// allow querying the device. SNMP is tried before SSH.
+	SNMPConn []SNMP
+	// HostKeys is the policy for verifying SSH host keys.
+	HostKeys HostKeys
+	// Limits bounds how hard the crawl hits the network.
+	Limits Limits
+	// Timeouts bounds how long parts of the crawl may take.
+	Timeouts Timeouts
+	// Scope limits what parts of the network are explored.
+	Scope Scope
+	// PreferFamily is the address family used to connect to a device that advertises both
+	// IPv4 and IPv6 addresses, FamilyIPv4 (the default) or FamilyIPv6.
+	PreferFamily string
+	// Proxies are the SOCKS5 or HTTP CONNECT proxies to reach devices in some networks through.
+	// The first Proxy with a matching prefix is used.
+	Proxies []Proxy
+	// Sites name groups of prefixes, so that SSH configs can be limited to them.
+	Sites []Site
+	// Secrets configures how secret references in credential fields are resolved.
+	Secrets Secrets
+	// Sweep finds devices to crawl from by probing management prefixes.
+	Sweep Sweep
+}
+
+// Site is a named group of prefixes, such as a data center or campus.
+type Site struct {
+	Name string
+	// Prefixes are the CIDR prefixes that are part of the site.
+	Prefixes []string
+}
+
+// Address families for Config.PreferFamily.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// PreferIPv6 returns true if PreferFamily is FamilyIPv6 and an error if it isn't valid.
+func (c Config) PreferIPv6() (bool, error) {
+	switch strings.ToLower(c.PreferFamily) {
+	case "", FamilyIPv4:
+		return false, nil
+	case FamilyIPv6:
+		return true, nil
+	}
+	return false, fmt.Errorf("PreferFamily must be %q or %q, was %q", FamilyIPv4, FamilyIPv6, c.PreferFamily)
+}
+
+// Scope limits what parts of the network are explored. Nodes outside the scope are not
+// logged into, but still appear in the network map marked as out of scope.
+type Scope struct {
+	// Include are CIDR prefixes that a node must be in to be explored. If empty, all
+	// addresses are included. A node is in a prefix if any address it advertises is.
+	Include []string
+	// Exclude are CIDR prefixes that are never explored. Exclude wins over Include.
+	Exclude []string
+	// MaxDepth is the maximum number of hops from the root node to explore, along the
+	// shortest path found to a node. 0 means unlimited.
+	MaxDepth int
+	// SkipPlatforms are regular expressions matched against the platform a neighbor advertises
+	// (network.Node.Type), such as "(?i)phone" or "AIR-". Matching nodes are not explored.
+	SkipPlatforms []string
+}
+
+// Timeouts bounds how long parts of a crawl may take.
+type Timeouts struct {
+	// Dial is the maximum time to connect to a device and complete the SSH handshake, or
+	// for an SNMP agent to answer a request. Defaults to 5 seconds.
+	Dial Duration
+	// Command is the maximum time a single command may run on a device. 0 means no limit.
+	Command Duration
+	// Crawl is the maximum time the whole crawl may take. When it is reached, the part of the
+	// network explored so far is returned. 0 means no limit.
+	Crawl Duration
+}
+
+// defaultDialTimeout is the default of Timeouts.Dial.
+const defaultDialTimeout = 5 * time.Second
+
+// dial returns the Dial timeout, with the default if it isn't set.
+func (t Timeouts) dial() time.Duration {
+	if t.Dial > 0 {
+		return time.Duration(t.Dial)
+	}
+	return defaultDialTimeout
+}
+
+// Limits bounds the concurrency and login rate of a crawl, so that we don't trip AAA
+// lockouts or CPU alarms on the devices.
+type Limits struct {
+	// Workers is the maximum number of nodes being discovered at the same time. Defaults to 32.
+	Workers int
+	// LoginsPerSecond is the maximum rate of login attempts, across the whole crawl. Every
+	// SSH, telnet or SNMP config tried on a device is an attempt. 0 means unlimited.
+	LoginsPerSecond float64
+	// SubnetConcurrency is the maximum number of nodes in the same subnet being discovered
+	// at the same time. 0 means unlimited.
+	SubnetConcurrency int
+	// SubnetBits is the IPv4 prefix length that defines a subnet for SubnetConcurrency and
+	// for trying the SSH config that last worked in a subnet first. Defaults to 24.
+	SubnetBits int
+	// SubnetBitsV6 is the same as SubnetBits for IPv6. Defaults to 64.
+	SubnetBitsV6 int
+}
+
+// WorkerLimit returns Workers, or its default.
+func (l Limits) WorkerLimit() int {
+	if l.Workers > 0 {
+		return l.Workers
+	}
+	return 32
+}
+
+// SubnetPrefixLen returns SubnetBits and SubnetBitsV6, or their defaults.
+func (l Limits) SubnetPrefixLen() (v4, v6 int) {
+	v4, v6 = 24, 64
+	if l.SubnetBits > 0 {
+		v4 = l.SubnetBits
+	}
+	if l.SubnetBitsV6 > 0 {
+		v6 = l.SubnetBitsV6
+	}
+	return v4, v6
 }
 
 func (c Config) Discoveries() ([]Discover, error) {
 	var discNodes []Discover
 
-	discs, err := c.sshDiscovery()
+	// The discoveries share the login limit.
+	logins := rate.NewLimiter(rate.Inf, 1)
+	if c.Limits.LoginsPerSecond > 0 {
+		logins = rate.NewLimiter(rate.Limit(c.Limits.LoginsPerSecond), 1)
+	}
+
+	discs, err := c.snmpDiscovery(logins)
 	if err != nil {
 		return nil, err
 	}
+	discNodes = append(discNodes, discs...)
 
+	discs, err = c.sshDiscovery(logins)
+	if err != nil {
+		return nil, err
+	}
 	discNodes = append(discNodes, discs...)
 
 	return discNodes, nil
 }
 
-func (c Config) sshDiscovery() ([]Discover, error) {
+func (c Config) sshDiscovery(logins *rate.Limiter) ([]Discover, error) {
 	var discNodes []Discover
-	var sshConfigs []*ssh.ClientConfig
-
-	for _, sshConf := range c.SSHConn {
-		config := &ssh.ClientConfig{
-			User: sshConf.User,
-			Auth: []ssh.AuthMethod{
-				ssh.Password(sshConf.Pass),
-			},
-			Timeout: 5 * time.Second,
+	if len(c.SSHConn) == 0 {
+		return nil, nil
+	}
+
+	hostKeyCallback, hostKeyAlgos, err := c.HostKeys.callback()
+	if err != nil {
+		return nil, err
+	}
+
+	dialTimeout := c.Timeouts.dial()
+	cmdTimeout := sshCDP.WithCommandTimeout(time.Duration(c.Timeouts.Command))
+
+	proxies, err := c.proxies()
+	if err != nil {
+		return nil, err
+	}
+	sites, err := c.sites()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every config that uses the ssh-agent shares one connection to it, which the
+	// Discover closes.
+	ag := &sshAgent{}
+	defer func() {
+		if len(discNodes) == 0 {
+			ag.Close()
 		}
-		sshConfigs = append(sshConfigs, config)
+	}()
+
+	jumps := newBastionCache(ag)
+	base := ssh.ClientConfig{HostKeyCallback: hostKeyCallback, Timeout: dialTimeout}
+	sshConns, err := c.sshConns(base, hostKeyAlgos, sites, jumps)
+	if err != nil {
+		return nil, err
 	}
+	withBastions := sshCDP.WithBastions(jumps.all...)
+	withLastGood := sshCDP.WithLastGood(sshCDP.NewLastGood(c.Limits.SubnetPrefixLen()))
 
-	if len(sshConfigs) > 0 {
-		disc, err := sshCDP.New(sshConfigs)
+	if len(sshConns) > 0 {
+		conns := func(node *network.Node) []sshCDP.Conn {
+			ip := node.IP
+			out := make([]sshCDP.Conn, 0, len(sshConns))
+			proxyDialer := proxies.forIP(ip)
+			add := func(conn sshCDP.Conn) {
+				// Jump hosts do the dialing for us.
+				if conn.Bastion == nil && proxyDialer != nil {
+					conn.Dialer = proxyDialer
+				}
+				out = append(out, conn)
+			}
+
+			for _, c := range sshConns {
+				if c.scope.applies(node) {
+					add(c.forIP(ip))
+				}
+			}
+			// Telnet is only tried after every SSH config has failed.
+			for _, c := range sshConns {
+				if !c.scope.applies(node) {
+					continue
+				}
+				if conn, ok := c.telnetForIP(ip); ok {
+					add(conn)
+				}
+			}
+			return out
+		}
+
+		// One login runs both the CDP and LLDP commands.
+		disc, err := sshCDP.New(
+			conns,
+			cmdTimeout,
+			withBastions,
+			withLastGood,
+			sshCDP.WithClosers(ag),
+			sshCDP.WithLoginLimiter(logins),
+		)
 		if err != nil {
-			return nil, fmt.Errorf("problems setting up SSH CDP discovery: %s", err)
+			return nil, fmt.Errorf("problems setting up SSH CDP/LLDP discovery: %s", err)
 		}
 		discNodes = append(discNodes, disc)
 	}
 	return discNodes, nil
 }
 
-// SSH provides an SSH configuration for connecting to a device.
+// sshConns returns the connection parameters of each of c.SSHConn. base has the host key
+// policy and timeout, jump hosts come from jumps.
+func (c Config) sshConns(base ssh.ClientConfig, algos sshCDP.HostKeyAlgorithms, sites map[string][]*net.IPNet, jumps *bastionCache) ([]sshConn, error) {
+	var conns []sshConn
+	for i, sshConf := range c.SSHConn {
+		auth, err := sshConf.authMethods(jumps.ag)
+		if err != nil {
+			return nil, err
+		}
+		config := base
+		config.User = sshConf.User
+		config.Auth = auth
+		conn, err := sshConf.conn(&config, algos, jumps)
+		if err != nil {
+			return nil, fmt.Errorf("SSHConn[%d]: %s", i, err)
+		}
+		conn.scope, err = sshConf.scope(sites)
+		if err != nil {
+			return nil, fmt.Errorf("SSHConn[%d]: %s", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// SSH provides an SSH configuration for connecting to a device. Each authentication method
+// that is configured will be tried: keys first, then the agent and finally the password.
 type SSH struct {
 	User string
+	// Pass is the password. It is used for password authentication, or keyboard-interactive
+	// if KeyboardInteractive is set.
 	Pass string
+
+	// KeyFile is the path to a PEM encoded private key to authenticate with.
+	KeyFile string
+	// KeyPassphrase decrypts KeyFile if it is encrypted.
+	KeyPassphrase string
+	// CertFile is the path to an OpenSSH user certificate signed for KeyFile
+	// (normally KeyFile + "-cert.pub").
+	CertFile string
+	// Agent authenticates with the keys held by the ssh-agent at SSH_AUTH_SOCK.
+	Agent bool
+	// ForwardAgent forwards the ssh-agent at SSH_AUTH_SOCK to the device, like ssh -A. Only
+	// set it for devices you trust, as root on the device can use the agent's keys.
+	ForwardAgent bool
+	// KeyboardInteractive answers keyboard-interactive password prompts with Pass instead
+	// of using password authentication.
+	KeyboardInteractive bool
+
+	// Port is the SSH port. Defaults to 22.
+	Port int
+	// Ciphers, KeyExchanges and MACs are the algorithms to offer, in order of preference.
+	// If empty, the defaults of golang.org/x/crypto/ssh are used. Legacy devices may need
+	// algorithms that aren't offered by default, such as a KeyExchanges of
+	// ["diffie-hellman-group1-sha1"] and Ciphers of ["aes128-cbc"] for old IOS.
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+
+	// ProxyJump are jump hosts, in order, that connections to devices are tunneled through.
+	// Configs and Overrides with the same jump hosts and credentials share one connection.
+	ProxyJump []JumpHost
+
+	// Session is how commands are run on devices: SessionExec (the default), SessionShell
+	// or SessionAuto. See the constants for details.
+	Session string
+	// EnableSecret is the secret for the "enable" command. It is only used by shell sessions.
+	EnableSecret string
+
+	// Prefixes, Platforms and Sites limit which devices the config is tried on, so that
+	// logins aren't wasted on devices that won't accept them. A device must be in one of the
+	// Prefixes or Sites and have a platform (network.Node.Type) matching one of the Platforms
+	// regular expressions. Empty means any. The root node's platform isn't known, so it
+	// matches any Platforms.
+	Prefixes  []string
+	Platforms []string
+	Sites     []string
+
+	// Overrides change the connection parameters for devices in particular networks.
+	// The first Override with a matching prefix is used.
+	Overrides []SSHOverride
+}
+
+// JumpHost is an SSH jump host, like a ProxyJump hop in OpenSSH. A crawl logs into each
+// jump host once and tunnels all of its device connections through that. Jump hosts are
+// verified with the same HostKeys policy as devices.
+type JumpHost struct {
+	// Addr is the host or host:port of the jump host. The port defaults to 22.
+	Addr string
+
+	// These are the same as in SSH.
+	User                string
+	Pass                string
+	KeyFile             string
+	KeyPassphrase       string
+	CertFile            string
+	Agent               bool
+	KeyboardInteractive bool
+}
+
+// SSHOverride changes the connection parameters of an SSH config for devices in Prefixes.
+// Fields that are not set keep the value from the SSH config.
+type SSHOverride struct {
+	// Prefixes are the CIDR prefixes the override applies to.
+	Prefixes []string
+
+	Port         int
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+	ProxyJump    []JumpHost
+	Session      string
+
+	// Telnet allows falling back to telnet, with the SSH config's User, Pass and EnableSecret,
+	// when no SSH config can login to a device. Telnet sends passwords in the clear, so it
+	// is only for legacy devices that have nothing else.
+	Telnet bool
+	// TelnetPort is the telnet port. Defaults to 23.
+	TelnetPort int
+}
+
+// Session modes for SSH.Session.
+const (
+	// SessionExec runs each command with an SSH exec request.
+	SessionExec = "exec"
+	// SessionShell types commands into an interactive shell, for devices that reject exec
+	// requests or run them without privileges, like older IOS and ASA. The shell enters
+	// enable mode with EnableSecret and turns off paging.
+	SessionShell = "shell"
+	// SessionAuto uses exec requests, falling back to a shell if the device gives no output.
+	SessionAuto = "auto"
+)
+
+var sessionModes = map[string]sshCDP.SessionMode{
+	"":           sshCDP.SessionExec,
+	SessionExec:  sshCDP.SessionExec,
+	SessionShell: sshCDP.SessionShell,
+	SessionAuto:  sshCDP.SessionAuto,
+}
+
+// sessionMode converts s to a SessionMode.
+func sessionMode(s string) (sshCDP.SessionMode, error) {
+	m, ok := sessionModes[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("Session must be %q, %q or %q, was %q", SessionExec, SessionShell, SessionAuto, s)
+	}
+	return m, nil
 }
 
-/*
+func (c Config) snmpDiscovery(logins *rate.Limiter) ([]Discover, error) {
+	var discNodes []Discover
+	var snmpConfigs []*gosnmp.GoSNMP
 
-type SNMP interface{
-	isSNMP()
+	for _, snmpConf := range c.SNMPConn {
+		config, err := snmpConf.goSNMP()
+		if err != nil {
+			return nil, err
+		}
+		config.Timeout = c.Timeouts.dial()
+		snmpConfigs = append(snmpConfigs, config)
+	}
+
+	if len(snmpConfigs) > 0 {
+		disc, err := snmp.New(snmpConfigs, snmp.WithLoginLimiter(logins))
+		if err != nil {
+			return nil, fmt.Errorf("problems setting up SNMP discovery: %s", err)
+		}
+		discNodes = append(discNodes, disc)
+	}
+	return discNodes, nil
 }
 
-type SNMPv2 struct {
+// SNMP provides an SNMP configuration for querying a device.
+type SNMP struct {
+	// Version is the SNMP version, either "2c" or "3". Defaults to "2c".
+	Version string
+	// Port is the agent's UDP port. Defaults to 161.
+	Port uint16
+	// Community is the v2c community string.
 	Community string
-	Port int
+
+	// User is the v3 USM user name.
+	User string
+	// AuthProto is the v3 authentication protocol: MD5, SHA, SHA224, SHA256, SHA384 or SHA512.
+	// If empty, no authentication is used.
+	AuthProto string
+	// AuthPass is the v3 authentication passphrase.
+	AuthPass string
+	// PrivProto is the v3 privacy protocol: DES, AES, AES192, AES256, AES192C or AES256C.
+	// If empty, no privacy is used.
+	PrivProto string
+	// PrivPass is the v3 privacy passphrase.
+	PrivPass string
 }
 
-func (SNMPv2) isSNMP(){}
+var snmpAuthProtos = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
 
-type SNMPv3 struct {
+var snmpPrivProtos = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
 
+// goSNMP converts our config into a gosnmp template.
+func (s SNMP) goSNMP() (*gosnmp.GoSNMP, error) {
+	g := &gosnmp.GoSNMP{
+		Port:           s.Port,
+		Transport:      "udp",
+		Timeout:        defaultDialTimeout,
+		Retries:        1,
+		MaxOids:        gosnmp.MaxOids,
+		MaxRepetitions: 25,
+	}
+	if g.Port == 0 {
+		g.Port = 161
+	}
+
+	switch s.Version {
+	case "", "2c":
+		if s.Community == "" {
+			return nil, fmt.Errorf("SNMP v2c config must have a Community")
+		}
+		g.Version = gosnmp.Version2c
+		g.Community = s.Community
+	case "3":
+		if s.User == "" {
+			return nil, fmt.Errorf("SNMP v3 config must have a User")
+		}
+		usm := &gosnmp.UsmSecurityParameters{
+			UserName:               s.User,
+			AuthenticationProtocol: gosnmp.NoAuth,
+			PrivacyProtocol:        gosnmp.NoPriv,
+		}
+		g.Version = gosnmp.Version3
+		g.SecurityModel = gosnmp.UserSecurityModel
+		g.MsgFlags = gosnmp.NoAuthNoPriv
+
+		if s.AuthProto != "" {
+			p, ok := snmpAuthProtos[strings.ToUpper(s.AuthProto)]
+			if !ok {
+				return nil, fmt.Errorf("SNMP v3 config had unknown AuthProto %q", s.AuthProto)
+			}
+			usm.AuthenticationProtocol = p
+			usm.AuthenticationPassphrase = s.AuthPass
+			g.MsgFlags = gosnmp.AuthNoPriv
+		}
+		if s.PrivProto != "" {
+			if s.AuthProto == "" {
+				return nil, fmt.Errorf("SNMP v3 config cannot have a PrivProto without an AuthProto")
+			}
+			p, ok := snmpPrivProtos[strings.ToUpper(s.PrivProto)]
+			if !ok {
+				return nil, fmt.Errorf("SNMP v3 config had unknown PrivProto %q", s.PrivProto)
+			}
+			usm.PrivacyProtocol = p
+			usm.PrivacyPassphrase = s.PrivPass
+			g.MsgFlags = gosnmp.AuthPriv
+		}
+		g.SecurityParameters = usm
+	default:
+		return nil, fmt.Errorf("SNMP config had unsupported Version %q", s.Version)
+	}
+	return g, nil
 }
-func (SNMPv3) isSNMP(){}
-*/
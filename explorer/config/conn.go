@@ -0,0 +1,260 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	sshCDP "github.com/johnsiilver/netcrawl/explorer/internal/cli/cdp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshConn is an SSH config's connection parameters, with any per-prefix overrides.
+type sshConn struct {
+	base      sshCDP.Conn
+	overrides []sshConnOverride
+	// scope is the devices the SSH config may be tried on.
+	scope sshScope
+}
+
+type sshConnOverride struct {
+	nets []*net.IPNet
+	conn sshCDP.Conn
+	// telnet is set if telnet may be used after SSH fails.
+	telnet *sshCDP.Conn
+}
+
+// override returns the override for ip, or nil if there isn't one.
+func (c sshConn) override(ip net.IP) *sshConnOverride {
+	for i, o := range c.overrides {
+		for _, n := range o.nets {
+			if n.Contains(ip) {
+				return &c.overrides[i]
+			}
+		}
+	}
+	return nil
+}
+
+// forIP returns the connection parameters to use for a device at ip.
+func (c sshConn) forIP(ip net.IP) sshCDP.Conn {
+	if o := c.override(ip); o != nil {
+		return o.conn
+	}
+	return c.base
+}
+
+// telnetForIP returns the telnet connection parameters for a device at ip, or false if
+// telnet isn't allowed for it.
+func (c sshConn) telnetForIP(ip net.IP) (sshCDP.Conn, bool) {
+	if o := c.override(ip); o != nil && o.telnet != nil {
+		return *o.telnet, true
+	}
+	return sshCDP.Conn{}, false
+}
+
+// conn returns the connection parameters of s, with config as the base ssh.ClientConfig.
+// algos restricts the host key algorithms of devices and jump hosts. Jump hosts come from
+// jumps, so configs with the same ProxyJump share a Bastion.
+func (s SSH) conn(config *ssh.ClientConfig, algos sshCDP.HostKeyAlgorithms, jumps *bastionCache) (sshConn, error) {
+	if err := checkPort(s.Port); err != nil {
+		return sshConn{}, err
+	}
+	config.Ciphers = s.Ciphers
+	config.KeyExchanges = s.KeyExchanges
+	config.MACs = s.MACs
+
+	mode, err := sessionMode(s.Session)
+	if err != nil {
+		return sshConn{}, err
+	}
+	bastion, err := jumps.get(s.ProxyJump, config, algos)
+	if err != nil {
+		return sshConn{}, err
+	}
+	base := sshCDP.Conn{
+		Config:            config,
+		Port:              s.Port,
+		Bastion:           bastion,
+		Session:           mode,
+		EnableSecret:      s.EnableSecret,
+		HostKeyAlgorithms: algos,
+	}
+	if s.ForwardAgent {
+		base.AgentSocket, err = agentSocket()
+		if err != nil {
+			return sshConn{}, fmt.Errorf("ForwardAgent: %s", err)
+		}
+	}
+	c := sshConn{base: base}
+
+	for i, o := range s.Overrides {
+		if len(o.Prefixes) == 0 {
+			return sshConn{}, fmt.Errorf("Overrides[%d] has no Prefixes", i)
+		}
+		var nets []*net.IPNet
+		for _, p := range o.Prefixes {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				return sshConn{}, fmt.Errorf("Overrides[%d] has bad prefix %q: %s", i, p, err)
+			}
+			nets = append(nets, n)
+		}
+		if err := checkPort(o.Port); err != nil {
+			return sshConn{}, fmt.Errorf("Overrides[%d]: %s", i, err)
+		}
+
+		oConfig := *config
+		if len(o.Ciphers) > 0 {
+			oConfig.Ciphers = o.Ciphers
+		}
+		if len(o.KeyExchanges) > 0 {
+			oConfig.KeyExchanges = o.KeyExchanges
+		}
+		if len(o.MACs) > 0 {
+			oConfig.MACs = o.MACs
+		}
+		oConn := base
+		oConn.Config = &oConfig
+		if o.Port != 0 {
+			oConn.Port = o.Port
+		}
+		if len(o.ProxyJump) > 0 {
+			oConn.Bastion, err = jumps.get(o.ProxyJump, config, algos)
+			if err != nil {
+				return sshConn{}, fmt.Errorf("Overrides[%d]: %s", i, err)
+			}
+		}
+		if o.Session != "" {
+			oConn.Session, err = sessionMode(o.Session)
+			if err != nil {
+				return sshConn{}, fmt.Errorf("Overrides[%d]: %s", i, err)
+			}
+		}
+		so := sshConnOverride{nets: nets, conn: oConn}
+		if o.Telnet {
+			if err := checkPort(o.TelnetPort); err != nil {
+				return sshConn{}, fmt.Errorf("Overrides[%d] TelnetPort: %s", i, err)
+			}
+			so.telnet = &sshCDP.Conn{
+				Config:       oConn.Config,
+				Port:         o.TelnetPort,
+				Bastion:      oConn.Bastion,
+				Session:      sshCDP.SessionShell,
+				EnableSecret: s.EnableSecret,
+				Transport:    sshCDP.TransportTelnet,
+				Password:     s.Pass,
+			}
+		}
+		c.overrides = append(c.overrides, so)
+	}
+	return c, nil
+}
+
+// bastionCache shares one Bastion between the SSH configs and overrides that jump through
+// the same hosts with the same credentials, so a crawl only logs into them once.
+type bastionCache struct {
+	// ag is used by jump hosts that authenticate with the ssh-agent.
+	ag *sshAgent
+	// bastions are keyed by bastionKey().
+	bastions map[string]*sshCDP.Bastion
+	// all is the bastions in the order they were made.
+	all []*sshCDP.Bastion
+}
+
+func newBastionCache(ag *sshAgent) *bastionCache {
+	return &bastionCache{ag: ag, bastions: map[string]*sshCDP.Bastion{}}
+}
+
+// get returns the Bastion for hops, or nil if there are none. A new Bastion gets its host key
+// policy and timeout from device and algos, which must be the same for every call.
+func (b *bastionCache) get(hops []JumpHost, device *ssh.ClientConfig, algos sshCDP.HostKeyAlgorithms) (*sshCDP.Bastion, error) {
+	if len(hops) == 0 {
+		return nil, nil
+	}
+	key := bastionKey(hops)
+	if bastion, ok := b.bastions[key]; ok {
+		return bastion, nil
+	}
+	bastion, err := newBastion(hops, device, algos, b.ag)
+	if err != nil {
+		return nil, err
+	}
+	b.bastions[key] = bastion
+	b.all = append(b.all, bastion)
+	return bastion, nil
+}
+
+// bastionKey returns a key that is the same for hop lists with the same addresses and
+// authentication.
+func bastionKey(hops []JumpHost) string {
+	norm := make([]JumpHost, 0, len(hops))
+	for _, h := range hops {
+		h.Addr = jumpAddr(h.Addr)
+		norm = append(norm, h)
+	}
+	return fmt.Sprintf("%#v", norm)
+}
+
+// jumpAddr returns addr with the default port of 22 if it doesn't have one.
+func jumpAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), "22")
+	}
+	return addr
+}
+
+// newBastion returns a Bastion for hops, or nil if there are none. The host key policy and
+// timeout come from device and algos.
+func newBastion(hops []JumpHost, device *ssh.ClientConfig, algos sshCDP.HostKeyAlgorithms, ag *sshAgent) (*sshCDP.Bastion, error) {
+	if len(hops) == 0 {
+		return nil, nil
+	}
+
+	var jumps []sshCDP.Jump
+	for i, h := range hops {
+		if h.Addr == "" {
+			return nil, fmt.Errorf("ProxyJump[%d] has no Addr", i)
+		}
+		addr := jumpAddr(h.Addr)
+
+		auth, err := h.ssh().authMethods(ag)
+		if err != nil {
+			return nil, fmt.Errorf("ProxyJump[%d]: %s", i, err)
+		}
+		jumps = append(
+			jumps,
+			sshCDP.Jump{
+				Addr: addr,
+				Config: &ssh.ClientConfig{
+					User:            h.User,
+					Auth:            auth,
+					HostKeyCallback: device.HostKeyCallback,
+					Timeout:         device.Timeout,
+				},
+				HostKeyAlgorithms: algos,
+			},
+		)
+	}
+	return sshCDP.NewBastion(jumps...)
+}
+
+// ssh returns the SSH config that has h's authentication settings.
+func (h JumpHost) ssh() SSH {
+	return SSH{
+		User:                h.User,
+		Pass:                h.Pass,
+		KeyFile:             h.KeyFile,
+		KeyPassphrase:       h.KeyPassphrase,
+		CertFile:            h.CertFile,
+		Agent:               h.Agent,
+		KeyboardInteractive: h.KeyboardInteractive,
+	}
+}
+
+func checkPort(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("Port %d is not a valid port", port)
+	}
+	return nil
+}
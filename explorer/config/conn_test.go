@@ -0,0 +1,131 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	sshCDP "github.com/johnsiilver/netcrawl/explorer/internal/cli/cdp"
+	"github.com/kylelemons/godebug/pretty"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHConn(t *testing.T) {
+	s := SSH{
+		User:         "user",
+		Pass:         "pass",
+		Port:         2222,
+		KeyExchanges: []string{"curve25519-sha256"},
+		Session:      SessionAuto,
+		Overrides: []SSHOverride{
+			{
+				Prefixes:     []string{"10.1.0.0/16"},
+				KeyExchanges: []string{"diffie-hellman-group1-sha1"},
+				Ciphers:      []string{"aes128-cbc"},
+				Session:      SessionShell,
+				Telnet:       true,
+			},
+			{
+				Prefixes: []string{"10.0.0.0/8", "2001:db8::/32"},
+				Port:     22,
+			},
+		},
+	}
+
+	c, err := s.conn(&ssh.ClientConfig{User: s.User}, nil, newBastionCache(&sshAgent{}))
+	if err != nil {
+		t.Fatalf("TestSSHConn: conn() had error: %s", err)
+	}
+
+	type params struct {
+		Port         int
+		Ciphers      []string
+		KeyExchanges []string
+		Session      sshCDP.SessionMode
+	}
+	tests := []struct {
+		ip   string
+		want params
+	}{
+		{ip: "192.168.0.1", want: params{Port: 2222, KeyExchanges: []string{"curve25519-sha256"}, Session: sshCDP.SessionAuto}},
+		{ip: "10.1.2.3", want: params{Port: 2222, Ciphers: []string{"aes128-cbc"}, KeyExchanges: []string{"diffie-hellman-group1-sha1"}, Session: sshCDP.SessionShell}},
+		{ip: "10.2.2.3", want: params{Port: 22, KeyExchanges: []string{"curve25519-sha256"}, Session: sshCDP.SessionAuto}},
+		{ip: "2001:db8::1", want: params{Port: 22, KeyExchanges: []string{"curve25519-sha256"}, Session: sshCDP.SessionAuto}},
+	}
+
+	for _, test := range tests {
+		conn := c.forIP(net.ParseIP(test.ip))
+		if conn.Config.User != "user" {
+			t.Errorf("TestSSHConn(%s): lost the User from the base config", test.ip)
+		}
+		got := params{Port: conn.Port, Ciphers: conn.Config.Ciphers, KeyExchanges: conn.Config.KeyExchanges, Session: conn.Session}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestSSHConn(%s): -want/+got:\n%s", test.ip, diff)
+		}
+	}
+
+	if conn, ok := c.telnetForIP(net.ParseIP("10.1.2.3")); !ok {
+		t.Errorf("TestSSHConn: telnet was not allowed for 10.1.2.3")
+	} else if conn.Transport != sshCDP.TransportTelnet || conn.Password != "pass" || conn.Config.User != "user" {
+		t.Errorf("TestSSHConn: telnet Conn for 10.1.2.3 was %+v", conn)
+	}
+	for _, ip := range []string{"192.168.0.1", "10.2.2.3"} {
+		if _, ok := c.telnetForIP(net.ParseIP(ip)); ok {
+			t.Errorf("TestSSHConn: telnet was allowed for %s", ip)
+		}
+	}
+
+	bad := []SSH{
+		{Port: 70000},
+		{Overrides: []SSHOverride{{Port: 22}}},
+		{Overrides: []SSHOverride{{Prefixes: []string{"10.0.0.0"}}}},
+		{Session: "telnet"},
+		{Overrides: []SSHOverride{{Prefixes: []string{"10.0.0.0/8"}, Session: "telnet"}}},
+		{Overrides: []SSHOverride{{Prefixes: []string{"10.0.0.0/8"}, Telnet: true, TelnetPort: -1}}},
+	}
+	for _, s := range bad {
+		if _, err := s.conn(&ssh.ClientConfig{}, nil, newBastionCache(&sshAgent{})); err == nil {
+			t.Errorf("TestSSHConn(%+v): got err == nil, want err != nil", s)
+		}
+	}
+}
+
+func TestSharedBastion(t *testing.T) {
+	hop := JumpHost{Addr: "bastion.example.com", User: "jump", Pass: "pass"}
+	c := Config{
+		SSHConn: []SSH{
+			{User: "user1", Pass: "pass1", ProxyJump: []JumpHost{hop}},
+			{
+				User:      "user2",
+				Pass:      "pass2",
+				ProxyJump: []JumpHost{{Addr: "bastion.example.com:22", User: "jump", Pass: "pass"}},
+				Overrides: []SSHOverride{
+					{Prefixes: []string{"10.1.0.0/16"}, ProxyJump: []JumpHost{hop}},
+					{Prefixes: []string{"10.2.0.0/16"}, ProxyJump: []JumpHost{{Addr: "bastion.example.com", User: "other", Pass: "pass"}}},
+				},
+			},
+		},
+	}
+
+	jumps := newBastionCache(&sshAgent{})
+	conns, err := c.sshConns(ssh.ClientConfig{}, nil, nil, jumps)
+	if err != nil {
+		t.Fatalf("TestSharedBastion: sshConns() had error: %s", err)
+	}
+
+	shared := conns[0].base.Bastion
+	if shared == nil {
+		t.Fatalf("TestSharedBastion: SSHConn[0] has no Bastion")
+	}
+	if conns[1].base.Bastion != shared {
+		t.Errorf("TestSharedBastion: SSHConn[1] with the same ProxyJump has its own Bastion")
+	}
+	if got := conns[1].forIP(net.ParseIP("10.1.0.1")).Bastion; got != shared {
+		t.Errorf("TestSharedBastion: Override with the same ProxyJump has its own Bastion")
+	}
+	if got := conns[1].forIP(net.ParseIP("10.2.0.1")).Bastion; got == shared {
+		t.Errorf("TestSharedBastion: Override with a different jump host user shares the Bastion")
+	}
+	if len(jumps.all) != 2 {
+		t.Errorf("TestSharedBastion: got %d bastions, want 2", len(jumps.all))
+	}
+}
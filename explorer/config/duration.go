@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that is written in the config file as a string that
+// time.ParseDuration() understands, such as "30s" or "1m30s". A number is taken as nanoseconds.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case string:
+		dur, err := time.ParseDuration(t)
+		if err != nil {
+			return err
+		}
+		*d = Duration(dur)
+	case float64:
+		*d = Duration(t)
+	default:
+		return fmt.Errorf("duration must be a string like \"30s\" or a number, was %s", string(b))
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
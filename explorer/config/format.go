@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of a config file.
+type Format string
+
+// Config file formats.
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// FormatOf returns the Format of the config file at path, from its extension.
+// Files ending in .yaml or .yml are YAML, .toml is TOML and anything else is JSON.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatJSON
+}
+
+// ParseFormat returns the Format called s.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatJSON, FormatYAML, FormatTOML:
+		return f, nil
+	case "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("format must be %q, %q or %q, was %q", FormatJSON, FormatYAML, FormatTOML, s)
+}
+
+// Convert reads the config file at path and returns it in Format to. The file is checked
+// like Load() does, except that it isn't validated as a whole, so partial files can be
+// converted. Comments are lost and fields are sorted by name.
+func Convert(path string, b []byte, to Format) ([]byte, error) {
+	f, errs := parseFile(path, b)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return encode(f.doc, to)
+}
+
+// decode decodes b, which is in format, into a JSON document. It also returns the lines
+// that fields are on, by their lowercased path.
+func decode(b []byte, format Format) ([]byte, map[string]int, *Error) {
+	switch format {
+	case FormatYAML:
+		var n yaml.Node
+		if err := yaml.Unmarshal(b, &n); err != nil {
+			return nil, nil, yamlError(err)
+		}
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, nil, yamlError(err)
+		}
+		j, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, &Error{Err: fmt.Errorf("could not convert YAML: %s", err)}
+		}
+		lines := map[string]int{}
+		yamlLines(&n, "", lines)
+		return j, lines, nil
+	case FormatTOML:
+		var v map[string]interface{}
+		if _, err := toml.Decode(string(b), &v); err != nil {
+			e := &Error{Err: err}
+			if pe, ok := err.(toml.ParseError); ok {
+				e.Line, e.Err = pe.Position.Line, fmt.Errorf("%s", pe.Message)
+			}
+			return nil, nil, e
+		}
+		j, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, &Error{Err: fmt.Errorf("could not convert TOML: %s", err)}
+		}
+		return j, tomlLines(b), nil
+	}
+	return b, fieldLines(b), nil
+}
+
+var yamlLineRE = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// yamlError converts a YAML error to an *Error, moving the line number in its message to Line.
+func yamlError(err error) *Error {
+	m := yamlLineRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return &Error{Err: err}
+	}
+	n, _ := strconv.Atoi(m[1])
+	return &Error{Line: n, Err: fmt.Errorf("%s", strings.TrimPrefix(err.Error(), m[0]))}
+}
+
+// yamlLines records the line of n and everything in it, by lowercased path.
+func yamlLines(n *yaml.Node, path string, lines map[string]int) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			yamlLines(c, path, lines)
+		}
+		return
+	case yaml.AliasNode:
+		return
+	}
+	if _, ok := lines[path]; !ok && path != "" {
+		lines[path] = n.Line
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			p := join(path, strings.ToLower(n.Content[i].Value))
+			lines[p] = n.Content[i].Line
+			yamlLines(n.Content[i+1], p, lines)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			yamlLines(c, fmt.Sprintf("%s[%d]", path, i), lines)
+		}
+	}
+}
+
+var (
+	tomlTableRE = regexp.MustCompile(`^\[\s*([^\[\]]+?)\s*\]`)
+	tomlArrayRE = regexp.MustCompile(`^\[\[\s*([^\[\]]+?)\s*\]\]`)
+	tomlKeyRE   = regexp.MustCompile(`^([A-Za-z0-9_\-."' ]+?)\s*=`)
+)
+
+// tomlLines returns the lines of the tables and keys in the TOML in b, by lowercased path.
+// The TOML package doesn't say where keys are, so this is a line by line scan that only
+// understands the forms of TOML a config uses. Values that span lines, such as long lists,
+// are located at the line of their key.
+func tomlLines(b []byte) map[string]int {
+	lines := map[string]int{}
+	// counts are the number of tables in each array of tables seen so far.
+	counts := map[string]int{}
+
+	// resolve returns the path of a table name, with the index of the last table of any
+	// array of tables in it.
+	resolve := func(name string) string {
+		path := ""
+		for _, part := range tomlKeyParts(name) {
+			path = join(path, part)
+			if c := counts[path]; c > 0 {
+				path = fmt.Sprintf("%s[%d]", path, c-1)
+			}
+		}
+		return path
+	}
+	table := ""
+	for i, l := range strings.Split(string(b), "\n") {
+		line := i + 1
+		l = strings.TrimSpace(l)
+		if m := tomlArrayRE.FindStringSubmatch(l); m != nil {
+			parts := tomlKeyParts(m[1])
+			array := join(resolve(strings.Join(parts[:len(parts)-1], ".")), parts[len(parts)-1])
+			if _, ok := lines[array]; !ok {
+				lines[array] = line
+			}
+			table = fmt.Sprintf("%s[%d]", array, counts[array])
+			counts[array]++
+			lines[table] = line
+			continue
+		}
+		if m := tomlTableRE.FindStringSubmatch(l); m != nil {
+			table = resolve(m[1])
+			lines[table] = line
+			continue
+		}
+		if m := tomlKeyRE.FindStringSubmatch(l); m != nil {
+			path := table
+			for _, part := range tomlKeyParts(m[1]) {
+				path = join(path, part)
+				if _, ok := lines[path]; !ok {
+					lines[path] = line
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// tomlKeyParts splits a dotted TOML key into its lowercased parts, without quotes.
+func tomlKeyParts(key string) []string {
+	var parts []string
+	for _, p := range strings.Split(key, ".") {
+		parts = append(parts, strings.ToLower(strings.Trim(strings.TrimSpace(p), `"'`)))
+	}
+	return parts
+}
+
+// encode encodes the JSON document doc in format.
+func encode(doc map[string]interface{}, format Format) ([]byte, error) {
+	v := plain(doc)
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case FormatYAML:
+		buf := &bytes.Buffer{}
+		enc := yaml.NewEncoder(buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatTOML:
+		buf := &bytes.Buffer{}
+		enc := toml.NewEncoder(buf)
+		enc.Indent = ""
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// plain returns v, a decoded JSON document, with json.Numbers converted to int64 or float64
+// and nulls removed, which YAML and TOML encoders understand.
+func plain(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			if e == nil {
+				continue
+			}
+			m[k] = plain(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0, len(t))
+		for _, e := range t {
+			l = append(l, plain(e))
+		}
+		// TOML needs lists of tables to have the type to encode them as arrays of tables.
+		maps := make([]map[string]interface{}, 0, len(l))
+		for _, e := range l {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				return l
+			}
+			maps = append(maps, m)
+		}
+		if len(maps) > 0 {
+			return maps
+		}
+		return l
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
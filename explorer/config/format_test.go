@@ -0,0 +1,257 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+const (
+	jsonConfig = `{
+  "SSHConn": [
+    {
+      "User": "admin",
+      "Pass": "env:PASS",
+      "Prefixes": ["10.0.0.0/8"],
+      "Overrides": [{"Prefixes": ["10.1.0.0/16"], "Port": 2222}]
+    },
+    {"User": "ops", "Agent": true}
+  ],
+  "Limits": {"Workers": 4, "LoginsPerSecond": 1.5},
+  "Timeouts": {"Dial": "10s"}
+}`
+
+	yamlConfig = `# Devices in 10/8.
+SSHConn:
+  - User: admin
+    Pass: env:PASS
+    Prefixes: [10.0.0.0/8]
+    Overrides:
+      - Prefixes:
+          - 10.1.0.0/16
+        Port: 2222
+  - User: ops
+    Agent: true
+Limits:
+  Workers: 4
+  LoginsPerSecond: 1.5
+Timeouts:
+  Dial: 10s
+`
+
+	tomlConfig = `# Devices in 10/8.
+[[SSHConn]]
+User = "admin"
+Pass = "env:PASS"
+Prefixes = ["10.0.0.0/8"]
+
+  [[SSHConn.Overrides]]
+  Prefixes = ["10.1.0.0/16"]
+  Port = 2222
+
+[[SSHConn]]
+User = "ops"
+Agent = true
+
+[Limits]
+Workers = 4
+LoginsPerSecond = 1.5
+
+[Timeouts]
+Dial = "10s"
+`
+)
+
+func TestFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"netcrawl.conf": jsonConfig,
+		"netcrawl.yaml": yamlConfig,
+		"netcrawl.toml": tomlConfig,
+	}
+	writeConfigs(t, dir, files)
+
+	want := Config{
+		SSHConn: []SSH{
+			{
+				User:      "admin",
+				Pass:      "env:PASS",
+				Prefixes:  []string{"10.0.0.0/8"},
+				Overrides: []SSHOverride{{Prefixes: []string{"10.1.0.0/16"}, Port: 2222}},
+			},
+			{User: "ops", Agent: true},
+		},
+		Limits:   Limits{Workers: 4, LoginsPerSecond: 1.5},
+		Timeouts: Timeouts{Dial: Duration(10 * time.Second)},
+	}
+
+	for name := range files {
+		path := filepath.Join(dir, name)
+		got, err := Load(path)
+		if err != nil {
+			t.Errorf("TestFormats(%s): Load() had error: %s", name, err)
+			continue
+		}
+		if diff := pretty.Compare(want, got); diff != "" {
+			t.Errorf("TestFormats(%s): -want/+got:\n%s", name, diff)
+		}
+
+		// Every file converts to every format without changing the config.
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []Format{FormatJSON, FormatYAML, FormatTOML} {
+			conv, err := Convert(path, b, f)
+			if err != nil {
+				t.Errorf("TestFormats(%s): Convert(%s) had error: %s", name, f, err)
+				continue
+			}
+			out := filepath.Join(dir, "converted."+string(f))
+			if err := ioutil.WriteFile(out, conv, 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(out)
+			if err != nil {
+				t.Errorf("TestFormats(%s): Load() of Convert(%s) had error: %s\n%s", name, f, err, conv)
+				continue
+			}
+			if diff := pretty.Compare(want, got); diff != "" {
+				t.Errorf("TestFormats(%s): Convert(%s): -want/+got:\n%s", name, f, diff)
+			}
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigs(t, dir, map[string]string{
+		"fields.yaml": `SSHConn:
+  - User: admin
+    Pass: pass
+    Overrides:
+      - Prefixes: [10.0.0.0/8]
+        Port: lots
+Colour: blue
+`,
+		"valid.yaml": `SSHConn:
+  - User: admin
+    Pass: pass
+    Overrides:
+      - Prefixes: [10.0.0.0/8]
+        Port: 70000
+`,
+		"syntax.yaml": `SSHConn:
+  - User: admin
+    Pass: pass: word
+`,
+		"fields.toml": `Colour = "blue"
+
+[[SSHConn]]
+User = "admin"
+Pass = "pass"
+
+[[SSHConn]]
+User = "ops"
+Pass = "pass"
+
+  [[SSHConn.Overrides]]
+  Prefixes = ["10.0.0.0/8"]
+  Port = "lots"
+`,
+		"valid.toml": `[[SSHConn]]
+User = "admin"
+Pass = "pass"
+
+[[SSHConn]]
+User = "ops"
+Pass = "pass"
+Session = "telepathy"
+
+[Limits]
+SubnetBits = 33
+`,
+		"syntax.toml": `[[SSHConn]]
+User = "admin"
+Pass = pass
+`,
+	})
+
+	tests := []struct {
+		file string
+		want []Error
+	}{
+		{
+			file: "fields.yaml",
+			want: []Error{
+				{File: "fields.yaml", Line: 6, Field: "SSHConn[0].Overrides[0].Port"},
+				{File: "fields.yaml", Line: 7, Field: "Colour"},
+			},
+		},
+		{
+			file: "valid.yaml",
+			want: []Error{{File: "valid.yaml", Line: 6, Field: "SSHConn[0].Overrides[0].Port"}},
+		},
+		{
+			file: "syntax.yaml",
+			want: []Error{{File: "syntax.yaml", Line: 3}},
+		},
+		{
+			file: "fields.toml",
+			want: []Error{
+				{File: "fields.toml", Line: 1, Field: "Colour"},
+				{File: "fields.toml", Line: 13, Field: "SSHConn[1].Overrides[0].Port"},
+			},
+		},
+		{
+			file: "valid.toml",
+			want: []Error{
+				{File: "valid.toml", Line: 8, Field: "SSHConn[1].Session"},
+				{File: "valid.toml", Line: 11, Field: "Limits.SubnetBits"},
+			},
+		},
+		{
+			file: "syntax.toml",
+			want: []Error{{File: "syntax.toml", Line: 3}},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Load(filepath.Join(dir, test.file))
+		if err == nil {
+			t.Errorf("TestFormatErrors(%s): got err == nil, want err != nil", test.file)
+			continue
+		}
+		errs, ok := err.(Errors)
+		if !ok {
+			t.Errorf("TestFormatErrors(%s): got error of type %T, want Errors", test.file, err)
+			continue
+		}
+
+		got := map[string]Error{}
+		for _, e := range errs {
+			got[e.Field] = Error{File: filepath.Base(e.File), Line: e.Line, Field: e.Field}
+		}
+		want := map[string]Error{}
+		for _, e := range test.want {
+			want[e.Field] = e
+		}
+		if diff := pretty.Compare(want, got); diff != "" {
+			t.Errorf("TestFormatErrors(%s): -want/+got:\n%s", test.file, diff)
+		}
+	}
+}
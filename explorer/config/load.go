@@ -0,0 +1,295 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// Load reads the config files at paths and merges them into one Config. Each file may be
+// JSON, YAML or TOML, see FormatOf(). Files later in paths override earlier ones: objects
+// are merged field by field, while any other value, including a list, replaces the one
+// before it. So a file only needs the fields it changes.
+//
+// Every file is checked for syntax, unknown fields and values of the wrong type, and
+// the merged Config is checked with Validate(). All of the problems found are returned as
+// Errors, with the file and line of each one.
+func Load(paths ...string) (Config, error) {
+	if len(paths) == 0 {
+		return Config{}, fmt.Errorf("no config files to load")
+	}
+
+	var (
+		files  []*file
+		errs   Errors
+		merged = map[string]interface{}{}
+	)
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not read config: %s", err)
+		}
+		f, fileErrs := parseFile(p, b)
+		errs = append(errs, fileErrs...)
+		if f == nil {
+			continue
+		}
+		files = append(files, f)
+		merge(merged, f.doc)
+	}
+	if len(errs) > 0 {
+		return Config{}, errs
+	}
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return Config{}, err
+	}
+	conf := Config{}
+	if err := json.Unmarshal(b, &conf); err != nil {
+		return Config{}, fmt.Errorf("could not decode the merged config: %s", err)
+	}
+
+	if err := conf.Validate(); err != nil {
+		var errs Errors
+		if !errors.As(err, &errs) {
+			return Config{}, err
+		}
+		for _, e := range errs {
+			e.File, e.Line = locateField(files, e.Field)
+		}
+		return Config{}, errs
+	}
+	return conf, nil
+}
+
+// file is a parsed config file.
+type file struct {
+	path string
+	doc  map[string]interface{}
+	// lines are the lines that fields are on, by their lowercased path.
+	lines map[string]int
+}
+
+// parseFile parses the config file at path with content b and checks its fields.
+// The format of the file comes from its extension, see FormatOf().
+// If the file can't be parsed at all, the returned *file is nil.
+func parseFile(path string, b []byte) (*file, Errors) {
+	j, lines, e := decode(b, FormatOf(path))
+	if e != nil {
+		e.File = path
+		return nil, Errors{e}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		e := &Error{File: path, Err: err}
+		if se, ok := err.(*json.SyntaxError); ok {
+			e.Line = lineAt(j, se.Offset)
+		}
+		return nil, Errors{e}
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, Errors{{File: path, Line: lineAt(j, dec.InputOffset()), Err: fmt.Errorf("has data after the config")}}
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, Errors{{File: path, Line: 1, Err: fmt.Errorf("must be a map of config fields")}}
+	}
+
+	f := &file{path: path, doc: m, lines: lines}
+	var errs Errors
+	checkFields(m, reflect.TypeOf(Config{}), "", func(field string, err error) {
+		errs = append(errs, &Error{File: path, Line: f.lines[strings.ToLower(field)], Field: field, Err: err})
+	})
+	return f, errs
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkFields calls report for every field of v, the decoded JSON for a value of type t
+// at path, that isn't in t or can't be decoded into t.
+func checkFields(v interface{}, t reflect.Type, path string, report func(field string, err error)) {
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		checkValue(v, t, path, report)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, fv := range m {
+			sf, ok := fieldByName(t, k)
+			if !ok {
+				report(join(path, k), fmt.Errorf("unknown field"))
+				continue
+			}
+			checkFields(fv, sf.Type, join(path, sf.Name), report)
+		}
+		return
+	case reflect.Slice:
+		l, ok := v.([]interface{})
+		if !ok {
+			break
+		}
+		for i, ev := range l {
+			checkFields(ev, t.Elem(), fmt.Sprintf("%s[%d]", path, i), report)
+		}
+		return
+	}
+	checkValue(v, t, path, report)
+}
+
+// checkValue reports if v can't be decoded into a t.
+func checkValue(v interface{}, t reflect.Type, path string, report func(field string, err error)) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		report(path, err)
+		return
+	}
+	if err := json.Unmarshal(b, reflect.New(t).Interface()); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			err = fmt.Errorf("must be a %s, was a %s", t, te.Value)
+		}
+		report(path, err)
+	}
+}
+
+// fieldByName returns the exported field of t called name, ignoring case like encoding/json does.
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		if strings.EqualFold(sf.Name, name) {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// merge merges src into dst. Keys are matched ignoring case, like encoding/json does.
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		for dk := range dst {
+			if dk != k && strings.EqualFold(dk, k) {
+				dst[k] = dst[dk]
+				delete(dst, dk)
+				break
+			}
+		}
+		sm, ok := v.(map[string]interface{})
+		if ok {
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				merge(dm, sm)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// fieldLines returns the line of every field and list element in the JSON in b, by its
+// lowercased path, such as "sshconn[0].port".
+func fieldLines(b []byte) map[string]int {
+	lines := map[string]int{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := lines[path]; !ok {
+			lines[path] = lineAt(b, dec.InputOffset()-1)
+		}
+		d, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+		switch d {
+		case '{':
+			for dec.More() {
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				p := join(path, strings.ToLower(tok.(string)))
+				lines[p] = lineAt(b, dec.InputOffset()-1)
+				if err := walk(p); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	walk("")
+	return lines
+}
+
+// lineAt returns the line that offset is on in b.
+func lineAt(b []byte, offset int64) int {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
+
+// locateField returns the file and line that field is set in. If the field isn't in any
+// file, the closest enclosing field that is is used. Later files take precedence, as they
+// do when merging.
+func locateField(files []*file, field string) (string, int) {
+	p := strings.ToLower(field)
+	for {
+		for i := len(files) - 1; i >= 0; i-- {
+			if line, ok := files[i].lines[p]; ok && p != "" {
+				return files[i].path, line
+			}
+		}
+		if p == "" {
+			break
+		}
+		p = parent(p)
+	}
+	if len(files) == 0 {
+		return "", 0
+	}
+	return files[len(files)-1].path, 0
+}
+
+// parent returns the path of the field or list that holds the field at path.
+func parent(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func writeConfigs(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigs(t, dir, map[string]string{
+		"etc.conf": `{
+  "SSHConn": [{"User": "admin", "Pass": "etcpass"}],
+  "Limits": {"Workers": 8, "SubnetBits": 16},
+  "Timeouts": {"Dial": "10s"}
+}`,
+		"local.conf": `{
+  "limits": {"workers": 4},
+  "Timeouts": {"Command": "30s"}
+}`,
+		"flag.conf": `{
+  "SSHConn": [{"User": "ops", "Pass": "env:OPS_PASS"}]
+}`,
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	got, err := Load(path("etc.conf"), path("local.conf"), path("flag.conf"))
+	if err != nil {
+		t.Fatalf("TestLoad: had error: %s", err)
+	}
+	want := Config{
+		SSHConn:  []SSH{{User: "ops", Pass: "env:OPS_PASS"}},
+		Limits:   Limits{Workers: 4, SubnetBits: 16},
+		Timeouts: Timeouts{Dial: Duration(10 * time.Second), Command: Duration(30 * time.Second)},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestLoad: -want/+got:\n%s", diff)
+	}
+
+	if _, err := Load(path("none.conf")); err == nil {
+		t.Errorf("TestLoad(missing file): got err == nil, want err != nil")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigs(t, dir, map[string]string{
+		"base.conf": `{
+  "SSHConn": [
+    {
+      "User": "admin",
+      "Pass": "pass",
+      "Session": "telepathy"
+    }
+  ]
+}`,
+		"override.conf": `{
+  "SSHConn": [
+    {"User": "admin", "Pass": "pass"},
+    {
+      "User": "other",
+      "Pass": "pass",
+      "Port": 70000
+    }
+  ]
+}`,
+		"syntax.conf": `{
+  "SSHConn": [
+    {"User": "admin",}
+  ]
+}`,
+		"fields.conf": `{
+  "SSHConn": [{"User": "admin", "Pass": "pass"}],
+  "Limits": {
+    "Workers": "many"
+  },
+  "Timeouts": {"Dial": "soon"},
+  "Colour": "blue"
+}`,
+		"notobject.conf": `["SSHConn"]`,
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		desc  string
+		files []string
+		want  []Error
+	}{
+		{
+			desc:  "Validation error",
+			files: []string{"base.conf"},
+			want:  []Error{{File: "base.conf", Line: 6, Field: "SSHConn[0].Session"}},
+		},
+		{
+			desc:  "Validation error in the file that set the field",
+			files: []string{"base.conf", "override.conf"},
+			want:  []Error{{File: "override.conf", Line: 7, Field: "SSHConn[1].Port"}},
+		},
+		{
+			desc:  "Syntax error",
+			files: []string{"syntax.conf"},
+			want:  []Error{{File: "syntax.conf", Line: 3}},
+		},
+		{
+			desc:  "Unknown fields and bad types",
+			files: []string{"fields.conf"},
+			want: []Error{
+				{File: "fields.conf", Line: 7, Field: "Colour"},
+				{File: "fields.conf", Line: 4, Field: "Limits.Workers"},
+				{File: "fields.conf", Line: 6, Field: "Timeouts.Dial"},
+			},
+		},
+		{
+			desc:  "Not an object",
+			files: []string{"notobject.conf"},
+			want:  []Error{{File: "notobject.conf", Line: 1}},
+		},
+	}
+
+	for _, test := range tests {
+		var paths []string
+		for _, f := range test.files {
+			paths = append(paths, path(f))
+		}
+		_, err := Load(paths...)
+		if err == nil {
+			t.Errorf("TestLoadErrors(%s): got err == nil, want err != nil", test.desc)
+			continue
+		}
+		errs, ok := err.(Errors)
+		if !ok {
+			t.Errorf("TestLoadErrors(%s): got error of type %T, want Errors", test.desc, err)
+			continue
+		}
+
+		got := map[string]Error{}
+		for _, e := range errs {
+			got[e.Field] = Error{File: filepath.Base(e.File), Line: e.Line, Field: e.Field}
+		}
+		want := map[string]Error{}
+		for _, e := range test.want {
+			want[e.Field] = e
+		}
+		if diff := pretty.Compare(want, got); diff != "" {
+			t.Errorf("TestLoadErrors(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ssh := SSH{User: "admin", Pass: "pass"}
+
+	tests := []struct {
+		desc string
+		conf Config
+		want []string
+	}{
+		{desc: "Valid", conf: Config{SSHConn: []SSH{ssh}}},
+		{desc: "No discovery", conf: Config{}, want: []string{""}},
+		{
+			desc: "SSH problems",
+			conf: Config{
+				SSHConn: []SSH{
+					{
+						Prefixes:  []string{"10.0.0.0"},
+						Sites:     []string{"nyc"},
+						Overrides: []SSHOverride{{Session: "x"}},
+						ProxyJump: []JumpHost{{User: "jump", Agent: true}},
+					},
+				},
+			},
+			want: []string{
+				"SSHConn[0].User",
+				"SSHConn[0]",
+				"SSHConn[0].ProxyJump[0].Addr",
+				"SSHConn[0].Prefixes[0]",
+				"SSHConn[0].Sites[0]",
+				"SSHConn[0].Overrides[0].Prefixes",
+				"SSHConn[0].Overrides[0].Session",
+			},
+		},
+		{
+			desc: "Other problems",
+			conf: Config{
+				SSHConn:      []SSH{ssh},
+				SNMPConn:     []SNMP{{Version: "1"}},
+				PreferFamily: "ipx",
+				HostKeys:     HostKeys{Mode: "trusting"},
+				Limits:       Limits{Workers: -1, SubnetBits: 33},
+				Scope:        Scope{SkipPlatforms: []string{"("}},
+				Sites:        []Site{{Name: "nyc"}},
+				Proxies:      []Proxy{{Prefixes: []string{"10.0.0.0/8"}, Type: "ftp", Addr: "proxy"}},
+				Sweep:        Sweep{Prefixes: []string{"10.0.0.1"}, Concurrency: -1},
+			},
+			want: []string{
+				"PreferFamily",
+				"HostKeys.Mode",
+				"Limits.Workers",
+				"Limits.SubnetBits",
+				"Sweep.Prefixes[0]",
+				"Sweep.Concurrency",
+				"Scope.SkipPlatforms[0]",
+				"Sites[0].Prefixes",
+				"SNMPConn[0]",
+				"Proxies[0].Type",
+				"Proxies[0].Addr",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		err := test.conf.Validate()
+		var got []string
+		if err != nil {
+			for _, e := range err.(Errors) {
+				got = append(got, e.Field)
+			}
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestValidate(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	sshCDP "github.com/johnsiilver/netcrawl/explorer/internal/cli/cdp"
+	"github.com/johnsiilver/netcrawl/explorer/internal/proxy"
+)
+
+// Proxy types for Proxy.Type.
+const (
+	ProxySOCKS5 = "socks5"
+	ProxyHTTP   = "http"
+)
+
+// Proxy is a proxy that connections to devices in Prefixes are made through. It is not
+// used for devices reached through SSH ProxyJump hosts.
+type Proxy struct {
+	// Prefixes are the CIDR prefixes of the devices to use the proxy for.
+	Prefixes []string
+	// Type is ProxySOCKS5 or ProxyHTTP (HTTP CONNECT).
+	Type string
+	// Addr is the host:port of the proxy.
+	Addr string
+	// User and Pass authenticate to the proxy, if it needs it.
+	User string
+	Pass string
+}
+
+// proxies are the Proxies of a Config, ready to dial with.
+type proxies []proxyDialer
+
+type proxyDialer struct {
+	nets   []*net.IPNet
+	dialer sshCDP.NetDialer
+}
+
+// forIP returns the dialer of the proxy to use for ip, or nil if there isn't one.
+func (p proxies) forIP(ip net.IP) sshCDP.NetDialer {
+	for _, pd := range p {
+		for _, n := range pd.nets {
+			if n.Contains(ip) {
+				return pd.dialer
+			}
+		}
+	}
+	return nil
+}
+
+// proxies returns the dialers for c.Proxies.
+func (c Config) proxies() (proxies, error) {
+	var p proxies
+	for i, conf := range c.Proxies {
+		if len(conf.Prefixes) == 0 {
+			return nil, fmt.Errorf("Proxies[%d] has no Prefixes", i)
+		}
+		var nets []*net.IPNet
+		for _, pre := range conf.Prefixes {
+			_, n, err := net.ParseCIDR(pre)
+			if err != nil {
+				return nil, fmt.Errorf("Proxies[%d] has bad prefix %q: %s", i, pre, err)
+			}
+			nets = append(nets, n)
+		}
+		if _, _, err := net.SplitHostPort(conf.Addr); err != nil {
+			return nil, fmt.Errorf("Proxies[%d] Addr %q must be host:port", i, conf.Addr)
+		}
+
+		var d sshCDP.NetDialer
+		switch strings.ToLower(conf.Type) {
+		case ProxySOCKS5:
+			var err error
+			d, err = proxy.SOCKS5(conf.Addr, conf.User, conf.Pass, nil)
+			if err != nil {
+				return nil, fmt.Errorf("Proxies[%d]: %s", i, err)
+			}
+		case ProxyHTTP:
+			d = proxy.HTTPConnect(conf.Addr, conf.User, conf.Pass, nil)
+		default:
+			return nil, fmt.Errorf("Proxies[%d] Type must be %q or %q, was %q", i, ProxySOCKS5, ProxyHTTP, conf.Type)
+		}
+		p = append(p, proxyDialer{nets: nets, dialer: d})
+	}
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"net"
+	"testing"
+)
+
+func TestProxies(t *testing.T) {
+	c := Config{
+		Proxies: []Proxy{
+			{Prefixes: []string{"10.1.0.0/16"}, Type: ProxySOCKS5, Addr: "127.0.0.1:1080"},
+			{Prefixes: []string{"10.0.0.0/8", "2001:db8::/32"}, Type: "HTTP", Addr: "proxy.example.com:3128", User: "user", Pass: "pass"},
+		},
+	}
+	p, err := c.proxies()
+	if err != nil {
+		t.Fatalf("TestProxies: proxies() had error: %s", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want int // index into p, -1 for no proxy.
+	}{
+		{ip: "192.168.0.1", want: -1},
+		{ip: "10.1.2.3", want: 0},
+		{ip: "10.2.2.3", want: 1},
+		{ip: "2001:db8::1", want: 1},
+	}
+
+	for _, test := range tests {
+		got := p.forIP(net.ParseIP(test.ip))
+		switch {
+		case test.want == -1 && got != nil:
+			t.Errorf("TestProxies(%s): got a proxy, want none", test.ip)
+		case test.want >= 0 && got != p[test.want].dialer:
+			t.Errorf("TestProxies(%s): did not get Proxies[%d]", test.ip, test.want)
+		}
+	}
+
+	bad := []Proxy{
+		{Type: ProxySOCKS5, Addr: "127.0.0.1:1080"},
+		{Prefixes: []string{"10.0.0.0"}, Type: ProxySOCKS5, Addr: "127.0.0.1:1080"},
+		{Prefixes: []string{"10.0.0.0/8"}, Type: ProxySOCKS5, Addr: "127.0.0.1"},
+		{Prefixes: []string{"10.0.0.0/8"}, Type: "socks4", Addr: "127.0.0.1:1080"},
+	}
+	for _, b := range bad {
+		if _, err := (Config{Proxies: []Proxy{b}}).proxies(); err == nil {
+			t.Errorf("TestProxies(%+v): got err == nil, want err != nil", b)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// RootType is the network.Node.Type of the root node of a crawl, whose platform isn't known.
+const RootType = "RootNode"
+
+// sshScope is the compiled form of SSH.Prefixes, SSH.Platforms and SSH.Sites.
+type sshScope struct {
+	nets      []*net.IPNet
+	platforms []*regexp.Regexp
+}
+
+// applies returns true if the SSH config may be tried on node.
+func (s sshScope) applies(node *network.Node) bool {
+	if len(s.nets) > 0 {
+		in := false
+		for _, n := range s.nets {
+			if n.Contains(node.IP) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+
+	if len(s.platforms) == 0 || node.Type == "" || node.Type == RootType {
+		return true
+	}
+	for _, re := range s.platforms {
+		if re.MatchString(node.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// scope compiles the scope of s. sites are the prefixes of each site by name.
+func (s SSH) scope(sites map[string][]*net.IPNet) (sshScope, error) {
+	var sc sshScope
+	for _, p := range s.Prefixes {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return sshScope{}, fmt.Errorf("bad prefix %q: %s", p, err)
+		}
+		sc.nets = append(sc.nets, n)
+	}
+	for _, name := range s.Sites {
+		nets, ok := sites[name]
+		if !ok {
+			return sshScope{}, fmt.Errorf("Sites has %q, which is not in the config's Sites", name)
+		}
+		sc.nets = append(sc.nets, nets...)
+	}
+	for _, p := range s.Platforms {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return sshScope{}, fmt.Errorf("bad Platforms regexp: %s", err)
+		}
+		sc.platforms = append(sc.platforms, re)
+	}
+	return sc, nil
+}
+
+// sites returns the prefixes of each of c.Sites by name.
+func (c Config) sites() (map[string][]*net.IPNet, error) {
+	m := map[string][]*net.IPNet{}
+	for i, site := range c.Sites {
+		if site.Name == "" {
+			return nil, fmt.Errorf("Sites[%d] has no Name", i)
+		}
+		if _, ok := m[site.Name]; ok {
+			return nil, fmt.Errorf("Sites[%d] has the same Name as another site, %q", i, site.Name)
+		}
+		if len(site.Prefixes) == 0 {
+			return nil, fmt.Errorf("Sites[%d](%s) has no Prefixes", i, site.Name)
+		}
+		for _, p := range site.Prefixes {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				return nil, fmt.Errorf("Sites[%d](%s) has bad prefix %q: %s", i, site.Name, p, err)
+			}
+			m[site.Name] = append(m[site.Name], n)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+func TestSSHScope(t *testing.T) {
+	c := Config{
+		Sites: []Site{
+			{Name: "nyc", Prefixes: []string{"10.1.0.0/16"}},
+			{Name: "lon", Prefixes: []string{"10.2.0.0/16", "2001:db8:2::/48"}},
+		},
+	}
+	sites, err := c.sites()
+	if err != nil {
+		t.Fatalf("TestSSHScope: sites() had error: %s", err)
+	}
+
+	tests := []struct {
+		desc string
+		ssh  SSH
+		ip   string
+		typ  string
+		want bool
+	}{
+		{desc: "No scope", ssh: SSH{}, ip: "192.168.0.1", typ: "cisco WS-C2950-12", want: true},
+		{desc: "In prefix", ssh: SSH{Prefixes: []string{"192.168.0.0/24"}}, ip: "192.168.0.1", want: true},
+		{desc: "Not in prefix", ssh: SSH{Prefixes: []string{"192.168.0.0/24"}}, ip: "192.168.1.1"},
+		{desc: "In site", ssh: SSH{Sites: []string{"nyc", "lon"}}, ip: "2001:db8:2::1", want: true},
+		{desc: "Not in site", ssh: SSH{Sites: []string{"nyc"}}, ip: "10.2.0.1"},
+		{desc: "In prefix, not in site", ssh: SSH{Prefixes: []string{"10.2.0.0/24"}, Sites: []string{"nyc"}}, ip: "10.2.0.1", want: true},
+		{desc: "Platform matches", ssh: SSH{Platforms: []string{"(?i)ws-c"}}, ip: "10.0.0.1", typ: "cisco WS-C2950-12", want: true},
+		{desc: "Platform doesn't match", ssh: SSH{Platforms: []string{"Juniper"}}, ip: "10.0.0.1", typ: "cisco WS-C2950-12"},
+		{desc: "Root matches any platform", ssh: SSH{Platforms: []string{"Juniper"}}, ip: "10.0.0.1", typ: RootType, want: true},
+		{desc: "Platform matches, prefix doesn't", ssh: SSH{Prefixes: []string{"10.1.0.0/16"}, Platforms: []string{"cisco"}}, ip: "10.0.0.1", typ: "cisco WS-C2950-12"},
+	}
+
+	for _, test := range tests {
+		sc, err := test.ssh.scope(sites)
+		if err != nil {
+			t.Errorf("TestSSHScope(%s): scope() had error: %s", test.desc, err)
+			continue
+		}
+		node := &network.Node{IP: net.ParseIP(test.ip), Type: test.typ}
+		if got := sc.applies(node); got != test.want {
+			t.Errorf("TestSSHScope(%s): got %v, want %v", test.desc, got, test.want)
+		}
+	}
+
+	for _, s := range []SSH{{Prefixes: []string{"10.0.0.0"}}, {Sites: []string{"sfo"}}, {Platforms: []string{"("}}} {
+		if _, err := s.scope(sites); err == nil {
+			t.Errorf("TestSSHScope(%+v): got err == nil, want err != nil", s)
+		}
+	}
+	badSites := [][]Site{
+		{{Prefixes: []string{"10.0.0.0/8"}}},
+		{{Name: "nyc"}},
+		{{Name: "nyc", Prefixes: []string{"10.0.0.0/8"}}, {Name: "nyc", Prefixes: []string{"10.1.0.0/16"}}},
+		{{Name: "nyc", Prefixes: []string{"10.0.0.0"}}},
+	}
+	for _, s := range badSites {
+		if _, err := (Config{Sites: s}).sites(); err == nil {
+			t.Errorf("TestSSHScope(%+v): sites(): got err == nil, want err != nil", s)
+		}
+	}
+}
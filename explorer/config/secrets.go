@@ -0,0 +1,91 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/explorer/config/secrets"
+)
+
+// Secrets configures how secret references in credential fields are resolved. Any of
+// SSH.Pass, SSH.KeyPassphrase, SSH.EnableSecret, JumpHost.Pass, JumpHost.KeyPassphrase,
+// SNMP.Community, SNMP.AuthPass, SNMP.PrivPass and Proxy.Pass may be a reference such
+// as "env:NAME", "file:/path", "keystore:name" or "cmd:command". See package secrets.
+type Secrets struct {
+	// Keystore is the path to the encrypted keystore that "keystore:" references use.
+	Keystore string
+	// CommandTimeout is how long a "cmd:" reference may run. Defaults to 30 seconds.
+	CommandTimeout Duration
+}
+
+// ResolveSecrets returns a copy of c with the secret references in its credential fields
+// replaced by their secrets. passphrase is called to unlock the keystore, only if
+// a "keystore:" reference is used.
+func (c Config) ResolveSecrets(ctx context.Context, passphrase func() (string, error)) (Config, error) {
+	r := secrets.NewResolver(
+		secrets.WithProvider("cmd", secrets.Command{Timeout: time.Duration(c.Secrets.CommandTimeout)}),
+		secrets.WithProvider("keystore", &secrets.KeystoreProvider{Path: c.Secrets.Keystore, Passphrase: passphrase}),
+	)
+
+	var err error
+	resolve := func(name string, s *string) {
+		if err != nil || *s == "" {
+			return
+		}
+		var v string
+		v, err = r.Resolve(ctx, *s)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+			return
+		}
+		*s = v
+	}
+	jumps := func(name string, hosts []JumpHost) []JumpHost {
+		if hosts == nil {
+			return nil
+		}
+		hosts = append([]JumpHost(nil), hosts...)
+		for i := range hosts {
+			resolve(fmt.Sprintf("%s.ProxyJump[%d].Pass", name, i), &hosts[i].Pass)
+			resolve(fmt.Sprintf("%s.ProxyJump[%d].KeyPassphrase", name, i), &hosts[i].KeyPassphrase)
+		}
+		return hosts
+	}
+
+	out := c
+	out.SSHConn = append([]SSH(nil), c.SSHConn...)
+	for i := range out.SSHConn {
+		s := &out.SSHConn[i]
+		name := fmt.Sprintf("SSHConn[%d]", i)
+		resolve(name+".Pass", &s.Pass)
+		resolve(name+".KeyPassphrase", &s.KeyPassphrase)
+		resolve(name+".EnableSecret", &s.EnableSecret)
+		s.ProxyJump = jumps(name, s.ProxyJump)
+		if s.Overrides != nil {
+			s.Overrides = append([]SSHOverride(nil), s.Overrides...)
+			for x := range s.Overrides {
+				s.Overrides[x].ProxyJump = jumps(fmt.Sprintf("%s.Overrides[%d]", name, x), s.Overrides[x].ProxyJump)
+			}
+		}
+	}
+
+	out.SNMPConn = append([]SNMP(nil), c.SNMPConn...)
+	for i := range out.SNMPConn {
+		s := &out.SNMPConn[i]
+		name := fmt.Sprintf("SNMPConn[%d]", i)
+		resolve(name+".Community", &s.Community)
+		resolve(name+".AuthPass", &s.AuthPass)
+		resolve(name+".PrivPass", &s.PrivPass)
+	}
+
+	out.Proxies = append([]Proxy(nil), c.Proxies...)
+	for i := range out.Proxies {
+		resolve(fmt.Sprintf("Proxies[%d].Pass", i), &out.Proxies[i].Pass)
+	}
+
+	if err != nil {
+		return Config{}, err
+	}
+	return out, nil
+}
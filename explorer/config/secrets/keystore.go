@@ -0,0 +1,246 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// keystoreVersion is the version of keystores we write. Version 1 keystores didn't
+// authenticate their header, they are still read and are upgraded on Save().
+const keystoreVersion = 2
+
+// scrypt parameters for new keystores.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// The largest scrypt parameters a keystore may have, so a corrupt or hostile file can't make
+// us use unbounded CPU or memory. scrypt uses 128*N*R bytes.
+const (
+	maxScryptN   = 1 << 20
+	maxScryptR   = 32
+	maxScryptP   = 16
+	maxScryptMem = 1 << 30
+)
+
+// keystoreFile is the format of a keystore on disk. Data is the JSON encoded secrets,
+// encrypted with AES-256-GCM using a key derived from the passphrase with scrypt. The
+// header (everything before Nonce) is authenticated as additional data.
+type keystoreFile struct {
+	Version int
+	Salt    []byte
+	N, R, P int
+	Nonce   []byte
+	Data    []byte
+}
+
+// Keystore is a file of named secrets, encrypted with a passphrase.
+type Keystore struct {
+	path    string
+	file    keystoreFile
+	key     []byte
+	secrets map[string]string
+}
+
+// CreateKeystore returns a new, empty Keystore that will be written to path by Save().
+// It is an error if path exists.
+func CreateKeystore(path, passphrase string) (*Keystore, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("keystore %s already exists", path)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("keystore passphrase must not be empty")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	k := &Keystore{
+		path:    path,
+		file:    keystoreFile{Version: keystoreVersion, Salt: salt, N: scryptN, R: scryptR, P: scryptP},
+		secrets: map[string]string{},
+	}
+	var err error
+	if k.key, err = k.file.key(passphrase); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// OpenKeystore opens the Keystore at path with passphrase. The keystore file must only be
+// accessible by its owner.
+func OpenKeystore(path, passphrase string) (*Keystore, error) {
+	if err := CheckPerms(path); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keystore: %s", err)
+	}
+
+	k := &Keystore{path: path}
+	if err := json.Unmarshal(b, &k.file); err != nil {
+		return nil, fmt.Errorf("keystore %s is not a keystore: %s", path, err)
+	}
+	if k.file.Version < 1 || k.file.Version > keystoreVersion {
+		return nil, fmt.Errorf("keystore %s has unsupported version %d", path, k.file.Version)
+	}
+	if err := k.file.checkParams(); err != nil {
+		return nil, fmt.Errorf("keystore %s: %s", path, err)
+	}
+	if k.key, err = k.file.key(passphrase); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	var header []byte
+	if k.file.Version > 1 {
+		header = k.file.header()
+	}
+	plain, err := gcm.Open(nil, k.file.Nonce, k.file.Data, header)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt keystore %s, the passphrase is probably wrong", path)
+	}
+	if err := json.Unmarshal(plain, &k.secrets); err != nil {
+		return nil, fmt.Errorf("keystore %s had bad data: %s", path, err)
+	}
+	if k.secrets == nil {
+		k.secrets = map[string]string{}
+	}
+	return k, nil
+}
+
+// checkParams returns an error if the scrypt parameters of f are past our limits.
+func (f keystoreFile) checkParams() error {
+	switch {
+	case f.N <= 1 || f.N > maxScryptN:
+		return fmt.Errorf("scrypt N must be between 2 and %d, was %d", maxScryptN, f.N)
+	case f.R < 1 || f.R > maxScryptR:
+		return fmt.Errorf("scrypt r must be between 1 and %d, was %d", maxScryptR, f.R)
+	case f.P < 1 || f.P > maxScryptP:
+		return fmt.Errorf("scrypt p must be between 1 and %d, was %d", maxScryptP, f.P)
+	case int64(128)*int64(f.N)*int64(f.R) > maxScryptMem:
+		return fmt.Errorf("scrypt N=%d and r=%d need more than %d bytes", f.N, f.R, maxScryptMem)
+	}
+	return nil
+}
+
+// header returns the additional data that authenticates the header of f.
+func (f keystoreFile) header() []byte {
+	b, _ := json.Marshal(struct {
+		Version int
+		Salt    []byte
+		N, R, P int
+	}{f.Version, f.Salt, f.N, f.R, f.P})
+	return b
+}
+
+// key derives the encryption key from passphrase.
+func (f keystoreFile) key(passphrase string) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), f.Salt, f.N, f.R, f.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive keystore key: %s", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get returns the secret called name.
+func (k *Keystore) Get(name string) (string, bool) {
+	s, ok := k.secrets[name]
+	return s, ok
+}
+
+// Set sets the secret called name. Save() writes it to disk.
+func (k *Keystore) Set(name, secret string) {
+	k.secrets[name] = secret
+}
+
+// Delete removes the secret called name, returning false if it didn't exist.
+// Save() writes the change to disk.
+func (k *Keystore) Delete(name string) bool {
+	if _, ok := k.secrets[name]; !ok {
+		return false
+	}
+	delete(k.secrets, name)
+	return true
+}
+
+// Names returns the sorted names of the secrets in the Keystore.
+func (k *Keystore) Names() []string {
+	names := make([]string, 0, len(k.secrets))
+	for n := range k.secrets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the Keystore and writes it to its path, readable only by its owner.
+func (k *Keystore) Save() error {
+	plain, err := json.Marshal(k.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return err
+	}
+	f := k.file
+	f.Version = keystoreVersion
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, f.header())
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so a failed write can't lose the keystore.
+	tmp, err := ioutil.TempFile(filepath.Dir(k.path), filepath.Base(k.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("could not write keystore: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write keystore: %s", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write keystore: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write keystore: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return fmt.Errorf("could not write keystore: %s", err)
+	}
+	k.file = f
+	return nil
+}
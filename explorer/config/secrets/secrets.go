@@ -0,0 +1,211 @@
+// Package secrets resolves references to secrets, so that credentials don't have to be
+// written in plaintext in the config file. A reference is a scheme and a value:
+//
+//	env:NETCRAWL_SSH_PASS          the environment variable NETCRAWL_SSH_PASS
+//	file:/etc/netcrawl/ssh.pass    the contents of a file that only its owner can read
+//	keystore:ssh-admin             the secret ssh-admin in the encrypted keystore
+//	cmd:pass show network/ssh      the output of a command, such as pass, op or vault
+//	plain:env:not-a-reference      the rest of the value, for secrets that look like references
+//
+// Values without one of these schemes are returned as is.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider looks up secrets for a scheme.
+type Provider interface {
+	// Secret returns the secret for ref, which is the reference without the scheme.
+	Secret(ctx context.Context, ref string) (string, error)
+}
+
+// Env is a Provider that reads secrets from environment variables.
+type Env struct{}
+
+// Secret implements Provider.Secret().
+func (Env) Secret(ctx context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
+
+// File is a Provider that reads secrets from files. A trailing newline is removed.
+// On systems with Unix permissions, the file must not be accessible by group or others.
+type File struct{}
+
+// Secret implements Provider.Secret().
+func (File) Secret(ctx context.Context, path string) (string, error) {
+	if err := CheckPerms(path); err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file: %s", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// CheckPerms returns an error if the file at path can be accessed by anyone but its owner.
+// It does nothing on Windows.
+func CheckPerms(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("%s has permissions %#o, it must not be accessible by group or others (chmod 600 %s)", path, perm, path)
+	}
+	return nil
+}
+
+// Command is a Provider that runs a command with "sh -c" and uses what it writes to stdout,
+// without a trailing newline, as the secret.
+type Command struct {
+	// Timeout is how long the command may run. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// Secret implements Provider.Secret().
+func (c Command) Secret(ctx context.Context, cmd string) (string, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	ex := exec.CommandContext(ctx, "sh", "-c", cmd)
+	ex.Stdout = &stdout
+	ex.Stderr = &stderr
+	// Let commands like pass and op prompt on the terminal if they need to.
+	ex.Stdin = os.Stdin
+	if err := ex.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("secret command did not finish: %w", ctx.Err())
+		}
+		return "", fmt.Errorf("secret command failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	s := strings.TrimRight(stdout.String(), "\r\n")
+	if s == "" {
+		return "", fmt.Errorf("secret command had no output")
+	}
+	return s, nil
+}
+
+// KeystoreProvider is a Provider that reads secrets from a Keystore. The Keystore is
+// opened on first use, so the passphrase is only asked for if it is needed.
+type KeystoreProvider struct {
+	// Path is the path to the keystore.
+	Path string
+	// Passphrase returns the passphrase that unlocks the keystore.
+	Passphrase func() (string, error)
+
+	mu sync.Mutex
+	ks *Keystore
+}
+
+// Secret implements Provider.Secret().
+func (k *KeystoreProvider) Secret(ctx context.Context, name string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.ks == nil {
+		if k.Path == "" {
+			return "", fmt.Errorf("keystore secret %q was referenced, but there is no keystore configured", name)
+		}
+		if k.Passphrase == nil {
+			return "", fmt.Errorf("keystore secret %q was referenced, but there is no way to get the passphrase", name)
+		}
+		pass, err := k.Passphrase()
+		if err != nil {
+			return "", fmt.Errorf("could not get the keystore passphrase: %s", err)
+		}
+		k.ks, err = OpenKeystore(k.Path, pass)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s, ok := k.ks.Get(name)
+	if !ok {
+		return "", fmt.Errorf("keystore %s does not have secret %q", k.Path, name)
+	}
+	return s, nil
+}
+
+// Resolver resolves secret references with its Providers.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// Option is an optional argument to NewResolver().
+type Option func(r *Resolver)
+
+// WithProvider has references starting with scheme + ":" resolved by p. This can replace
+// one of the standard Providers.
+func WithProvider(scheme string, p Provider) Option {
+	return func(r *Resolver) {
+		r.providers[scheme] = p
+	}
+}
+
+// NewResolver returns a Resolver that has the Env ("env"), File ("file") and Command ("cmd")
+// Providers. A KeystoreProvider ("keystore") must be added with WithProvider().
+func NewResolver(options ...Option) *Resolver {
+	r := &Resolver{
+		providers: map[string]Provider{
+			"env":  Env{},
+			"file": File{},
+			"cmd":  Command{},
+		},
+	}
+	for _, o := range options {
+		o(r)
+	}
+	return r
+}
+
+// Resolve returns the secret value refers to. If value isn't a reference, it is returned as is.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	if scheme == "plain" {
+		return ref, nil
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		return value, nil
+	}
+	s, err := p.Secret(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve secret %s: %w", redact(value), err)
+	}
+	return s, nil
+}
+
+// redact returns the reference for error messages, without the command line of a "cmd:"
+// reference, which might have a token in it.
+func redact(value string) string {
+	if strings.HasPrefix(value, "cmd:") {
+		return "cmd:..."
+	}
+	return value
+}
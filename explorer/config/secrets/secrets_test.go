@@ -0,0 +1,219 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "private")
+	if err := ioutil.WriteFile(private, []byte("filepass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	public := filepath.Join(dir, "public")
+	if err := ioutil.WriteFile(public, []byte("filepass\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("NETCRAWL_TEST_SECRET", "envpass")
+	defer os.Unsetenv("NETCRAWL_TEST_SECRET")
+
+	ksPath := filepath.Join(dir, "keystore")
+	ks, err := CreateKeystore(ksPath, "passphrase")
+	if err != nil {
+		t.Fatalf("TestResolve: CreateKeystore() had error: %s", err)
+	}
+	ks.Set("admin", "kspass")
+	if err := ks.Save(); err != nil {
+		t.Fatalf("TestResolve: Save() had error: %s", err)
+	}
+
+	asked := 0
+	r := NewResolver(
+		WithProvider(
+			"keystore",
+			&KeystoreProvider{
+				Path: ksPath,
+				Passphrase: func() (string, error) {
+					asked++
+					return "passphrase", nil
+				},
+			},
+		),
+	)
+
+	tests := []struct {
+		desc    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{desc: "Literal", value: "password", want: "password"},
+		{desc: "Literal with unknown scheme", value: "pass:word", want: "pass:word"},
+		{desc: "Plain", value: "plain:env:HOME", want: "env:HOME"},
+		{desc: "Env", value: "env:NETCRAWL_TEST_SECRET", want: "envpass"},
+		{desc: "Env not set", value: "env:NETCRAWL_TEST_NOT_SET", wantErr: true},
+		{desc: "File", value: "file:" + private, want: "filepass"},
+		{desc: "File readable by others", value: "file:" + public, wantErr: true},
+		{desc: "File doesn't exist", value: "file:" + filepath.Join(dir, "none"), wantErr: true},
+		{desc: "Command", value: "cmd:echo cmdpass", want: "cmdpass"},
+		{desc: "Command fails", value: "cmd:exit 1", wantErr: true},
+		{desc: "Command has no output", value: "cmd:true", wantErr: true},
+		{desc: "Keystore", value: "keystore:admin", want: "kspass"},
+		{desc: "Keystore doesn't have secret", value: "keystore:other", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := r.Resolve(context.Background(), test.value)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestResolve(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestResolve(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestResolve(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	if asked != 1 {
+		t.Errorf("TestResolve: the keystore passphrase was asked for %d times, want 1", asked)
+	}
+
+	_, err = NewResolver().Resolve(context.Background(), "keystore:admin")
+	if err != nil {
+		t.Errorf("TestResolve: keystore: without a KeystoreProvider should be a literal, got err == %s", err)
+	}
+	_, err = NewResolver(WithProvider("keystore", &KeystoreProvider{})).Resolve(context.Background(), "keystore:admin")
+	if err == nil {
+		t.Errorf("TestResolve: keystore: without a Path: got err == nil, want err != nil")
+	}
+	_, err = NewResolver().Resolve(context.Background(), "cmd:false --token=token123")
+	if err == nil {
+		t.Fatalf("TestResolve: failed cmd: got err == nil, want err != nil")
+	}
+	if strings.Contains(err.Error(), "token123") {
+		t.Errorf("TestResolve: failed cmd: error had the command line in it: %s", err)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keystore")
+
+	ks, err := CreateKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("TestKeystore: CreateKeystore() had error: %s", err)
+	}
+	ks.Set("b", "bpass")
+	ks.Set("a", "apass")
+	ks.Set("c", "cpass")
+	if !ks.Delete("c") {
+		t.Errorf("TestKeystore: Delete(c): got false, want true")
+	}
+	if ks.Delete("c") {
+		t.Errorf("TestKeystore: Delete(c) again: got true, want false")
+	}
+	if err := ks.Save(); err != nil {
+		t.Fatalf("TestKeystore: Save() had error: %s", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("TestKeystore: keystore had permissions %#o, want 0600", fi.Mode().Perm())
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"apass", "bpass"} {
+		if bytes.Contains(b, []byte(s)) {
+			t.Errorf("TestKeystore: keystore file has %q in plaintext", s)
+		}
+	}
+
+	if _, err := CreateKeystore(path, "passphrase"); err == nil {
+		t.Errorf("TestKeystore: CreateKeystore() over an existing keystore: got err == nil, want err != nil")
+	}
+	if _, err := OpenKeystore(path, "wrong"); err == nil {
+		t.Errorf("TestKeystore: OpenKeystore() with the wrong passphrase: got err == nil, want err != nil")
+	}
+
+	ks, err = OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("TestKeystore: OpenKeystore() had error: %s", err)
+	}
+	if diff := pretty.Compare([]string{"a", "b"}, ks.Names()); diff != "" {
+		t.Errorf("TestKeystore: Names(): -want/+got:\n%s", diff)
+	}
+	if s, ok := ks.Get("a"); !ok || s != "apass" {
+		t.Errorf("TestKeystore: Get(a): got %q, %v, want %q, true", s, ok, "apass")
+	}
+
+	good, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := []struct {
+		desc   string
+		change func(f map[string]interface{})
+	}{
+		{desc: "huge N", change: func(f map[string]interface{}) { f["N"] = 1 << 40 }},
+		{desc: "huge r", change: func(f map[string]interface{}) { f["R"] = 1 << 20 }},
+		{desc: "huge p", change: func(f map[string]interface{}) { f["P"] = 1 << 20 }},
+		{desc: "too much memory", change: func(f map[string]interface{}) { f["N"], f["R"] = 1<<20, 32 }},
+		// Without the header authenticated, this would open the keystore.
+		{desc: "version downgrade", change: func(f map[string]interface{}) { f["Version"] = 1 }},
+	}
+	for _, test := range tampered {
+		f := map[string]interface{}{}
+		if err := json.Unmarshal(good, &f); err != nil {
+			t.Fatal(err)
+		}
+		test.change(f)
+		b, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenKeystore(path, "passphrase"); err == nil {
+			t.Errorf("TestKeystore(%s): OpenKeystore(): got err == nil, want err != nil", test.desc)
+		}
+	}
+	if err := ioutil.WriteFile(path, good, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenKeystore(path, "passphrase"); err == nil {
+		t.Errorf("TestKeystore: OpenKeystore() readable by others: got err == nil, want err != nil")
+	}
+}
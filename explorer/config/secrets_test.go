@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/johnsiilver/netcrawl/explorer/config/secrets"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ksPath := filepath.Join(dir, "keystore")
+	ks, err := secrets.CreateKeystore(ksPath, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("enable", "enablepass")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("NETCRAWL_TEST_PASS", "sshpass")
+	defer os.Unsetenv("NETCRAWL_TEST_PASS")
+
+	c := Config{
+		SSHConn: []SSH{
+			{
+				User:         "admin",
+				Pass:         "env:NETCRAWL_TEST_PASS",
+				EnableSecret: "keystore:enable",
+				ProxyJump:    []JumpHost{{Addr: "bastion:22", Pass: "cmd:echo jumppass"}},
+				Overrides: []SSHOverride{
+					{Prefixes: []string{"10.0.0.0/8"}, ProxyJump: []JumpHost{{Addr: "other:22", KeyPassphrase: "plain:env:x"}}},
+				},
+			},
+		},
+		SNMPConn: []SNMP{{Version: "2c", Community: "public"}},
+		Proxies:  []Proxy{{Type: ProxySOCKS5, Addr: "proxy:1080", Pass: "cmd:echo proxypass"}},
+		Secrets:  Secrets{Keystore: ksPath},
+	}
+
+	passphrase := func() (string, error) { return "passphrase", nil }
+	got, err := c.ResolveSecrets(context.Background(), passphrase)
+	if err != nil {
+		t.Fatalf("TestResolveSecrets: had error: %s", err)
+	}
+
+	want := Config{
+		SSHConn: []SSH{
+			{
+				User:         "admin",
+				Pass:         "sshpass",
+				EnableSecret: "enablepass",
+				ProxyJump:    []JumpHost{{Addr: "bastion:22", Pass: "jumppass"}},
+				Overrides: []SSHOverride{
+					{Prefixes: []string{"10.0.0.0/8"}, ProxyJump: []JumpHost{{Addr: "other:22", KeyPassphrase: "env:x"}}},
+				},
+			},
+		},
+		SNMPConn: []SNMP{{Version: "2c", Community: "public"}},
+		Proxies:  []Proxy{{Type: ProxySOCKS5, Addr: "proxy:1080", Pass: "proxypass"}},
+		Secrets:  Secrets{Keystore: ksPath},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestResolveSecrets: -want/+got:\n%s", diff)
+	}
+	if c.SSHConn[0].Pass != "env:NETCRAWL_TEST_PASS" || c.SSHConn[0].Overrides[0].ProxyJump[0].KeyPassphrase != "plain:env:x" {
+		t.Errorf("TestResolveSecrets: the original Config was changed")
+	}
+
+	c.SNMPConn[0].AuthPass = "env:NETCRAWL_TEST_NOT_SET"
+	_, err = c.ResolveSecrets(context.Background(), passphrase)
+	if err == nil {
+		t.Fatalf("TestResolveSecrets(bad reference): got err == nil, want err != nil")
+	}
+	if !strings.Contains(err.Error(), "SNMPConn[0].AuthPass") {
+		t.Errorf("TestResolveSecrets(bad reference): error %q did not name the field", err)
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/explorer/sweep"
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// Sweep configures a sweep of management prefixes for devices that answer on SSH, telnet or
+// SNMP. Devices found are crawled from as extra seeds, which finds devices that no neighbor
+// advertises with CDP or LLDP. See package sweep.
+type Sweep struct {
+	// Prefixes are the CIDR prefixes to sweep. If empty, there is no sweep.
+	Prefixes []string
+	// Concurrency is the maximum number of probes in flight. Defaults to 64.
+	Concurrency int
+	// Timeout is how long a probe waits for an answer. Defaults to 1 second.
+	Timeout Duration
+	// MaxHosts is the most addresses a sweep may probe. Defaults to 65536.
+	MaxHosts int
+}
+
+// Sweeper returns a sweep.Sweeper set up by c.Sweep. The SNMP probe uses the SNMPConn
+// configs, or the v2c community "public" if there are none. The SSH and telnet probes of a
+// host use the ports of the SSHConn configs and Overrides that cover it, see sweepPorts.
+func (c Config) Sweeper() (*sweep.Sweeper, error) {
+	ports, err := c.sweepPorts()
+	if err != nil {
+		return nil, err
+	}
+	s := &sweep.Sweeper{
+		Concurrency: c.Sweep.Concurrency,
+		Timeout:     time.Duration(c.Sweep.Timeout),
+		MaxHosts:    c.Sweep.MaxHosts,
+		Ports:       ports,
+	}
+	for _, snmpConf := range c.SNMPConn {
+		g, err := snmpConf.goSNMP()
+		if err != nil {
+			return nil, err
+		}
+		s.SNMP = append(s.SNMP, g)
+	}
+	return s, nil
+}
+
+// sshPorts are the ports an SSH config logs into devices on.
+type sshPorts struct {
+	scope     sshScope
+	port      int
+	overrides []portsOverride
+}
+
+type portsOverride struct {
+	nets []*net.IPNet
+	port int
+	// telnet is the telnet port, or 0 if telnet isn't allowed.
+	telnet int
+}
+
+// forIP returns the SSH and telnet ports p uses for ip. telnet is 0 if p doesn't allow it.
+func (p sshPorts) forIP(ip net.IP) (ssh, telnet int) {
+	for _, o := range p.overrides {
+		for _, n := range o.nets {
+			if n.Contains(ip) {
+				return o.port, o.telnet
+			}
+		}
+	}
+	return p.port, 0
+}
+
+// sweepPorts returns a sweep.Sweeper.Ports that gives the SSH ports of the SSHConn configs
+// whose scope covers a host, and the telnet ports of their Overrides that allow telnet.
+// Where no config covers a host, the default ports of 22 and 23 are probed.
+func (c Config) sweepPorts() (func(ip net.IP) (ssh, telnet []int), error) {
+	sites, err := c.sites()
+	if err != nil {
+		return nil, err
+	}
+
+	var confs []sshPorts
+	for i, s := range c.SSHConn {
+		sc, err := s.scope(sites)
+		if err != nil {
+			return nil, fmt.Errorf("SSHConn[%d]: %s", i, err)
+		}
+		p := sshPorts{scope: sc, port: sweep.PortOr(s.Port, sweep.DefaultSSHPort)}
+		for j, o := range s.Overrides {
+			po := portsOverride{port: sweep.PortOr(o.Port, p.port)}
+			for _, prefix := range o.Prefixes {
+				_, n, err := net.ParseCIDR(prefix)
+				if err != nil {
+					return nil, fmt.Errorf("SSHConn[%d] Overrides[%d] has bad prefix %q: %s", i, j, prefix, err)
+				}
+				po.nets = append(po.nets, n)
+			}
+			if o.Telnet {
+				po.telnet = sweep.PortOr(o.TelnetPort, sweep.DefaultTelnetPort)
+			}
+			p.overrides = append(p.overrides, po)
+		}
+		confs = append(confs, p)
+	}
+
+	return func(ip net.IP) (ssh, telnet []int) {
+		node := &network.Node{IP: ip}
+		for _, p := range confs {
+			if !p.scope.applies(node) {
+				continue
+			}
+			s, t := p.forIP(ip)
+			ssh = addPort(ssh, s)
+			if t != 0 {
+				telnet = addPort(telnet, t)
+			}
+		}
+		if len(ssh) == 0 {
+			ssh = []int{sweep.DefaultSSHPort}
+		}
+		if len(telnet) == 0 {
+			telnet = []int{sweep.DefaultTelnetPort}
+		}
+		return ssh, telnet
+	}, nil
+}
+
+// addPort adds port to ports if it isn't there already.
+func addPort(ports []int, port int) []int {
+	for _, p := range ports {
+		if p == port {
+			return ports
+		}
+	}
+	return append(ports, port)
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestSweeperPorts(t *testing.T) {
+	c := Config{
+		Sites: []Site{{Name: "nyc", Prefixes: []string{"10.1.0.0/16"}}},
+		SSHConn: []SSH{
+			{
+				Prefixes: []string{"10.0.0.0/16"},
+				Port:     2222,
+				Overrides: []SSHOverride{
+					{Prefixes: []string{"10.0.1.0/24"}, Port: 2200, Telnet: true},
+					{Prefixes: []string{"10.0.2.0/24"}, Telnet: true, TelnetPort: 2323},
+				},
+			},
+			{Sites: []string{"nyc"}, Overrides: []SSHOverride{{Prefixes: []string{"10.1.1.0/24"}, Port: 22}}},
+			{Prefixes: []string{"10.0.0.0/8"}},
+		},
+	}
+
+	s, err := c.Sweeper()
+	if err != nil {
+		t.Fatalf("TestSweeperPorts: Sweeper() had error: %s", err)
+	}
+
+	tests := []struct {
+		desc       string
+		ip         string
+		wantSSH    []int
+		wantTelnet []int
+	}{
+		{desc: "Config's port", ip: "10.0.0.1", wantSSH: []int{2222, 22}, wantTelnet: []int{23}},
+		{desc: "Override's port and telnet", ip: "10.0.1.1", wantSSH: []int{2200, 22}, wantTelnet: []int{23}},
+		{desc: "Override's telnet port", ip: "10.0.2.1", wantSSH: []int{2222, 22}, wantTelnet: []int{2323}},
+		{desc: "Site", ip: "10.1.0.1", wantSSH: []int{22}, wantTelnet: []int{23}},
+		{desc: "Out of every scope", ip: "192.168.0.1", wantSSH: []int{22}, wantTelnet: []int{23}},
+	}
+
+	for _, test := range tests {
+		ssh, telnet := s.Ports(net.ParseIP(test.ip))
+		if diff := pretty.Compare(test.wantSSH, ssh); diff != "" {
+			t.Errorf("TestSweeperPorts(%s): ssh -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantTelnet, telnet); diff != "" {
+			t.Errorf("TestSweeperPorts(%s): telnet -want/+got:\n%s", test.desc, diff)
+		}
+	}
+
+	c.SSHConn = []SSH{{Sites: []string{"sfo"}}}
+	if _, err := c.Sweeper(); err == nil {
+		t.Errorf("TestSweeperPorts(unknown site): got err == nil, want err != nil")
+	}
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Error is a problem with a field of a config. File and Line are set when the config
+// was read with Load() and the field could be found in a file.
+type Error struct {
+	// File is the config file the field is in.
+	File string
+	// Line is the line in File that the field is on.
+	Line int
+	// Field is the path to the field, such as "SSHConn[0].Overrides[1].Port".
+	// It is empty for problems with the config as a whole.
+	Field string
+	// Err is the problem.
+	Err error
+}
+
+// Error implements error.Error().
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d", e.Line)
+		}
+		b.WriteString(": ")
+	}
+	if e.Field != "" {
+		b.WriteString(e.Field)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+// Unwrap returns Err.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors are all the problems found with a config, one per line.
+type Errors []*Error
+
+// Error implements error.Error().
+func (e Errors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+// validator collects the problems with a config.
+type validator struct {
+	errs Errors
+}
+
+func (v *validator) add(field string, format string, a ...interface{}) {
+	v.errs = append(v.errs, &Error{Field: field, Err: fmt.Errorf(format, a...)})
+}
+
+func (v *validator) cidrs(field string, cidrs []string) {
+	for i, c := range cidrs {
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			v.add(fmt.Sprintf("%s[%d]", field, i), "%q is not a CIDR prefix", c)
+		}
+	}
+}
+
+func (v *validator) regexps(field string, res []string) {
+	for i, re := range res {
+		if _, err := regexp.Compile(re); err != nil {
+			v.add(fmt.Sprintf("%s[%d]", field, i), "bad regexp: %s", err)
+		}
+	}
+}
+
+func (v *validator) port(field string, port int) {
+	if err := checkPort(port); err != nil {
+		v.add(field, "%d is not a valid port", port)
+	}
+}
+
+func (v *validator) session(field string, s string) {
+	if _, err := sessionMode(s); err != nil {
+		v.add(field, "must be %q, %q or %q, was %q", SessionExec, SessionShell, SessionAuto, s)
+	}
+}
+
+func (v *validator) jumps(field string, hops []JumpHost) {
+	for i, h := range hops {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		if h.Addr == "" {
+			v.add(f+".Addr", "must be set")
+		}
+		if h.Pass == "" && h.KeyFile == "" && !h.Agent {
+			v.add(f, "has no authentication, set Pass, KeyFile or Agent")
+		}
+		if h.CertFile != "" && h.KeyFile == "" {
+			v.add(f+".CertFile", "requires a KeyFile")
+		}
+	}
+}
+
+func (v *validator) nonNegative(field string, n float64) {
+	if n < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+// Validate checks c for problems that would stop a crawl, such as bad prefixes, ports,
+// regexps or modes. It returns Errors, or nil if c is valid. It doesn't read any of the
+// files that c refers to or resolve secrets.
+func (c Config) Validate() error {
+	v := &validator{}
+
+	if len(c.SSHConn) == 0 && len(c.SNMPConn) == 0 {
+		v.add("", "must have at least one SSHConn or SNMPConn")
+	}
+	if _, err := c.PreferIPv6(); err != nil {
+		v.add("PreferFamily", "must be %q or %q, was %q", FamilyIPv4, FamilyIPv6, c.PreferFamily)
+	}
+
+	switch c.HostKeys.Mode {
+	case "", HostKeyStrict, HostKeyTOFU, HostKeyInsecure:
+	default:
+		v.add("HostKeys.Mode", "must be %q, %q or %q, was %q", HostKeyStrict, HostKeyTOFU, HostKeyInsecure, c.HostKeys.Mode)
+	}
+
+	v.nonNegative("Limits.Workers", float64(c.Limits.Workers))
+	v.nonNegative("Limits.LoginsPerSecond", c.Limits.LoginsPerSecond)
+	v.nonNegative("Limits.SubnetConcurrency", float64(c.Limits.SubnetConcurrency))
+	if c.Limits.SubnetBits < 0 || c.Limits.SubnetBits > 32 {
+		v.add("Limits.SubnetBits", "must be between 0 and 32, was %d", c.Limits.SubnetBits)
+	}
+	if c.Limits.SubnetBitsV6 < 0 || c.Limits.SubnetBitsV6 > 128 {
+		v.add("Limits.SubnetBitsV6", "must be between 0 and 128, was %d", c.Limits.SubnetBitsV6)
+	}
+	v.nonNegative("Timeouts.Dial", float64(c.Timeouts.Dial))
+	v.nonNegative("Timeouts.Command", float64(c.Timeouts.Command))
+	v.nonNegative("Timeouts.Crawl", float64(c.Timeouts.Crawl))
+	v.nonNegative("Secrets.CommandTimeout", float64(c.Secrets.CommandTimeout))
+	v.cidrs("Sweep.Prefixes", c.Sweep.Prefixes)
+	v.nonNegative("Sweep.Concurrency", float64(c.Sweep.Concurrency))
+	v.nonNegative("Sweep.Timeout", float64(c.Sweep.Timeout))
+	v.nonNegative("Sweep.MaxHosts", float64(c.Sweep.MaxHosts))
+
+	v.cidrs("Scope.Include", c.Scope.Include)
+	v.cidrs("Scope.Exclude", c.Scope.Exclude)
+	v.regexps("Scope.SkipPlatforms", c.Scope.SkipPlatforms)
+	v.nonNegative("Scope.MaxDepth", float64(c.Scope.MaxDepth))
+
+	sites := map[string]bool{}
+	for i, s := range c.Sites {
+		f := fmt.Sprintf("Sites[%d]", i)
+		switch {
+		case s.Name == "":
+			v.add(f+".Name", "must be set")
+		case sites[s.Name]:
+			v.add(f+".Name", "%q is the Name of another site", s.Name)
+		}
+		sites[s.Name] = true
+		if len(s.Prefixes) == 0 {
+			v.add(f+".Prefixes", "must have at least one prefix")
+		}
+		v.cidrs(f+".Prefixes", s.Prefixes)
+	}
+
+	for i, s := range c.SSHConn {
+		f := fmt.Sprintf("SSHConn[%d]", i)
+		if s.User == "" {
+			v.add(f+".User", "must be set")
+		}
+		if s.Pass == "" && s.KeyFile == "" && !s.Agent {
+			v.add(f, "has no authentication, set Pass, KeyFile or Agent")
+		}
+		if s.CertFile != "" && s.KeyFile == "" {
+			v.add(f+".CertFile", "requires a KeyFile")
+		}
+		v.port(f+".Port", s.Port)
+		v.session(f+".Session", s.Session)
+		v.jumps(f+".ProxyJump", s.ProxyJump)
+		v.cidrs(f+".Prefixes", s.Prefixes)
+		v.regexps(f+".Platforms", s.Platforms)
+		for x, name := range s.Sites {
+			if !sites[name] {
+				v.add(fmt.Sprintf("%s.Sites[%d]", f, x), "%q is not one of the config's Sites", name)
+			}
+		}
+
+		for x, o := range s.Overrides {
+			of := fmt.Sprintf("%s.Overrides[%d]", f, x)
+			if len(o.Prefixes) == 0 {
+				v.add(of+".Prefixes", "must have at least one prefix")
+			}
+			v.cidrs(of+".Prefixes", o.Prefixes)
+			v.port(of+".Port", o.Port)
+			v.port(of+".TelnetPort", o.TelnetPort)
+			if o.Session != "" {
+				v.session(of+".Session", o.Session)
+			}
+			v.jumps(of+".ProxyJump", o.ProxyJump)
+		}
+	}
+
+	for i, s := range c.SNMPConn {
+		if _, err := s.goSNMP(); err != nil {
+			v.add(fmt.Sprintf("SNMPConn[%d]", i), "%s", err)
+		}
+	}
+
+	for i, p := range c.Proxies {
+		f := fmt.Sprintf("Proxies[%d]", i)
+		if len(p.Prefixes) == 0 {
+			v.add(f+".Prefixes", "must have at least one prefix")
+		}
+		v.cidrs(f+".Prefixes", p.Prefixes)
+		switch strings.ToLower(p.Type) {
+		case ProxySOCKS5, ProxyHTTP:
+		default:
+			v.add(f+".Type", "must be %q or %q, was %q", ProxySOCKS5, ProxyHTTP, p.Type)
+		}
+		if _, _, err := net.SplitHostPort(p.Addr); err != nil {
+			v.add(f+".Addr", "%q must be host:port", p.Addr)
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
@@ -27,12 +27,17 @@ package explorer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/johnsiilver/netcrawl/explorer/config"
+	"github.com/johnsiilver/netcrawl/explorer/internal/hostkey"
 	"github.com/johnsiilver/netcrawl/network"
+	"github.com/johnsiilver/netcrawl/network/traverse"
 )
 
 // LoginDeny is used to log nodes we could not connect to.
@@ -44,40 +49,85 @@ type LoginDeny struct {
 }
 
 type Results struct {
-	NetworkMap  *network.Node
+	// NetworkMap is the root node of the crawl. If it had several seeds, it is the first.
+	NetworkMap *network.Node
+	// Seeds are the root nodes of each seed of the crawl, in the order they were given.
+	// Each node's Seed says which of them it was first reached from.
+	Seeds []*network.Node
+	// Graph holds the nodes of NetworkMap and the links between them with both endpoints.
+	Graph       *network.Graph
 	LoginDeny   []LoginDeny
 	ParseErrors []error
+	// HostKeyErrors are nodes whose SSH host key could not be verified. These nodes were not logged into.
+	HostKeyErrors []LoginDeny
+	// Incomplete indicates the crawl was stopped by the crawl deadline or Context before the whole
+	// network was explored. Nodes that were not explored have their Error set.
+	Incomplete bool
 }
 
 // Network is used to explorer the network
 type Network struct {
-	root   *network.Node
+	seeds  []*network.Node
 	config config.Config
 
 	discNodes []config.Discover
+	limiter   *limiter
+	scope     *scope
+	preferV6  bool
 
-	error      error
-	loginDeny  []LoginDeny
-	parseError []error
-	seen       map[string]*network.Node // keys are net.IP.String()
+	error        error
+	loginDeny    []LoginDeny
+	parseError   []error
+	hostKeyError []LoginDeny
+	seen         *identities
+	visits       map[*network.Node]*visit
 
 	mu sync.Mutex
 	wg sync.WaitGroup
 }
 
-const typeRoot = "RootNode"
+const typeRoot = config.RootType
 
 // New is the constructor for Network.
 func New(root string, conf config.Config) (*Network, error) {
-	ip := net.ParseIP(root)
-	if ip == nil {
-		ips, err := net.LookupIP(root)
-		if err != nil {
-			return nil, fmt.Errorf("root node %s was not an IP and could not be found in DNS", root)
+	return NewSeeds([]string{root}, conf)
+}
+
+// NewSeeds is the constructor for a Network that is crawled from several seed devices at
+// once, for networks with parts that aren't neighbors of each other. The parts are merged
+// into one graph. Seeds with the same address are only crawled once.
+func NewSeeds(seeds []string, conf config.Config) (*Network, error) {
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("explorer.NewSeeds() must be passed at least one seed")
+	}
+	preferV6, err := conf.PreferIPv6()
+	if err != nil {
+		return nil, err
+	}
+
+	var seedNodes []*network.Node
+	seen := map[string]bool{}
+	for _, seed := range seeds {
+		ips := []net.IP{net.ParseIP(seed)}
+		if ips[0] == nil {
+			ips, err = net.LookupIP(seed)
+			if err != nil {
+				if len(seeds) > 1 {
+					return nil, fmt.Errorf("seed %s was not an IP and could not be found in DNS", seed)
+				}
+				return nil, fmt.Errorf("root node %s was not an IP and could not be found in DNS", seed)
+			}
+		}
+		n := &network.Node{IP: network.PreferredIP(ips, preferV6), IPs: ips, Type: typeRoot, Seed: seed}
+		if seen[n.IP.String()] {
+			continue
 		}
-		ip = ips[0]
+		seen[n.IP.String()] = true
+		seedNodes = append(seedNodes, n)
+	}
+	if len(seedNodes) == 1 {
+		seedNodes[0].Seed = ""
 	}
-	rootNode := &network.Node{IP: ip, Type: typeRoot}
 
 	disc, err := conf.Discoveries()
 	if err != nil {
@@ -88,109 +138,275 @@ func New(root string, conf config.Config) (*Network, error) {
 		return nil, fmt.Errorf("the configuration passed to explorer.New() did not have any network discovery methods configured")
 	}
 
+	scope, err := newScope(conf.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	visits := map[*network.Node]*visit{}
+	for _, n := range seedNodes {
+		visits[n] = &visit{}
+	}
+
 	return &Network{
-		root:      rootNode,
+		seeds:     seedNodes,
 		discNodes: disc,
+		limiter:   newLimiter(conf.Limits),
+		scope:     scope,
 		config:    conf,
-		seen:      map[string]*network.Node{ip.String(): rootNode},
+		preferV6:  preferV6,
+		seen:      newIdentities(seedNodes...),
+		visits:    visits,
 	}, nil
 }
 
+// Explore crawls the network starting at the seed nodes. If the configured crawl deadline is
+// reached, the part of the network explored so far is returned with Results.Incomplete set.
+// If ctx is cancelled, the same is returned along with ctx.Err().
 func (e *Network) Explore(ctx context.Context) (Results, error) {
-	e.wg.Add(1)
-	e.processNode(ctx, e.root, nil, "")
+	crawlCtx := ctx
+	if e.config.Timeouts.Crawl > 0 {
+		var cancel context.CancelFunc
+		crawlCtx, cancel = context.WithTimeout(ctx, time.Duration(e.config.Timeouts.Crawl))
+		defer cancel()
+	}
+
+	for _, seed := range e.seeds {
+		e.wg.Add(1)
+		go e.processNode(crawlCtx, seed, nil, "")
+	}
 
 	e.wg.Wait()
 
 	if e.error != nil {
 		return Results{}, e.error
 	}
+	if err := e.seedsFailed(); err != nil {
+		return Results{}, err
+	}
 
 	return Results{
-		NetworkMap:  e.root,
-		LoginDeny:   e.loginDeny,
-		ParseErrors: e.parseError,
-	}, nil
+		NetworkMap:    e.seeds[0],
+		Seeds:         e.seeds,
+		Graph:         network.NewGraph(e.seeds...),
+		LoginDeny:     e.loginDeny,
+		ParseErrors:   e.parseError,
+		HostKeyErrors: e.hostKeyError,
+		Incomplete:    crawlCtx.Err() != nil,
+	}, ctx.Err()
+}
+
+// seedsFailed returns an error if none of several seeds could be discovered.
+func (e *Network) seedsFailed() error {
+	for _, seed := range e.seeds {
+		if seed.Error == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("could not connect to any seed node, first error: %s", e.seeds[0].Error)
 }
 
-func (e *Network) seenNode(n *network.Node) *network.Node {
+// Close releases resources held by the discovery methods, such as connections to SSH jump
+// hosts. The Network should not be used after.
+func (e *Network) Close() error {
+	var err error
+	for _, d := range e.discNodes {
+		if c, ok := d.(io.Closer); ok {
+			if cErr := c.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+	}
+	return err
+}
+
+// visit is what the crawl knows about a node it has found.
+type visit struct {
+	// depth is the fewest hops from the root the node has been found at.
+	depth int
+	// tooDeep is set if the node is out of scope only because of its depth, so that a shorter
+	// path to it can still explore it.
+	tooDeep bool
+	// walked is set once the node's children have been walked.
+	walked bool
+}
+
+// Actions for a node found by walkChildren.
+const (
+	// skipNode means the node is not explored.
+	skipNode = iota
+	// exploreNode means the node must be discovered and its children walked.
+	exploreNode
+	// rewalkNode means the node was reached by a shorter path after its children were
+	// walked, so they must be walked again at their new depth.
+	rewalkNode
+)
+
+// visitNode records that n, a neighbor of parent, was found depth hops from the root and
+// returns the node we have for that device and what to do with it. Scope is decided before
+// n is registered, and a node that was too deep is re-opened if a shorter path to it is found.
+func (e *Network) visitNode(n, parent *network.Node, depth int) (*network.Node, int) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	seen := e.seen[n.IP.String()]
-	if seen == nil {
-		e.seen[n.IP.String()] = n
-		return nil
+	// n is already ours when parent is walked again.
+	seen := n
+	if e.visits[n] == nil {
+		// Neighbors can advertise several addresses, connect with the family we prefer.
+		n.IP = network.PreferredIP(n.AllIPs(), e.preferV6)
+		n.Seed = parent.Seed
+
+		reason := e.scope.excluded(n)
+		tooDeep := reason == "" && e.scope.tooDeep(depth)
+		if tooDeep {
+			reason = e.scope.depthReason()
+		}
+
+		seen = e.seen.resolve(n)
+		if seen == nil {
+			e.visits[n] = &visit{depth: depth, tooDeep: tooDeep}
+			if reason != "" {
+				n.OutOfScope = reason
+				return n, skipNode
+			}
+			return n, exploreNode
+		}
 	}
-	return seen
+
+	v := e.visits[seen]
+	if v == nil || depth >= v.depth {
+		return seen, skipNode
+	}
+	v.depth = depth
+	switch {
+	case v.tooDeep:
+		if e.scope.tooDeep(depth) {
+			return seen, skipNode
+		}
+		v.tooDeep = false
+		seen.OutOfScope = ""
+		return seen, exploreNode
+	case v.walked:
+		return seen, rewalkNode
+	}
+	// If it is still being discovered, its children are walked at the new depth.
+	return seen, skipNode
 }
 
+// processNode discovers node and then walks its children.
 func (e *Network) processNode(ctx context.Context, node, parent *network.Node, inter network.NodeInterface) {
 	defer e.wg.Done()
 
+	release, err := e.limiter.acquire(ctx, node.IP)
+	if err != nil {
+		e.failNode(ctx, node, parent, err)
+		return
+	}
+	err = e.discover(ctx, node)
+	release()
+
+	if err != nil {
+		e.failNode(ctx, node, parent, err)
+		return
+	}
+
+	if parent != nil {
+		parent.SetNeighbor(inter, node)
+	}
+
+	e.wg.Add(1)
+	go e.walkChildren(ctx, node)
+}
+
+// discover runs our discovery methods against node until one succeeds. If none do, the
+// errors from all of them are returned.
+func (e *Network) discover(ctx context.Context, node *network.Node) error {
 	var err error
-	var found bool
 	for _, disc := range e.discNodes {
 		inErr := disc.Node(ctx, node)
 		if inErr == nil {
-			found = true
-			break
+			return nil
+		}
+
+		var hkErr *hostkey.Error
+		if errors.As(inErr, &hkErr) {
+			e.mu.Lock()
+			e.hostKeyError = append(e.hostKeyError, LoginDeny{node.IP, inErr})
+			e.mu.Unlock()
 		}
-		err = fmt.Errorf("%s %w", inErr, err)
-	}
 
-	if !found {
-		if parent == nil {
-			e.error = fmt.Errorf("could not connect to root node: %s", err)
-			return
+		if err == nil {
+			err = inErr
+		} else {
+			err = fmt.Errorf("%s %w", inErr, err)
 		}
-		e.loginDeny = append(e.loginDeny, LoginDeny{node.IP, err})
+	}
+
+	return err
+}
+
+// failNode records that we could not discover node.
+func (e *Network) failNode(ctx context.Context, node, parent *network.Node, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if parent == nil && len(e.seeds) == 1 {
+		e.error = fmt.Errorf("could not connect to root node: %s", err)
 		return
 	}
 
-	if parent != nil {
-		parent.SetNeighbor(inter, node)
+	// We ran out of time, this isn't the node's fault.
+	if ctx.Err() != nil {
+		node.Error = fmt.Errorf("crawl stopped before node was explored: %w", ctx.Err())
+		return
 	}
 
-	e.wg.Add(1)
-	go e.walkChildren(ctx, node, inter)
+	node.Error = err
+	e.loginDeny = append(e.loginDeny, LoginDeny{node.IP, err})
 }
 
-func (e *Network) walkChildren(ctx context.Context, parent *network.Node, inter network.NodeInterface) {
+// walkChildren explores the neighbors of parent that we haven't seen before.
+func (e *Network) walkChildren(ctx context.Context, parent *network.Node) {
 	defer e.wg.Done()
 
-	for inter, child := range parent.Neighbors {
-		if seen := e.seenNode(child); seen != nil {
+	e.mu.Lock()
+	v := e.visits[parent]
+	v.walked = true
+	depth := v.depth
+	e.mu.Unlock()
+
+	for inter, child := range parent.CopyNeighbors() {
+		node, action := e.visitNode(child, parent, depth+1)
+		if node != child {
 			// The node information here will be incomplete (missing Neighbors).
 			// This completes it.
-			parent.SetNeighbor(inter, seen)
+			parent.SetNeighbor(inter, node)
+		}
+
+		switch action {
+		case skipNode:
+			continue
+		case rewalkNode:
+			e.wg.Add(1)
+			go e.walkChildren(ctx, node)
+			continue
+		}
+		if ctx.Err() != nil {
+			node.Error = fmt.Errorf("crawl stopped before node was explored: %w", ctx.Err())
 			continue
 		}
 
 		e.wg.Add(1)
-		go e.processNode(ctx, child, parent, inter)
+		go e.processNode(ctx, node, parent, inter)
 	}
 }
 
 // List provides a method for walking the network.Node tree and returning a list of all Nodes
 // without falling into a recursive loop.
-type List struct {
-	seen map[string]bool
-	list []*network.Node
-}
+type List struct{}
 
-// List turns the tree into a slice.
+// List turns the tree into a slice sorted by IP. For more control over the walk, see the
+// network/traverse package.
 func (l *List) List(n *network.Node) []*network.Node {
-	l.seen = map[string]bool{}
-	l.list = []*network.Node{}
-	l.walk(n)
-	return l.list
-}
-
-func (l *List) walk(n *network.Node) {
-	if l.seen[n.IP.String()] {
-		return
-	}
-	l.seen[n.IP.String()] = true
-	l.list = append(l.list, n)
+	return traverse.Sorted(n)
 }
@@ -0,0 +1,105 @@
+package explorer
+
+import (
+	"net"
+	"strings"
+
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// identities tracks the nodes we have seen so that a device is only explored once, even if
+// it is reached under different addresses. Nodes are identified by serial number, LLDP
+// chassis ID or CDP Device ID when they are known and by IP when they are not. All methods
+// must be called with Network.mu held.
+type identities struct {
+	byKey map[string]*network.Node
+	byIP  map[string]*network.Node
+}
+
+func newIdentities(roots ...*network.Node) *identities {
+	ids := &identities{byKey: map[string]*network.Node{}, byIP: map[string]*network.Node{}}
+	for _, r := range roots {
+		ids.add(r)
+	}
+	return ids
+}
+
+// resolve returns the node we already have for the device n describes, after merging what
+// n knows into it. If n is a device we haven't seen, it is recorded and nil is returned.
+func (i *identities) resolve(n *network.Node) *network.Node {
+	for _, k := range identityKeys(n) {
+		if seen := i.byKey[k]; seen != nil {
+			seen.Merge(n)
+			i.add(seen)
+			return seen
+		}
+	}
+
+	// Without a matching identity, the same address is the same device unless both sides
+	// say who they are and disagree. That happens when devices share an address behind NAT.
+	for _, ip := range n.AllIPs() {
+		if seen := i.byIP[ip.String()]; seen != nil && !conflicts(seen, n) {
+			seen.Merge(n)
+			i.add(seen)
+			return seen
+		}
+	}
+
+	i.add(n)
+	return nil
+}
+
+// add indexes n by its identity keys and addresses. Existing entries are kept.
+func (i *identities) add(n *network.Node) {
+	for _, k := range identityKeys(n) {
+		if i.byKey[k] == nil {
+			i.byKey[k] = n
+		}
+	}
+	for _, ip := range n.AllIPs() {
+		if i.byIP[ip.String()] == nil {
+			i.byIP[ip.String()] = n
+		}
+	}
+}
+
+// identityKeys returns the keys that identify n, most specific first.
+func identityKeys(n *network.Node) []string {
+	var keys []string
+	if n.Serial != "" {
+		keys = append(keys, "serial:"+strings.ToUpper(n.Serial))
+	}
+	if n.ChassisID != "" {
+		keys = append(keys, "chassis:"+normalChassis(n.ChassisID))
+	}
+	if n.DeviceID != "" {
+		keys = append(keys, "device:"+strings.ToLower(n.DeviceID))
+	}
+	return keys
+}
+
+// conflicts reports if a and b both have an identity of the same kind and they differ.
+func conflicts(a, b *network.Node) bool {
+	kinds := map[string]string{}
+	for _, k := range identityKeys(a) {
+		kind := strings.SplitN(k, ":", 2)[0]
+		kinds[kind] = k
+	}
+	for _, k := range identityKeys(b) {
+		kind := strings.SplitN(k, ":", 2)[0]
+		if other, ok := kinds[kind]; ok && other != k {
+			return true
+		}
+	}
+	return false
+}
+
+// normalChassis puts MAC address chassis IDs in one format, as CLI output and SNMP format
+// them differently.
+func normalChassis(id string) string {
+	// ProCurve separates the octets with spaces.
+	if mac, err := net.ParseMAC(strings.ReplaceAll(id, " ", ":")); err == nil {
+		return mac.String()
+	}
+	return strings.ToLower(id)
+}
@@ -0,0 +1,207 @@
+package cdp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Jump is an SSH jump host (ProxyJump hop) that device connections are tunneled through.
+type Jump struct {
+	// Addr is the host:port of the jump host.
+	Addr string
+	// Config is used to login to the jump host.
+	Config *ssh.ClientConfig
+	// HostKeyAlgorithms, if set, restricts the host key algorithms accepted from the jump host.
+	HostKeyAlgorithms HostKeyAlgorithms
+}
+
+// Bastion tunnels connections through a chain of jump hosts. The connection to the jump
+// hosts is made on first use and shared by every connection after, so a whole crawl only
+// logs into the jump hosts once. If the connection drops, the next use reconnects. If it
+// can't be made, uses fail with the same error until a backoff has passed, so a bad jump
+// host login isn't retried for every device.
+// A Bastion is safe for concurrent use.
+type Bastion struct {
+	hops []Jump
+
+	mu sync.Mutex
+	// clients are the connections to each hop, the last one is used for tunneling.
+	clients []*ssh.Client
+	closed  bool
+	// dialing is closed when the connection being made is done. nil if none is.
+	dialing chan struct{}
+	// err is the last error connecting, which is returned until retryAt.
+	err     error
+	retryAt time.Time
+	backoff time.Duration
+}
+
+// Backoff for retrying a Bastion that could not connect.
+const (
+	bastionMinBackoff = time.Second
+	bastionMaxBackoff = time.Minute
+)
+
+// NewBastion returns a Bastion that connects through hops in order.
+func NewBastion(hops ...Jump) (*Bastion, error) {
+	if len(hops) == 0 {
+		return nil, fmt.Errorf("a Bastion must have at least one hop")
+	}
+	for i, h := range hops {
+		if h.Config == nil {
+			return nil, fmt.Errorf("jump host %d(%s) has no Config", i, h.Addr)
+		}
+	}
+	return &Bastion{hops: hops}, nil
+}
+
+// dial connects to addr through the jump hosts.
+func (b *Bastion) dial(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, "tcp", addr)
+}
+
+// connect returns the connection to the last hop, connecting if needed. Only one caller
+// connects at a time, the others wait for it or for their ctx to be done.
+func (b *Bastion) connect(ctx context.Context) (*ssh.Client, error) {
+	for {
+		b.mu.Lock()
+		switch {
+		case b.closed:
+			b.mu.Unlock()
+			return nil, fmt.Errorf("bastion is closed")
+		case len(b.clients) > 0:
+			last := b.clients[len(b.clients)-1]
+			b.mu.Unlock()
+			return last, nil
+		case b.err != nil && time.Now().Before(b.retryAt):
+			err := b.err
+			b.mu.Unlock()
+			return nil, err
+		case b.dialing != nil:
+			dialing := b.dialing
+			b.mu.Unlock()
+			select {
+			case <-dialing:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		dialing := make(chan struct{})
+		b.dialing = dialing
+		b.mu.Unlock()
+
+		clients, err := b.connectHops(ctx)
+
+		b.mu.Lock()
+		b.dialing = nil
+		close(dialing)
+		if err != nil {
+			// Our ctx being done isn't the jump host's fault, the next caller tries again.
+			if ctx.Err() == nil {
+				b.backoff *= 2
+				switch {
+				case b.backoff < bastionMinBackoff:
+					b.backoff = bastionMinBackoff
+				case b.backoff > bastionMaxBackoff:
+					b.backoff = bastionMaxBackoff
+				}
+				b.err = err
+				b.retryAt = time.Now().Add(b.backoff)
+			}
+			b.mu.Unlock()
+			return nil, err
+		}
+		if b.closed {
+			b.mu.Unlock()
+			closeClients(clients)
+			return nil, fmt.Errorf("bastion is closed")
+		}
+		b.clients = clients
+		b.err = nil
+		b.backoff = 0
+		b.mu.Unlock()
+
+		last := clients[len(clients)-1]
+		// Forget the connection when it dies so the next dial reconnects.
+		go func() {
+			last.Wait()
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if len(b.clients) > 0 && b.clients[len(b.clients)-1] == last {
+				closeClients(b.clients)
+				b.clients = nil
+			}
+		}()
+		return last, nil
+	}
+}
+
+// connectHops logs into each hop in turn through the one before it.
+func (b *Bastion) connectHops(ctx context.Context) ([]*ssh.Client, error) {
+	var clients []*ssh.Client
+	for _, hop := range b.hops {
+		client, err := connectHop(ctx, hop, clients)
+		if err != nil {
+			closeClients(clients)
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// connectHop logs into hop through the last of clients, or directly if there are none.
+// hop.Config.Timeout bounds the connect and the login together.
+func connectHop(ctx context.Context, hop Jump, clients []*ssh.Client) (*ssh.Client, error) {
+	if hop.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hop.Config.Timeout)
+		defer cancel()
+	}
+
+	var conn net.Conn
+	var err error
+	if len(clients) == 0 {
+		d := net.Dialer{}
+		conn, err = d.DialContext(ctx, "tcp", hop.Addr)
+	} else {
+		conn, err = clients[len(clients)-1].DialContext(ctx, "tcp", hop.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to jump host %s: %w", hop.Addr, err)
+	}
+
+	client, err := handshake(ctx, conn, hop.Addr, hop.Config, hop.HostKeyAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("could not login to jump host %s: %w", hop.Addr, err)
+	}
+	return client, nil
+}
+
+// closeClients closes clients, last hop first.
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// Close closes the connection to the jump hosts. It is safe to call more than once.
+func (b *Bastion) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	closeClients(b.clients)
+	b.clients = nil
+	return nil
+}
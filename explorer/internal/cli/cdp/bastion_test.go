@@ -0,0 +1,380 @@
+package cdp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"golang.org/x/crypto/ssh"
+)
+
+const cdpOutput = `
+Device ID: Switch2
+Entry address(es):
+  IP address: 192.168.1.243
+Platform: cisco WS-C2950-12,  Capabilities: Trans-Bridge Switch
+Interface: FastEthernet0/12,  Port ID (outgoing port): FastEthernet0/1
+Holdtime : 137 sec
+`
+
+// testServer is an in-process SSH server that accepts the password "pass".
+type testServer struct {
+	addr   string
+	port   int
+	logins int32
+
+	ln net.Listener
+	wg sync.WaitGroup
+}
+
+func newTestServer(t *testing.T, handle func(ssh.NewChannel)) *testServer {
+	t.Helper()
+	return newTestServerConn(t, func(_ *ssh.ServerConn, ch ssh.NewChannel) { handle(ch) })
+}
+
+// newTestServerConn is like newTestServer, but handle is also given the connection the
+// channel is on.
+func newTestServerConn(t *testing.T, handle func(*ssh.ServerConn, ssh.NewChannel)) *testServer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			atomic.AddInt32(&s.logins, 1)
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	s.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.addr = s.ln.Addr().String()
+	s.port = s.ln.Addr().(*net.TCPAddr).Port
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					go handle(sc, ch)
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *testServer) close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// jumpHandler forwards direct-tcpip channels, like a bastion host.
+func jumpHandler(newCh ssh.NewChannel) {
+	if newCh.ChannelType() != "direct-tcpip" {
+		newCh.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+		return
+	}
+	var req struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &req); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port))))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(ch, conn)
+		ch.Close()
+	}()
+	io.Copy(conn, ch)
+	conn.Close()
+}
+
+// deviceHandler answers "show cdp neighbors detail" with cdpOutput.
+func deviceHandler(newCh ssh.NewChannel) {
+	if newCh.ChannelType() != "session" {
+		newCh.Reject(ssh.UnknownChannelType, "only session is supported")
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		ssh.Unmarshal(req.Payload, &exec)
+		req.Reply(true, nil)
+
+		status := uint32(0)
+		if exec.Command == "show cdp neighbors detail" {
+			io.WriteString(ch, cdpOutput)
+		} else {
+			io.WriteString(ch, "% Invalid input detected at '^' marker.")
+			status = 1
+		}
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func TestBastion(t *testing.T) {
+	device := newTestServer(t, deviceHandler)
+	defer device.close()
+	jump1 := newTestServer(t, jumpHandler)
+	defer jump1.close()
+	jump2 := newTestServer(t, jumpHandler)
+	defer jump2.close()
+
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	bastion, err := NewBastion(Jump{Addr: jump1.addr, Config: config}, Jump{Addr: jump2.addr, Config: config})
+	if err != nil {
+		t.Fatalf("TestBastion: NewBastion() had error: %s", err)
+	}
+
+	tests := []struct {
+		desc string
+		conn Conn
+	}{
+		{desc: "Direct", conn: Conn{Config: config, Port: device.port}},
+		{desc: "Through jump hosts", conn: Conn{Config: config, Port: device.port, Bastion: bastion}},
+		{desc: "Reuse jump host connection", conn: Conn{Config: config, Port: device.port, Bastion: bastion}},
+	}
+
+	for _, test := range tests {
+		conn := test.conn
+		d, err := New(func(*network.Node) []Conn { return []Conn{conn} }, WithBastions(bastion))
+		if err != nil {
+			t.Fatalf("TestBastion(%s): New() had error: %s", test.desc, err)
+		}
+
+		node := &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}
+		if err := d.Node(context.Background(), node); err != nil {
+			t.Fatalf("TestBastion(%s): Node() had error: %s", test.desc, err)
+		}
+		if n := node.Neighbors["FastEthernet0/12"]; n == nil || n.DeviceID != "Switch2" {
+			t.Errorf("TestBastion(%s): did not get the neighbor from the device, got %v", test.desc, node.Neighbors)
+		}
+	}
+
+	if got := atomic.LoadInt32(&device.logins); got != 3 {
+		t.Errorf("TestBastion: device had %d logins, want 3", got)
+	}
+	for i, j := range []*testServer{jump1, jump2} {
+		if got := atomic.LoadInt32(&j.logins); got != 1 {
+			t.Errorf("TestBastion: jump host %d had %d logins, want 1", i+1, got)
+		}
+	}
+
+	bastion.Close()
+	d, _ := New(StaticConns(config))
+	d.conns = func(*network.Node) []Conn { return []Conn{{Config: config, Port: device.port, Bastion: bastion}} }
+	if err := d.Node(context.Background(), &network.Node{IP: net.ParseIP("127.0.0.1")}); err == nil {
+		t.Errorf("TestBastion: Node() after bastion was closed: got err == nil, want err != nil")
+	}
+}
+
+// acceptServer accepts TCP connections and counts them. If hang is set they are held open
+// without answering, otherwise they are closed at once, so an SSH handshake fails.
+type acceptServer struct {
+	addr    string
+	accepts int32
+
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newAcceptServer(t *testing.T, hang bool) *acceptServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &acceptServer{addr: ln.Addr().String(), ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&s.accepts, 1)
+			if !hang {
+				conn.Close()
+				continue
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+		}
+	}()
+	return s
+}
+
+func (s *acceptServer) close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func TestBastionFailure(t *testing.T) {
+	jump := newAcceptServer(t, false)
+	defer jump.close()
+
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+	bastion, err := NewBastion(Jump{Addr: jump.addr, Config: config})
+	if err != nil {
+		t.Fatalf("TestBastionFailure: NewBastion() had error: %s", err)
+	}
+	defer bastion.Close()
+
+	// The failure is remembered, so the jump host is only tried once.
+	for i := 0; i < 3; i++ {
+		if _, err := bastion.dial(context.Background(), "192.0.2.1:22"); err == nil {
+			t.Fatalf("TestBastionFailure: dial() %d: got err == nil, want err != nil", i)
+		}
+	}
+	if got := atomic.LoadInt32(&jump.accepts); got != 1 {
+		t.Errorf("TestBastionFailure: jump host had %d connections, want 1", got)
+	}
+
+	// After the backoff, it is tried again.
+	bastion.mu.Lock()
+	if bastion.backoff != bastionMinBackoff {
+		t.Errorf("TestBastionFailure: got backoff %s, want %s", bastion.backoff, bastionMinBackoff)
+	}
+	bastion.retryAt = time.Now()
+	bastion.mu.Unlock()
+	if _, err := bastion.dial(context.Background(), "192.0.2.1:22"); err == nil {
+		t.Fatalf("TestBastionFailure: dial() after backoff: got err == nil, want err != nil")
+	}
+	if got := atomic.LoadInt32(&jump.accepts); got != 2 {
+		t.Errorf("TestBastionFailure: jump host had %d connections after backoff, want 2", got)
+	}
+	bastion.mu.Lock()
+	if bastion.backoff != 2*bastionMinBackoff {
+		t.Errorf("TestBastionFailure: got backoff %s, want %s", bastion.backoff, 2*bastionMinBackoff)
+	}
+	bastion.mu.Unlock()
+}
+
+func TestBastionWait(t *testing.T) {
+	jump := newAcceptServer(t, true)
+	defer jump.close()
+
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Minute,
+	}
+	bastion, err := NewBastion(Jump{Addr: jump.addr, Config: config})
+	if err != nil {
+		t.Fatalf("TestBastionWait: NewBastion() had error: %s", err)
+	}
+	defer bastion.Close()
+
+	// The first dial hangs in the handshake with the jump host.
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := bastion.dial(firstCtx, "192.0.2.1:22")
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&jump.accepts) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A second dial waits for the first, but gives up when its ctx is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := bastion.dial(ctx, "192.0.2.1:22"); err != context.DeadlineExceeded {
+		t.Errorf("TestBastionWait: got err == %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("TestBastionWait: second dial took %s, it should not wait for the first", d)
+	}
+	if got := atomic.LoadInt32(&jump.accepts); got != 1 {
+		t.Errorf("TestBastionWait: jump host had %d connections, want 1", got)
+	}
+
+	// Cancelling the first isn't the jump host's fault, so it isn't remembered.
+	cancelFirst()
+	if err := <-firstErr; err == nil {
+		t.Fatalf("TestBastionWait: first dial: got err == nil, want err != nil")
+	}
+	bastion.mu.Lock()
+	if bastion.err != nil {
+		t.Errorf("TestBastionWait: cancelled dial was remembered as a failure: %s", bastion.err)
+	}
+	bastion.mu.Unlock()
+}
@@ -1,72 +1,389 @@
 // Package CDP provides a method for doing neighbor discovery via a command line SSH CDP command.
+// It also runs the LLDP command over the same login, so non-Cisco neighbors are found too.
 package cdp
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/johnsiilver/halfpike"
 	"github.com/johnsiilver/netcrawl/explorer/internal/cli/cdp/statemachine"
+	"github.com/johnsiilver/netcrawl/explorer/internal/hostkey"
 	"github.com/johnsiilver/netcrawl/network"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/time/rate"
 )
 
-// Discover will try to discover a node via CDP via an SSH CLI session.
+// protocol describes how to get neighbor information for a discovery protocol out of the CLI.
+type protocol struct {
+	name string
+	// cmds are the commands to try, in order, until one gives output we can parse.
+	// This lets us deal with vendors that use different commands.
+	cmds []string
+	// start provides the start of a new statemachine to parse the output with.
+	start func() halfpike.ParseFn
+}
+
+var cdpProto = protocol{
+	name:  "CDP",
+	cmds:  []string{"show cdp neighbors detail"},
+	start: func() halfpike.ParseFn { return (&statemachine.CDP{}).Start },
+}
+
+var lldpProto = protocol{
+	name: "LLDP",
+	cmds: []string{
+		// Cisco IOS/NX-OS, Arista EOS, Juniper Junos.
+		"show lldp neighbors detail",
+		// HP/Aruba ProCurve.
+		"show lldp info remote-device detail",
+	},
+	start: func() halfpike.ParseFn { return (&statemachine.LLDP{}).Start },
+}
+
+// Transport is the protocol used to login to a device.
+type Transport int
+
+const (
+	// TransportSSH logs in with SSH.
+	TransportSSH Transport = iota
+	// TransportTelnet logs in with telnet. Commands are always run with SessionShell.
+	TransportTelnet
+)
+
+// Conn is an SSH client config and the port to connect to a device with.
+type Conn struct {
+	// Config is used to login. Telnet only uses the User and Timeout.
+	Config *ssh.ClientConfig
+	// Port is the port to connect to. Defaults to 22 for SSH and 23 for telnet.
+	Port int
+	// Bastion, if set, is the jump hosts to tunnel the connection through.
+	Bastion *Bastion
+	// Dialer, if set, makes the TCP connection to the device, such as through a SOCKS5
+	// proxy. It is not used if Bastion is set. Defaults to a net.Dialer.
+	Dialer NetDialer
+	// Session is how commands are run on the device. Defaults to SessionExec.
+	Session SessionMode
+	// EnableSecret, if set, is used to enter enable mode when using SessionShell.
+	EnableSecret string
+	// Transport is the protocol to login with. Defaults to TransportSSH.
+	Transport Transport
+	// Password is the password for telnet logins. SSH uses the Config.Auth methods.
+	Password string
+	// AgentSocket, if set, is the path of an ssh-agent socket to forward to the device.
+	AgentSocket string
+	// HostKeyAlgorithms, if set, restricts the host key algorithms accepted from the device.
+	HostKeyAlgorithms HostKeyAlgorithms
+}
+
+// HostKeyAlgorithms returns the host key algorithms to accept from addr (a host:port), such
+// as those of the keys known for it. It returns nil to accept any that Config allows.
+type HostKeyAlgorithms func(addr string) []string
+
+// NetDialer makes network connections. *net.Dialer implements it.
+type NetDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// addr returns the address to dial for ip.
+func (c Conn) addr(ip net.IP) string {
+	port := c.Port
+	switch {
+	case port != 0:
+	case c.Transport == TransportTelnet:
+		port = 23
+	default:
+		port = 22
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// Conns returns the Conns to try, in order, to login to node.
+type Conns func(node *network.Node) []Conn
+
+// StaticConns returns Conns that uses configs on port 22 for every device.
+func StaticConns(configs ...*ssh.ClientConfig) Conns {
+	conns := make([]Conn, 0, len(configs))
+	for _, c := range configs {
+		conns = append(conns, Conn{Config: c})
+	}
+	return func(*network.Node) []Conn { return conns }
+}
+
+// Discover will try to discover a node via CDP and LLDP via an SSH CLI session.
 type Discover struct {
-	configs []*ssh.ClientConfig
+	conns Conns
+	// protos are run in order over the same login.
+	protos []protocol
+
+	cmdTimeout time.Duration
+	bastions   []*Bastion
+	closers    []io.Closer
+	lastGood   *LastGood
+	logins     *rate.Limiter
+}
+
+// Option is an optional argument to New() or NewLLDP().
+type Option func(d *Discover)
+
+// WithCommandTimeout sets the maximum time a single command on the device may take.
+// By default there is no limit other than the Context passed to Node().
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(d *Discover) {
+		d.cmdTimeout = timeout
+	}
+}
+
+// WithBastions gives the Discover ownership of bastions used by its Conns, so they are
+// closed by Close(). Bastions may be shared by more than one Discover.
+func WithBastions(bastions ...*Bastion) Option {
+	return func(d *Discover) {
+		d.bastions = append(d.bastions, bastions...)
+	}
 }
 
-// New is the constructor for Discover.
-func New(configs []*ssh.ClientConfig) (*Discover, error) {
-	return &Discover{configs: configs}, nil
+// WithClosers gives the Discover ownership of closers, such as the ssh-agent connection its
+// Conns authenticate with, so they are closed by Close().
+func WithClosers(closers ...io.Closer) Option {
+	return func(d *Discover) {
+		d.closers = append(d.closers, closers...)
+	}
+}
+
+// WithLastGood has the Discover record which Conn logged into each device in lg, and try
+// that Conn first for the next device in the same subnet. lg may be shared by more than
+// one Discover.
+func WithLastGood(lg *LastGood) Option {
+	return func(d *Discover) {
+		d.lastGood = lg
+	}
 }
 
-// Node logs into node.IP and runs CDP neighbor discovery and fills out our Neighbors.
+// WithLoginLimiter limits how fast the Discover tries to login, each Conn tried is one
+// login. l may be shared by more than one Discover.
+func WithLoginLimiter(l *rate.Limiter) Option {
+	return func(d *Discover) {
+		d.logins = l
+	}
+}
+
+// New is the constructor for Discover. It runs the CDP and LLDP commands over a single login
+// and merges the neighbors they find. CDP wins when both see a neighbor, as it gives us a
+// better platform string.
+func New(conns Conns, options ...Option) (*Discover, error) {
+	if conns == nil {
+		return nil, fmt.Errorf("conns must not be nil")
+	}
+	d := &Discover{conns: conns, protos: []protocol{cdpProto, lldpProto}}
+	for _, o := range options {
+		o(d)
+	}
+	return d, nil
+}
+
+// NewLLDP is the constructor for a Discover that only uses LLDP.
+func NewLLDP(conns Conns, options ...Option) (*Discover, error) {
+	if conns == nil {
+		return nil, fmt.Errorf("conns must not be nil")
+	}
+	d := &Discover{conns: conns, protos: []protocol{lldpProto}}
+	for _, o := range options {
+		o(d)
+	}
+	return d, nil
+}
+
+// Node logs into node.IP and runs neighbor discovery and fills out our Neighbors.
 func (d *Discover) Node(ctx context.Context, node *network.Node) error {
-	var b []byte
-	var err error
+	conns := d.conns(node)
+	if d.lastGood != nil {
+		conns = d.lastGood.order(node.IP, conns)
+	}
+	if len(conns) == 0 {
+		return fmt.Errorf("no configurations to login to node %s with", node.IP.String())
+	}
 
-	for _, conf := range d.configs {
-		b, err = d.runCDPNeighbor(node.IP, conf)
+	var cli client
+	var used Conn
+	var err error
+	for _, conn := range conns {
+		if d.logins != nil {
+			if err := d.logins.Wait(ctx); err != nil {
+				return fmt.Errorf("could not login to node(%s): %w", node.IP.String(), err)
+			}
+		}
+		cli, err = dialer(ctx, conn.addr(node.IP), conn)
 		if err == nil {
+			used = conn
+			if d.lastGood != nil {
+				d.lastGood.set(node.IP, conn)
+			}
+			// Telnet has no exec requests.
+			if used.Transport == TransportTelnet {
+				used.Session = SessionShell
+			}
 			break
-			return fmt.Errorf("could not login to node %s: %s", node.IP.String(), err)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("could not login to node(%s): %w", node.IP.String(), ctx.Err())
+		}
+		// The host key won't change between credentials, so there is no point in trying the others.
+		var hkErr *hostkey.Error
+		if errors.As(err, &hkErr) {
+			return fmt.Errorf("could not login to node(%s): %w", node.IP.String(), err)
 		}
 	}
 	if err != nil {
-		return fmt.Errorf("could not login to node(%s) with any provided user/password, last error was: %s", node.IP.String(), err)
+		return fmt.Errorf("could not login to node(%s) with any provided user/password, last error was: %w", node.IP.String(), err)
 	}
+	defer cli.conn().close()
 
-	parser, err := halfpike.NewParser(string(b), node)
-	if err != nil {
-		return fmt.Errorf("problems making parser for node %s output: %s", node.IP.String(), err)
+	// The protocols name the same neighbor on a device that speaks both, so neighbors on an
+	// interface or IP that an earlier protocol found are skipped.
+	seen := map[string]bool{}
+	var names, errs []string
+	ok := false
+	for _, proto := range d.protos {
+		names = append(names, proto.name)
+		found, err := d.protoNeighbors(ctx, cli, &used, node, proto)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("could not get neighbors for node %s: %w", node.IP.String(), ctx.Err())
+			}
+			errs = append(errs, err.Error())
+			continue
+		}
+		ok = true
+
+		var keys []string
+		for inter, n := range found.Neighbors {
+			if seen[string(inter)] || (n.IP != nil && seen[n.IP.String()]) {
+				continue
+			}
+			node.SetNeighbor(inter, n)
+			if d := found.LinkDetails[inter]; d != nil {
+				node.SetLinkDetail(inter, d)
+			}
+			keys = append(keys, string(inter))
+			if n.IP != nil {
+				keys = append(keys, n.IP.String())
+			}
+		}
+		for _, k := range keys {
+			seen[k] = true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("could not get %s neighbors for node %s: %s", strings.Join(names, " or "), node.IP.String(), strings.Join(errs, "; "))
 	}
+	return nil
+}
 
-	sm := &statemachine.CDP{}
+// protoNeighbors tries each of proto's commands until one gives output that can be parsed,
+// and returns a node with the neighbors found.
+func (d *Discover) protoNeighbors(ctx context.Context, cli client, conn *Conn, node *network.Node, proto protocol) (*network.Node, error) {
+	var err error
+	for _, cmd := range proto.cmds {
+		var found *network.Node
+		found, err = d.neighbors(ctx, cli, conn, node, proto, cmd)
+		if err == nil {
+			return found, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%s: %s", proto.name, err)
+}
 
-	if err := halfpike.Parse(ctx, parser, sm.Start); err != nil {
-		return err
+// Close closes anything passed with WithBastions() or WithClosers().
+func (d *Discover) Close() error {
+	for _, b := range d.bastions {
+		b.Close()
+	}
+	for _, c := range d.closers {
+		c.Close()
 	}
 	return nil
 }
 
-func (d *Discover) runCDPNeighbor(nodeIP net.IP, config *ssh.ClientConfig) ([]byte, error) {
-	cli, err := dialer(nodeIP.String(), config)
+// neighbors runs cmd on node and parses the output with proto into the Neighbors of the
+// returned node.
+func (d *Discover) neighbors(ctx context.Context, cli client, conn *Conn, node *network.Node, proto protocol, cmd string) (*network.Node, error) {
+	b, err := d.run(ctx, cli, conn, cmd)
 	if err != nil {
-		return nil, fmt.Errorf("could not dial node: %s", err)
+		return nil, err
 	}
-	defer cli.conn().close()
 
+	// Only the neighbors of scratch are used. Its Type just has to pass Validate(), as node's
+	// may be empty when it was learned from a neighbor that didn't advertise a platform.
+	scratch := &network.Node{IP: node.IP, Type: "scratch"}
+	parser, err := halfpike.NewParser(string(b), scratch)
+	if err != nil {
+		return nil, fmt.Errorf("problems making parser for output: %s", err)
+	}
+
+	if err := halfpike.Parse(ctx, parser, proto.start()); err != nil {
+		return nil, err
+	}
+	return scratch, nil
+}
+
+// run runs cmd on the device the way conn.Session says to. If SessionAuto falls back to
+// the shell, conn.Session is changed to SessionShell for the commands after.
+func (d *Discover) run(ctx context.Context, cli client, conn *Conn, cmd string) ([]byte, error) {
+	if d.cmdTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.cmdTimeout)
+		defer cancel()
+	}
+
+	if conn.Session == SessionShell {
+		return d.runShell(ctx, cli, conn, cmd)
+	}
+
+	b, err := d.exec(ctx, cli, cmd)
+	// Devices that don't allow exec either refuse it or answer with nothing.
+	if conn.Session == SessionAuto && ctx.Err() == nil && len(bytes.TrimSpace(b)) == 0 {
+		conn.Session = SessionShell
+		return d.runShell(ctx, cli, conn, cmd)
+	}
+	return b, err
+}
+
+// exec runs cmd with an exec request.
+func (d *Discover) exec(ctx context.Context, cli client, cmd string) ([]byte, error) {
 	session, err := cli.newSession()
 	if err != nil {
 		return nil, fmt.Errorf("could not create session: %s", err)
 	}
 	defer session.close()
 
-	b, err := session.combinedOutput("show cdp neighbors detail")
+	b, err := session.combinedOutput(ctx, cmd)
+	if err != nil {
+		return b, fmt.Errorf("problem executing '%s': %w", cmd, err)
+	}
+	return b, nil
+}
+
+// runShell runs cmd on an interactive shell.
+func (d *Discover) runShell(ctx context.Context, cli client, conn *Conn, cmd string) ([]byte, error) {
+	session, err := cli.newShell(ctx, conn.EnableSecret)
+	if err != nil {
+		return nil, fmt.Errorf("could not create shell session: %w", err)
+	}
+	defer session.close()
+
+	b, err := session.combinedOutput(ctx, cmd)
 	if err != nil {
-		return nil, fmt.Errorf("problem executing 'show cdp neighbors detail': %s", err)
+		return nil, fmt.Errorf("problem executing '%s' on shell: %w", cmd, err)
 	}
 	return b, nil
 }
@@ -0,0 +1,172 @@
+package cdp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"github.com/kylelemons/godebug/pretty"
+	"golang.org/x/time/rate"
+)
+
+const lldpOutput = `
+------------------------------------------------
+Local Intf: Fa0/12
+Chassis id: 0026.9876.5432
+Port id: Fa0/1
+Port Description: FastEthernet0/1
+System Name: Switch2
+
+System Description:
+Cisco IOS Software, C2950 Software
+
+Time remaining: 112 seconds
+System Capabilities: B
+Enabled Capabilities: B
+Management Addresses:
+    IP: 192.168.1.243
+
+------------------------------------------------
+Local Intf: Fa0/13
+Chassis id: 0019.e2aa.0001
+Port id: ge-0/0/1
+Port Description: ge-0/0/1
+System Name: ex2300
+
+System Description:
+Juniper Networks, Inc. ex2300-24t
+
+Time remaining: 100 seconds
+System Capabilities: B,R
+Enabled Capabilities: B
+Management Addresses:
+    IP: 192.168.1.250
+
+Total entries displayed: 2
+`
+
+func TestNode(t *testing.T) {
+	realDialer := dialer
+	defer func() { dialer = realDialer }()
+
+	FakeDialer(map[string]interface{}{
+		// A Cisco switch with a CDP neighbor, which LLDP also sees, and an LLDP only neighbor.
+		"10.0.0.1": map[string]interface{}{
+			"show cdp neighbors detail":  cdpOutput,
+			"show lldp neighbors detail": lldpOutput,
+		},
+		// A device that doesn't speak CDP.
+		"10.0.0.2": map[string]interface{}{
+			"show lldp neighbors detail": lldpOutput,
+		},
+		// A device that speaks neither.
+		"10.0.0.3": map[string]interface{}{},
+	})
+	logins := 0
+	fakeDialer := dialer
+	dialer = func(ctx context.Context, addr string, c Conn) (client, error) {
+		logins++
+		return fakeDialer(ctx, addr, c)
+	}
+
+	tests := []struct {
+		desc string
+		ip   string
+		// noType is for a node learned from a neighbor that didn't advertise a platform.
+		noType  bool
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			desc: "CDP and LLDP",
+			ip:   "10.0.0.1",
+			want: map[string]string{
+				"FastEthernet0/12": "cisco WS-C2950-12",
+				"Fa0/13":           "Juniper Networks, Inc. ex2300-24t",
+			},
+		},
+		{
+			desc: "LLDP only",
+			ip:   "10.0.0.2",
+			want: map[string]string{
+				"Fa0/12": "Cisco IOS Software, C2950 Software",
+				"Fa0/13": "Juniper Networks, Inc. ex2300-24t",
+			},
+		},
+		{
+			desc:   "Node without a Type",
+			ip:     "10.0.0.1",
+			noType: true,
+			want: map[string]string{
+				"FastEthernet0/12": "cisco WS-C2950-12",
+				"Fa0/13":           "Juniper Networks, Inc. ex2300-24t",
+			},
+		},
+		{desc: "Neither", ip: "10.0.0.3", wantErr: true},
+	}
+
+	d, err := New(StaticConns(nil))
+	if err != nil {
+		t.Fatalf("TestNode: New() had error: %s", err)
+	}
+	for _, test := range tests {
+		logins = 0
+		node := &network.Node{IP: net.ParseIP(test.ip), Type: "RootNode"}
+		if test.noType {
+			node.Type = ""
+		}
+		err := d.Node(context.Background(), node)
+		if logins != 1 {
+			t.Errorf("TestNode(%s): got %d logins, want 1", test.desc, logins)
+		}
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestNode(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestNode(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		got := map[string]string{}
+		for inter, n := range node.Neighbors {
+			got[string(inter)] = n.Type
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestNode(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	realDialer := dialer
+	defer func() { dialer = realDialer }()
+	logins := 0
+	dialer = func(ctx context.Context, addr string, c Conn) (client, error) {
+		logins++
+		return nil, fmt.Errorf("bad password")
+	}
+
+	// Each Conn is a login, but only two are allowed for the rest of the test.
+	d, err := New(
+		func(*network.Node) []Conn { return []Conn{{}, {}, {}} },
+		WithLoginLimiter(rate.NewLimiter(rate.Every(time.Hour), 2)),
+	)
+	if err != nil {
+		t.Fatalf("TestLoginLimiter: New() had error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Node(ctx, &network.Node{IP: net.ParseIP("10.0.0.1"), Type: "RootNode"}); err == nil {
+		t.Fatalf("TestLoginLimiter: got err == nil, want err != nil")
+	}
+	if logins != 2 {
+		t.Errorf("TestLoginLimiter: got %d logins, want 2", logins)
+	}
+}
@@ -0,0 +1,88 @@
+package cdp
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// LastGood remembers which Conn logged into each device, so that the next device in the
+// same subnet can try it first. Devices in a subnet usually share credentials, so this
+// saves login attempts that could lock out accounts. It is safe for concurrent use.
+type LastGood struct {
+	subnetV4, subnetV6 net.IPMask
+
+	mu       sync.Mutex
+	byIP     map[string]connKey
+	bySubnet map[string]connKey
+}
+
+// connKey identifies a Conn.
+type connKey struct {
+	config    *ssh.ClientConfig
+	transport Transport
+	port      int
+}
+
+func (c Conn) key() connKey {
+	return connKey{config: c.Config, transport: c.Transport, port: c.Port}
+}
+
+// NewLastGood returns a LastGood where a subnet is an IPv4 prefix of v4Bits and an IPv6
+// prefix of v6Bits.
+func NewLastGood(v4Bits, v6Bits int) *LastGood {
+	return &LastGood{
+		subnetV4: net.CIDRMask(v4Bits, 32),
+		subnetV6: net.CIDRMask(v6Bits, 128),
+		byIP:     map[string]connKey{},
+		bySubnet: map[string]connKey{},
+	}
+}
+
+// subnet returns the key for the subnet ip is in.
+func (l *LastGood) subnet(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(l.subnetV4).String()
+	}
+	return ip.Mask(l.subnetV6).String()
+}
+
+// set records that conn logged into the device at ip. Telnet isn't recorded, as it must only
+// be tried after every SSH Conn has failed.
+func (l *LastGood) set(ip net.IP, conn Conn) {
+	if conn.Transport == TransportTelnet {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.byIP[ip.String()] = conn.key()
+	l.bySubnet[l.subnet(ip)] = conn.key()
+}
+
+// order returns conns with the one that last worked for ip, or else for its subnet, moved
+// to the front. conns is not changed.
+func (l *LastGood) order(ip net.IP, conns []Conn) []Conn {
+	l.mu.Lock()
+	key, ok := l.byIP[ip.String()]
+	if !ok {
+		key, ok = l.bySubnet[l.subnet(ip)]
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		return conns
+	}
+	for i, c := range conns {
+		if c.key() != key {
+			continue
+		}
+		out := make([]Conn, 0, len(conns))
+		out = append(out, c)
+		out = append(out, conns[:i]...)
+		return append(out, conns[i+1:]...)
+	}
+	return conns
+}
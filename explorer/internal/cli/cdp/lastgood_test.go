@@ -0,0 +1,108 @@
+package cdp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLastGood(t *testing.T) {
+	device := newTestServer(t, deviceHandler)
+	defer device.close()
+
+	config := func(pass string) *ssh.ClientConfig {
+		return &ssh.ClientConfig{
+			User:            "user",
+			Auth:            []ssh.AuthMethod{ssh.Password(pass)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		}
+	}
+	bad := Conn{Config: config("wrong"), Port: device.port}
+	good := Conn{Config: config("pass"), Port: device.port}
+	other := Conn{Config: config("other"), Port: device.port}
+	conns := []Conn{bad, other, good}
+
+	lg := NewLastGood(24, 64)
+	d, err := New(func(*network.Node) []Conn { return conns }, WithLastGood(lg))
+	if err != nil {
+		t.Fatalf("TestLastGood: New() had error: %s", err)
+	}
+	if err := d.Node(context.Background(), &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}); err != nil {
+		t.Fatalf("TestLastGood: Node() had error: %s", err)
+	}
+	lg.set(net.ParseIP("2001:db8::1"), other)
+
+	tests := []struct {
+		ip   string
+		want *ssh.ClientConfig
+	}{
+		// The device itself.
+		{ip: "127.0.0.1", want: good.Config},
+		// Same subnet.
+		{ip: "127.0.0.200", want: good.Config},
+		// Different subnet, so the order doesn't change.
+		{ip: "127.0.1.1", want: bad.Config},
+		{ip: "2001:db8::2", want: other.Config},
+		{ip: "2001:db8:0:1::1", want: bad.Config},
+	}
+
+	for _, test := range tests {
+		got := lg.order(net.ParseIP(test.ip), conns)
+		if len(got) != len(conns) {
+			t.Errorf("TestLastGood(%s): got %d conns, want %d", test.ip, len(got), len(conns))
+			continue
+		}
+		if got[0].Config != test.want {
+			t.Errorf("TestLastGood(%s): first Conn was not the one we wanted", test.ip)
+		}
+	}
+	if conns[0].Config != bad.Config || conns[2].Config != good.Config {
+		t.Errorf("TestLastGood: order() changed the conns passed to it")
+	}
+}
+
+func TestLastGoodTelnet(t *testing.T) {
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	// A port that nothing is listening on, so SSH fails.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	server := newTelnetServer(t, "user", "pass", shellDevice{secret: "secret"})
+	defer server.close()
+
+	sshConn := Conn{Config: config, Port: closedPort}
+	telnet := Conn{Config: config, Port: server.port, Transport: TransportTelnet, Password: "pass", EnableSecret: "secret"}
+	conns := []Conn{sshConn, telnet}
+
+	lg := NewLastGood(24, 64)
+	d, err := New(func(*network.Node) []Conn { return conns }, WithLastGood(lg), WithCommandTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("TestLastGoodTelnet: New() had error: %s", err)
+	}
+	if err := d.Node(context.Background(), &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}); err != nil {
+		t.Fatalf("TestLastGoodTelnet: Node() had error: %s", err)
+	}
+
+	// Telnet logged in, but SSH must still be tried first.
+	for _, ip := range []string{"127.0.0.1", "127.0.0.200"} {
+		got := lg.order(net.ParseIP(ip), conns)
+		if len(got) != 2 || got[0].Transport != TransportSSH || got[1].Transport != TransportTelnet {
+			t.Errorf("TestLastGoodTelnet(%s): telnet was moved in front of SSH", ip)
+		}
+	}
+}
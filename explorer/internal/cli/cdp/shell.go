@@ -0,0 +1,253 @@
+package cdp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SessionMode is how commands are run on a device.
+type SessionMode int
+
+const (
+	// SessionExec runs each command with an SSH exec request.
+	SessionExec SessionMode = iota
+	// SessionShell types commands into an interactive shell on a PTY. This is for devices
+	// that reject exec requests or run them without privileges, like older IOS and ASA.
+	SessionShell
+	// SessionAuto uses SessionExec, falling back to SessionShell if exec fails without output.
+	SessionAuto
+)
+
+var (
+	// anyPrompt matches a CLI prompt at the end of the output, such as "Switch>", "Switch#",
+	// "Switch(config)#" or "user@router>". The first group is the prompt without its mode.
+	anyPrompt = regexp.MustCompile(`(?:^|\n)([\w.\-@/:~]+)(?:\([\w.\-/]+\))?[>#$%] ?$`)
+	// passwordPrompt matches the prompt for the enable secret.
+	passwordPrompt = regexp.MustCompile(`(?i)password: ?$`)
+	// morePrompt matches a pager prompt, for devices that ignored "terminal length 0".
+	morePrompt = regexp.MustCompile(`(?i)\s*-+ ?more ?-+\s*$`)
+	// cliErrors are the start of lines that mean the device didn't like our command.
+	cliErrors = []string{"% Invalid", "% Incomplete", "% Unknown", "% Ambiguous", "ERROR:"}
+)
+
+// shell is a session that runs commands on an interactive shell.
+type shell struct {
+	closer io.Closer
+	stdin  io.Writer
+
+	// reads has what the device sends us, it is closed when the shell ends.
+	reads chan []byte
+	buf   []byte
+	// prompt matches the device's prompt, learned by start().
+	prompt *regexp.Regexp
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newShellIO returns a shell that talks to the device with stdin and stdout. closer ends
+// the shell. start() must be called before running commands.
+func newShellIO(stdin io.Writer, stdout io.Reader, closer io.Closer) *shell {
+	s := &shell{closer: closer, stdin: stdin, reads: make(chan []byte, 1), done: make(chan struct{})}
+	go s.read(stdout)
+	return s
+}
+
+// newShell implements client.newShell().
+func (s sshClient) newShell(ctx context.Context, enable string) (session, error) {
+	sess, err := s.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	s.requestAgent(sess)
+	sh, err := startShell(ctx, sess, enable)
+	if err != nil {
+		sess.Close()
+		return nil, err
+	}
+	return sh, nil
+}
+
+// startShell starts an interactive shell on sess. See shell.start() for what is done.
+func startShell(ctx context.Context, sess *ssh.Session, enable string) (*shell, error) {
+	modes := ssh.TerminalModes{ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+	// A wide terminal keeps long lines from being wrapped.
+	if err := sess.RequestPty("vt100", 0, 511, modes); err != nil {
+		return nil, fmt.Errorf("could not get a PTY: %s", err)
+	}
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.Shell(); err != nil {
+		return nil, fmt.Errorf("could not start a shell: %s", err)
+	}
+
+	s := newShellIO(stdin, stdout, sess)
+	if err := s.start(ctx, enable); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// start waits for the prompt, enters enable mode if enable is set and turns off paging.
+func (s *shell) start(ctx context.Context, enable string) error {
+	out, err := s.readUntil(ctx, anyPrompt)
+	if err != nil {
+		return fmt.Errorf("did not find the CLI prompt: %w", err)
+	}
+	m := anyPrompt.FindStringSubmatch(out)
+	s.prompt = regexp.MustCompile(`(?:^|\n)` + regexp.QuoteMeta(m[1]) + `(?:\([\w.\-/]+\))?[>#$%] ?$`)
+
+	if enable != "" && strings.HasSuffix(strings.TrimSpace(out), ">") {
+		if err := s.enable(ctx, enable); err != nil {
+			return err
+		}
+	}
+
+	// Not every device has this command, those that don't are caught by morePrompt.
+	if _, err := s.command(ctx, "terminal length 0"); err != nil && ctx.Err() != nil {
+		return err
+	}
+	return nil
+}
+
+// read sends what the device sends us to s.reads until the shell ends.
+func (s *shell) read(r io.Reader) {
+	defer close(s.reads)
+	for {
+		b := make([]byte, 4096)
+		n, err := r.Read(b)
+		if n > 0 {
+			select {
+			case s.reads <- b[:n]:
+			case <-s.done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readUntil reads until the output ends with a match for re and returns the output,
+// with carriage returns and backspaces removed.
+func (s *shell) readUntil(ctx context.Context, re *regexp.Regexp) (string, error) {
+	for {
+		if loc := re.FindIndex(s.buf); loc != nil {
+			out := string(s.buf[:loc[1]])
+			s.buf = s.buf[loc[1]:]
+			return out, nil
+		}
+		if loc := morePrompt.FindIndex(s.buf); loc != nil {
+			s.buf = append(s.buf[:loc[0]], '\n')
+			if _, err := io.WriteString(s.stdin, " "); err != nil {
+				return "", err
+			}
+		}
+
+		select {
+		case b, ok := <-s.reads:
+			if !ok {
+				return "", fmt.Errorf("shell closed, last output was: %q", tail(s.buf))
+			}
+			b = bytes.ReplaceAll(b, []byte("\r"), nil)
+			b = bytes.ReplaceAll(b, []byte("\b"), nil)
+			s.buf = append(s.buf, b...)
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// enable enters privileged mode with secret.
+func (s *shell) enable(ctx context.Context, secret string) error {
+	if _, err := io.WriteString(s.stdin, "enable\n"); err != nil {
+		return err
+	}
+	either := regexp.MustCompile(passwordPrompt.String() + "|" + s.prompt.String())
+	out, err := s.readUntil(ctx, either)
+	if err != nil {
+		return fmt.Errorf("problem entering enable mode: %w", err)
+	}
+	if passwordPrompt.MatchString(out) {
+		if _, err := io.WriteString(s.stdin, secret+"\n"); err != nil {
+			return err
+		}
+		out, err = s.readUntil(ctx, either)
+		if err != nil {
+			return fmt.Errorf("problem entering enable mode: %w", err)
+		}
+	}
+	if !strings.HasSuffix(strings.TrimSpace(out), "#") {
+		return fmt.Errorf("enable secret was not accepted")
+	}
+	return nil
+}
+
+// command runs cmd and returns its output, without the echoed command and the prompt.
+func (s *shell) command(ctx context.Context, cmd string) ([]byte, error) {
+	if _, err := io.WriteString(s.stdin, cmd+"\n"); err != nil {
+		return nil, err
+	}
+	out, err := s.readUntil(ctx, s.prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(out, "\n")
+	// The last line is the prompt.
+	lines = lines[:len(lines)-1]
+	if len(lines) > 0 && strings.Contains(lines[0], cmd) {
+		lines = lines[1:]
+	}
+	b := []byte(strings.Join(lines, "\n"))
+
+	for _, l := range lines {
+		for _, e := range cliErrors {
+			if strings.HasPrefix(strings.TrimSpace(l), e) {
+				return b, fmt.Errorf("device rejected command: %s", strings.TrimSpace(l))
+			}
+		}
+	}
+	return b, nil
+}
+
+// combinedOutput implements session.combinedOutput().
+func (s *shell) combinedOutput(ctx context.Context, cmd string) ([]byte, error) {
+	b, err := s.command(ctx, cmd)
+	if ctx.Err() != nil {
+		s.close()
+		return nil, ctx.Err()
+	}
+	return b, err
+}
+
+// close implements session.close().
+func (s *shell) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.closer.Close()
+	})
+}
+
+// tail returns the end of b, for error messages.
+func tail(b []byte) []byte {
+	if len(b) > 80 {
+		return b[len(b)-80:]
+	}
+	return b
+}
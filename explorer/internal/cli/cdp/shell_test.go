@@ -0,0 +1,191 @@
+package cdp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"golang.org/x/crypto/ssh"
+)
+
+// shellDevice simulates the CLI of an old IOS device that only answers CDP in enable mode.
+type shellDevice struct {
+	// secret is the enable secret.
+	secret string
+	// exec is if the device allows exec requests. They are always run unprivileged.
+	exec bool
+	// noTermLength makes the device not know "terminal length 0", so it pages output.
+	noTermLength bool
+}
+
+func (d shellDevice) handler(newCh ssh.NewChannel) {
+	if newCh.ChannelType() != "session" {
+		newCh.Reject(ssh.UnknownChannelType, "only session is supported")
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			req.Reply(true, nil)
+		case "exec":
+			req.Reply(d.exec, nil)
+			if d.exec {
+				io.WriteString(ch, "% Invalid input detected at '^' marker.\n")
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+				return
+			}
+		case "shell":
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(reqs)
+			d.shell(ch)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (d shellDevice) shell(ch io.ReadWriter) {
+	r := bufio.NewReader(ch)
+	enabled := false
+	paging := !d.noTermLength
+	prompt := func() string {
+		if enabled {
+			return "Switch#"
+		}
+		return "Switch>"
+	}
+
+	io.WriteString(ch, "\r\n\r\n#######\r\n# Authorized access only #\r\n#######\r\n\r\n"+prompt())
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		io.WriteString(ch, cmd+"\r\n")
+
+		switch {
+		case cmd == "enable":
+			io.WriteString(ch, "Password: ")
+			secret, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.TrimSpace(secret) == d.secret {
+				enabled = true
+			} else {
+				io.WriteString(ch, "% Access denied\r\n\r\n")
+			}
+		case cmd == "terminal length 0" && !d.noTermLength:
+			paging = false
+		case cmd == "show cdp neighbors detail" && enabled:
+			out := strings.ReplaceAll(cdpOutput, "\n", "\r\n")
+			if paging {
+				i := strings.Index(out, "Platform:")
+				io.WriteString(ch, out[:i]+" --More-- ")
+				if _, err := r.ReadByte(); err != nil {
+					return
+				}
+				out = "\b\b\b\b\b\b\b\b\b\b          \b\b\b\b\b\b\b\b\b\b" + out[i:]
+			}
+			io.WriteString(ch, out)
+		case cmd == "":
+		default:
+			io.WriteString(ch, "                 ^\r\n% Invalid input detected at '^' marker.\r\n\r\n")
+		}
+		io.WriteString(ch, prompt())
+	}
+}
+
+func TestShell(t *testing.T) {
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	tests := []struct {
+		desc    string
+		device  shellDevice
+		conn    Conn
+		wantErr bool
+	}{
+		{
+			desc:   "Shell with enable",
+			device: shellDevice{secret: "secret"},
+			conn:   Conn{Config: config, Session: SessionShell, EnableSecret: "secret"},
+		},
+		{
+			desc:    "Shell with bad enable secret",
+			device:  shellDevice{secret: "secret"},
+			conn:    Conn{Config: config, Session: SessionShell, EnableSecret: "wrong"},
+			wantErr: true,
+		},
+		{
+			desc:   "Shell that pages output",
+			device: shellDevice{secret: "secret", noTermLength: true},
+			conn:   Conn{Config: config, Session: SessionShell, EnableSecret: "secret"},
+		},
+		{
+			desc:    "Exec is rejected",
+			device:  shellDevice{secret: "secret"},
+			conn:    Conn{Config: config, EnableSecret: "secret"},
+			wantErr: true,
+		},
+		{
+			desc:   "Auto falls back to shell",
+			device: shellDevice{secret: "secret"},
+			conn:   Conn{Config: config, Session: SessionAuto, EnableSecret: "secret"},
+		},
+		{
+			// The device runs exec, but not with privileges. That is an answer, so no fallback.
+			desc:    "Auto does not fall back on unprivileged exec",
+			device:  shellDevice{secret: "secret", exec: true},
+			conn:    Conn{Config: config, Session: SessionAuto, EnableSecret: "secret"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		device := newTestServer(t, test.device.handler)
+		conn := test.conn
+		conn.Port = device.port
+
+		d, err := New(func(*network.Node) []Conn { return []Conn{conn} }, WithCommandTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("TestShell(%s): New() had error: %s", test.desc, err)
+		}
+
+		node := &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}
+		err = d.Node(context.Background(), node)
+		device.close()
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestShell(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestShell(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		n := node.Neighbors["FastEthernet0/12"]
+		if n == nil || n.DeviceID != "Switch2" || n.Type != "cisco WS-C2950-12" {
+			t.Errorf("TestShell(%s): did not get the neighbor from the device, got %v", test.desc, node.Neighbors)
+		}
+	}
+}
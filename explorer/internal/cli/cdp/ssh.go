@@ -8,21 +8,102 @@ objects. This can be changed during tests to fakes that just do what are asked o
 */
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 var fakeMap map[string]interface{}
 
-// dialer provides the function for dialing an SSH server. Public to allow tests to switch out.
-var dialer = func(node string, config *ssh.ClientConfig) (client, error) {
-	real, err := ssh.Dial("tcp", node, config)
+// dialer provides the function for dialing a device. Public to allow tests to switch out.
+// addr is the host:port to dial, see net.JoinHostPort(). The connection is made with
+// SSH, or telnet if c.Transport says so.
+// c.Config.Timeout bounds the TCP connect and the login together. Cancelling ctx aborts either.
+var dialer = func(ctx context.Context, addr string, c Conn) (client, error) {
+	if c.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Config.Timeout)
+		defer cancel()
+	}
+
+	if c.Transport == TransportTelnet {
+		return dialTelnet(ctx, addr, c)
+	}
+
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := handshake(ctx, conn, addr, c.Config, c.HostKeyAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+	if c.AgentSocket != "" {
+		// This only answers the device's requests for the agent, each session still has to
+		// ask for forwarding.
+		if err := agent.ForwardToRemote(sc, c.AgentSocket); err != nil {
+			sc.Close()
+			return nil, fmt.Errorf("could not forward ssh-agent: %s", err)
+		}
+	}
+	return sshClient{client: sc, forwardAgent: c.AgentSocket != ""}, nil
+}
+
+// dial makes the TCP connection to addr with c.Bastion if set, otherwise c.Dialer.
+func (c Conn) dial(ctx context.Context, addr string) (net.Conn, error) {
+	switch {
+	case c.Bastion != nil:
+		return c.Bastion.dial(ctx, addr)
+	case c.Dialer != nil:
+		return c.Dialer.DialContext(ctx, "tcp", addr)
+	}
+	d := net.Dialer{}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// handshake does the SSH handshake over conn, giving up when ctx is done. The caller sets
+// the deadline, so that it also covers making conn. If algos is set, config only accepts the
+// host key algorithms it returns for addr. conn is closed on error.
+func handshake(ctx context.Context, conn net.Conn, addr string, config *ssh.ClientConfig, algos HostKeyAlgorithms) (*ssh.Client, error) {
+	if algos != nil {
+		if a := algos(addr); len(a) > 0 {
+			c := *config
+			c.HostKeyAlgorithms = a
+			config = &c
+		}
+	}
+
+	// The SSH handshake does not take a Context and tunneled connections don't support
+	// deadlines, so we close the connection out from under it if it takes too long.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	close(done)
 	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("SSH handshake with %s: %w", addr, ctx.Err())
+		}
 		return nil, err
 	}
+	if ctx.Err() != nil {
+		c.Close()
+		return nil, fmt.Errorf("SSH handshake with %s: %w", addr, ctx.Err())
+	}
 
-	return sshClient{client: real}, nil
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
 type conn interface {
@@ -30,13 +111,19 @@ type conn interface {
 }
 
 type session interface {
-	combinedOutput(cmd string) ([]byte, error)
+	// combinedOutput runs cmd and returns stdout and stderr. If ctx is cancelled, the
+	// session is closed and ctx.Err() is returned.
+	combinedOutput(ctx context.Context, cmd string) ([]byte, error)
 	close()
 }
 
 type client interface {
 	conn() conn
+	// newSession returns a session that runs commands with exec requests.
 	newSession() (session, error)
+	// newShell returns a session that runs commands on an interactive shell, in enable
+	// mode if enable is set. ctx bounds how long setting up the shell may take.
+	newShell(ctx context.Context, enable string) (session, error)
 }
 
 // sshConn implements conn using the SSH library's Conn object.
@@ -55,8 +142,25 @@ type sshSession struct {
 }
 
 // combinedOutput implements session.combinedOutput().
-func (s sshSession) combinedOutput(cmd string) ([]byte, error) {
-	return s.session.CombinedOutput(cmd)
+func (s sshSession) combinedOutput(ctx context.Context, cmd string) ([]byte, error) {
+	type result struct {
+		b   []byte
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		b, err := s.session.CombinedOutput(cmd)
+		ch <- result{b, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.b, r.err
+	case <-ctx.Done():
+		s.session.Close()
+		return nil, ctx.Err()
+	}
 }
 
 func (s sshSession) close() {
@@ -65,6 +169,8 @@ func (s sshSession) close() {
 
 type sshClient struct {
 	client *ssh.Client
+	// forwardAgent is set if sessions should ask for the ssh-agent to be forwarded.
+	forwardAgent bool
 }
 
 func (s sshClient) conn() conn {
@@ -76,20 +182,42 @@ func (s sshClient) newSession() (session, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.requestAgent(real)
 
 	return sshSession{session: real}, nil
 }
 
+// requestAgent asks for the ssh-agent to be forwarded to sess, if forwarding is on. Like
+// OpenSSH, a device that refuses only gets a warning.
+func (s sshClient) requestAgent(sess *ssh.Session) {
+	if !s.forwardAgent {
+		return
+	}
+	if err := agent.RequestAgentForwarding(sess); err != nil {
+		log.Printf("ssh-agent forwarding was refused by %s: %s", s.client.RemoteAddr(), err)
+	}
+}
+
 // FakeDialer converts our internal dialer to return the value in outputMap (either a string or error)
-// when dial is called for key. If dialer tries to dial a key that doesn't exist, it gets an error as well.
+// when dial is called for key. Keys are either "host:port" or just the host, which matches
+// any port. The value may also be a map[string]interface{} of command to
+// string or error, for nodes that need to answer different commands. If dialer tries to dial a key
+// that doesn't exist, it gets an error as well.
 func FakeDialer(outputMap map[string]interface{}) {
 	fakeMap = outputMap
 
-	dialer = func(node string, config *ssh.ClientConfig) (client, error) {
-		if _, ok := fakeMap[node]; !ok {
-			return nil, fmt.Errorf("could not connect to node %s", node)
+	dialer = func(ctx context.Context, addr string, c Conn) (client, error) {
+		if _, ok := fakeMap[addr]; ok {
+			return fakeClient{ipStr: addr}, nil
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fakeMap[host]; !ok {
+			return nil, fmt.Errorf("could not connect to node %s", addr)
 		}
-		return fakeClient{ipStr: node}, nil
+		return fakeClient{ipStr: host}, nil
 	}
 }
 
@@ -102,8 +230,18 @@ type fakeSession struct {
 }
 
 // combinedOutput implements session.combinedOutput().
-func (s fakeSession) combinedOutput(cmd string) ([]byte, error) {
+func (s fakeSession) combinedOutput(ctx context.Context, cmd string) ([]byte, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	out := fakeMap[s.ipStr]
+	if m, ok := out.(map[string]interface{}); ok {
+		out, ok = m[cmd]
+		if !ok {
+			return []byte("% Invalid input detected at '^' marker."), fmt.Errorf("Process exited with status 1")
+		}
+	}
 	switch v := out.(type) {
 	case string:
 		return []byte(v), nil
@@ -127,3 +265,7 @@ func (fakeClient) conn() conn {
 func (s fakeClient) newSession() (session, error) {
 	return fakeSession{ipStr: s.ipStr}, nil
 }
+
+func (s fakeClient) newShell(ctx context.Context, enable string) (session, error) {
+	return fakeSession{ipStr: s.ipStr}, nil
+}
@@ -0,0 +1,276 @@
+package cdp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// redirectDialer connects to to no matter what address is dialed, like a proxy would, and
+// records the addresses it was asked for.
+type redirectDialer struct {
+	to string
+
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (r *redirectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	r.mu.Lock()
+	r.dialed = append(r.dialed, addr)
+	r.mu.Unlock()
+
+	d := net.Dialer{}
+	return d.DialContext(ctx, network, r.to)
+}
+
+func TestConnDialer(t *testing.T) {
+	device := newTestServer(t, deviceHandler)
+	defer device.close()
+
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+	rd := &redirectDialer{to: device.addr}
+
+	d, err := New(func(*network.Node) []Conn { return []Conn{{Config: config, Dialer: rd}} })
+	if err != nil {
+		t.Fatalf("TestConnDialer: New() had error: %s", err)
+	}
+
+	// This address isn't reachable, only the Dialer can get us to the device.
+	node := &network.Node{IP: net.ParseIP("192.0.2.1"), Type: "RootNode"}
+	if err := d.Node(context.Background(), node); err != nil {
+		t.Fatalf("TestConnDialer: Node() had error: %s", err)
+	}
+	if n := node.Neighbors["FastEthernet0/12"]; n == nil || n.DeviceID != "Switch2" {
+		t.Errorf("TestConnDialer: did not get the neighbor from the device, got %v", node.Neighbors)
+	}
+	if len(rd.dialed) != 1 || rd.dialed[0] != "192.0.2.1:22" {
+		t.Errorf("TestConnDialer: Dialer was asked for %v, want [192.0.2.1:22]", rd.dialed)
+	}
+}
+
+// slowDialer connects to to after delay, like a slow proxy.
+type slowDialer struct {
+	to    string
+	delay time.Duration
+}
+
+func (s slowDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delay):
+	}
+	d := net.Dialer{}
+	return d.DialContext(ctx, network, s.to)
+}
+
+// TestDialTimeout tests that Timeout bounds the connect and the handshake together, not each.
+func TestDialTimeout(t *testing.T) {
+	// The device accepts connections, but never starts the SSH handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	const timeout = time.Second
+	c := Conn{
+		Config: &ssh.ClientConfig{
+			User:            "user",
+			Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         timeout,
+		},
+		Dialer: slowDialer{to: l.Addr().String(), delay: 800 * time.Millisecond},
+	}
+
+	start := time.Now()
+	if _, err := dialer(context.Background(), "192.0.2.1:22", c); err == nil {
+		t.Fatalf("TestDialTimeout: got err == nil, want err != nil")
+	}
+	if took := time.Since(start); took > timeout+timeout/2 {
+		t.Errorf("TestDialTimeout: took %s, want about %s", took, timeout)
+	}
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	device := newTestServer(t, deviceHandler)
+	defer device.close()
+
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	tests := []struct {
+		desc    string
+		algos   HostKeyAlgorithms
+		wantErr bool
+	}{
+		{desc: "Not set"},
+		{desc: "Nothing known", algos: func(string) []string { return nil }},
+		{desc: "Device's key", algos: func(string) []string { return []string{ssh.KeyAlgoED25519} }},
+		// The device only has an ed25519 key.
+		{desc: "Another key", algos: func(string) []string { return []string{ssh.KeyAlgoRSASHA256} }, wantErr: true},
+	}
+
+	for _, test := range tests {
+		conn := Conn{Config: config, Port: device.port, HostKeyAlgorithms: test.algos}
+		d, err := New(func(*network.Node) []Conn { return []Conn{conn} })
+		if err != nil {
+			t.Fatalf("TestHostKeyAlgorithms(%s): New() had error: %s", test.desc, err)
+		}
+		node := &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}
+		err = d.Node(context.Background(), node)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestHostKeyAlgorithms(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestHostKeyAlgorithms(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
+
+// agentHandler answers "show cdp neighbors detail" with cdpOutput, but only if the session
+// asked for the ssh-agent and the device can list a key in it.
+func agentHandler(sc *ssh.ServerConn, newCh ssh.NewChannel) {
+	if newCh.ChannelType() != "session" {
+		newCh.Reject(ssh.UnknownChannelType, "only session is supported")
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	forwarded := false
+	for req := range reqs {
+		switch req.Type {
+		case "auth-agent-req@openssh.com":
+			forwarded = true
+			req.Reply(true, nil)
+			continue
+		case "exec":
+		default:
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		status := uint32(1)
+		if forwarded {
+			agentCh, agentReqs, err := sc.OpenChannel("auth-agent@openssh.com", nil)
+			if err == nil {
+				go ssh.DiscardRequests(agentReqs)
+				keys, err := agent.NewClient(agentCh).List()
+				agentCh.Close()
+				if err == nil && len(keys) == 1 {
+					io.WriteString(ch, cdpOutput)
+					status = 0
+				}
+			}
+		}
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func TestAgentForwarding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	device := newTestServerConn(t, agentHandler)
+	defer device.close()
+
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	tests := []struct {
+		desc    string
+		conn    Conn
+		wantErr bool
+	}{
+		{desc: "Forwarded", conn: Conn{Config: config, Port: device.port, AgentSocket: sock}},
+		{desc: "Not forwarded", conn: Conn{Config: config, Port: device.port}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		conn := test.conn
+		d, err := New(func(*network.Node) []Conn { return []Conn{conn} }, WithCommandTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("TestAgentForwarding(%s): New() had error: %s", test.desc, err)
+		}
+		node := &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}
+		err = d.Node(context.Background(), node)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestAgentForwarding(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestAgentForwarding(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package statemachine
+
+import (
+	"context"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/johnsiilver/halfpike"
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// LLDP is a statemachine for using a halfpike.Parser to extract LLDP neighbor data from text
+// into a Node. It understands the "detail" neighbor output of Cisco IOS/NX-OS, Arista EOS,
+// HP/Aruba ProCurve ("show lldp info remote-device detail") and Juniper Junos.
+// This is used in a halfpike.Parse() and not intended to run on its own.
+type LLDP struct {
+	node    *network.Node
+	current *lldpNeighbor
+	// hint is the local interface announced before a group of neighbors (Arista).
+	hint       string
+	foundNeigh bool
+}
+
+// lldpNeighbor holds what we know about a neighbor while we are reading its record.
+type lldpNeighbor struct {
+	local    string
+	chassis  string
+	portID   string
+	sysName  string
+	sysDesc  string
+	addrs    []net.IP
+	hasField bool
+}
+
+var (
+	// aristaInterface matches "Interface Ethernet1 detected 1 LLDP neighbors:".
+	aristaInterface = regexp.MustCompile(`^Interface\s+(\S+)\s+detected\s+\d+\s+LLDP\s+neighbors`)
+	// aristaNeighbor matches "Neighbor 001c.7300.0001/Ethernet1, age 3 seconds".
+	aristaNeighbor = regexp.MustCompile(`^Neighbor\s+\S+,\s+age`)
+)
+
+// Normalized keys (see splitKey()) that we care about, grouped by what they mean.
+var (
+	// lldpLocalStart are keys giving the local interface that also start a neighbor record.
+	lldpLocalStart = map[string]bool{"local intf": true, "local interface": true, "local port": true}
+	// lldpLocal are keys giving the local interface inside a record (NX-OS).
+	lldpLocal    = map[string]bool{"local port id": true}
+	lldpChassis  = map[string]bool{"chassis id": true, "chassisid": true}
+	lldpPortID   = map[string]bool{"port id": true, "portid": true}
+	lldpSysName  = map[string]bool{"system name": true, "sysname": true}
+	lldpSysDesc  = map[string]bool{"system description": true, "system descr": true}
+	lldpMgmtAddr = map[string]bool{
+		"ip":                      true,
+		"ipv6":                    true,
+		"management address":      true,
+		"management address ipv6": true,
+		"address":                 true,
+	}
+)
+
+// Start starts the statemachine through the text.
+func (l *LLDP) Start(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
+	l.node = p.Validator.(*network.Node)
+	return l.findNeighbor
+}
+
+// findNeighbor skips lines until we find the start of a neighbor record.
+func (l *LLDP) findNeighbor(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
+	for {
+		line := p.Next()
+		if p.EOF(line) {
+			if l.foundNeigh {
+				return nil
+			}
+			return p.Errorf("did not find any LLDP neighbors listed")
+		}
+
+		if m := aristaInterface.FindStringSubmatch(strings.TrimSpace(line.Raw)); m != nil {
+			l.hint = m[1]
+			continue
+		}
+		if l.isStart(line.Raw) {
+			p.Backup()
+			return l.neighbor
+		}
+	}
+}
+
+// neighbor reads the fields of a neighbor record until the next record starts.
+func (l *LLDP) neighbor(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
+	l.foundNeigh = true
+	l.current = &lldpNeighbor{local: l.hint}
+
+	for first := true; ; first = false {
+		line := p.Next()
+		if p.EOF(line) {
+			l.store()
+			return nil
+		}
+
+		if !first && (aristaInterface.MatchString(strings.TrimSpace(line.Raw)) || l.isStart(line.Raw)) {
+			p.Backup()
+			l.store()
+			return l.findNeighbor
+		}
+
+		key, val, ok := splitKey(line.Raw)
+		if !ok {
+			continue
+		}
+		cur := l.current
+
+		switch {
+		case lldpLocalStart[key]:
+			cur.local = val
+		case lldpLocal[key]:
+			if cur.local == "" {
+				cur.local = val
+			}
+		case lldpChassis[key]:
+			cur.chassis = val
+			cur.hasField = true
+		case lldpPortID[key]:
+			cur.portID = val
+		case lldpSysName[key]:
+			cur.sysName = val
+			cur.hasField = true
+		case lldpSysDesc[key]:
+			if val == "" {
+				// IOS puts the description on the lines following the key.
+				next := p.Next()
+				if p.EOF(next) || strings.TrimSpace(next.Raw) == "" {
+					p.Backup()
+					continue
+				}
+				val = strings.TrimSpace(next.Raw)
+			}
+			cur.sysDesc = val
+		case lldpMgmtAddr[key]:
+			if ip := net.ParseIP(val); ip != nil {
+				cur.addrs = append(cur.addrs, ip)
+				cur.hasField = true
+			}
+		}
+	}
+}
+
+// isStart determines if raw starts a new neighbor record.
+func (l *LLDP) isStart(raw string) bool {
+	if aristaNeighbor.MatchString(strings.TrimSpace(raw)) {
+		return true
+	}
+	key, _, ok := splitKey(raw)
+	if !ok {
+		return false
+	}
+	if lldpLocalStart[key] {
+		return true
+	}
+	// NX-OS records begin with the Chassis id, others have it inside the record.
+	if lldpChassis[key] {
+		return l.current == nil || l.current.chassis != ""
+	}
+	return false
+}
+
+// store adds the current neighbor to our node.
+func (l *LLDP) store() {
+	cur := l.current
+	l.current = nil
+
+	if cur == nil || !cur.hasField {
+		return
+	}
+	if cur.local == "" {
+		log.Println("saw an LLDP neighbor, but not what interface it was on")
+		return
+	}
+	if len(cur.addrs) == 0 {
+		log.Println("saw an LLDP neighbor, but no IP listed")
+		return
+	}
+
+	ip := network.PreferredIP(cur.addrs, false)
+
+	platform := strings.TrimRight(cur.sysDesc, ",")
+	if platform == "" {
+		platform = cur.sysName
+	}
+	if platform == "" {
+		platform = "unknown"
+	}
+
+	inter := network.NodeInterface(cur.local)
+	l.node.SetNeighbor(inter, &network.Node{IP: ip, IPs: cur.addrs, Type: platform, DeviceID: cur.sysName, ChassisID: cur.chassis})
+	l.node.SetLinkDetail(inter, &network.LinkDetail{Protocol: network.ProtoLLDP, RemoteInterface: network.NodeInterface(cur.portID)})
+}
+
+// splitKey splits a "Key: value" line into a normalized (lower case, single spaced) key and
+// its value with any quotes removed.
+func splitKey(raw string) (key, val string, ok bool) {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "- ")
+
+	i := strings.Index(raw, ":")
+	if i < 1 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.Join(strings.Fields(raw[:i]), " "))
+	val = strings.Trim(strings.TrimSpace(raw[i+1:]), `"`)
+	return key, val, true
+}
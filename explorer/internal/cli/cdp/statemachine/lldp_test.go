@@ -0,0 +1,304 @@
+package statemachine
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/johnsiilver/netcrawl/network"
+
+	"github.com/johnsiilver/halfpike"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestLLDP(t *testing.T) {
+	tests := []struct {
+		desc   string
+		output string
+		want   map[network.NodeInterface]*network.Node
+		// wantRemote, if set, is the remote interface we want for each local interface.
+		wantRemote map[network.NodeInterface]network.NodeInterface
+		wantErr    bool
+	}{
+		{
+			desc: "Cisco IOS",
+			output: `
+Capability codes:
+    (R) Router, (B) Bridge, (T) Telephone, (C) DOCSIS Cable Device
+    (W) WLAN Access Point, (P) Repeater, (S) Station, (O) Other
+
+------------------------------------------------
+Local Intf: Gi1/0/1
+Chassis id: 0026.9876.5432
+Port id: Gi0/1
+Port Description: GigabitEthernet0/1
+System Name: switch2.example.com
+
+System Description:
+Cisco IOS Software, C3750 Software (C3750-IPSERVICESK9-M), Version 12.2(55)SE, RELEASE SOFTWARE (fc2)
+Technical Support: http://www.cisco.com/techsupport
+Copyright (c) 1986-2010 by Cisco Systems, Inc.
+
+Time remaining: 112 seconds
+System Capabilities: B,R
+Enabled Capabilities: B
+Management Addresses:
+    IP: 10.1.1.2
+Auto Negotiation - supported, enabled
+Physical media capabilities:
+    1000baseT(FD)
+Media Attachment Unit type: 30
+Vlan ID: 1
+
+------------------------------------------------
+Local Intf: Gi1/0/2
+Chassis id: 0026.9876.0001
+Port id: 0026.9876.0001
+Port Description - not advertised
+System Name - not advertised
+
+System Description - not advertised
+
+Time remaining: 100 seconds
+System Capabilities: T
+Enabled Capabilities: T
+Management Addresses - not advertised
+
+Total entries displayed: 2
+`,
+			want: map[network.NodeInterface]*network.Node{
+				"Gi1/0/1": &network.Node{
+					IP:        net.ParseIP("10.1.1.2"),
+					IPs:       []net.IP{net.ParseIP("10.1.1.2")},
+					Type:      "Cisco IOS Software, C3750 Software (C3750-IPSERVICESK9-M), Version 12.2(55)SE, RELEASE SOFTWARE (fc2)",
+					DeviceID:  "switch2.example.com",
+					ChassisID: "0026.9876.5432",
+				},
+			},
+		},
+		{
+			desc: "Cisco NX-OS",
+			output: `
+Capability codes:
+  (R) Router, (B) Bridge, (T) Telephone, (C) DOCSIS Cable Device
+Chassis id: 0022.bdd2.ab01
+Port id: Ethernet1/1
+Local Port id: Eth1/49
+Port Description: to-n9k-1
+System Name: n9k-2
+System Description: Cisco Nexus Operating System (NX-OS) Software 7.0(3)I7(6)
+Time remaining: 98 seconds
+System Capabilities: B, R
+Enabled Capabilities: B, R
+Management Address: 10.1.1.3
+Management Address IPV6: not advertised
+Vlan ID: 1
+
+Chassis id: 0022.bdd2.ab02
+Port id: Ethernet1/2
+Local Port id: Eth1/50
+Port Description: to-n9k-1
+System Name: n9k-3
+System Description: Cisco Nexus Operating System (NX-OS) Software 7.0(3)I7(6)
+Time remaining: 98 seconds
+System Capabilities: B, R
+Enabled Capabilities: B, R
+Management Address: 10.1.1.4
+Vlan ID: 1
+
+Total entries displayed: 2
+`,
+			want: map[network.NodeInterface]*network.Node{
+				"Eth1/49": &network.Node{
+					IP:        net.ParseIP("10.1.1.3"),
+					IPs:       []net.IP{net.ParseIP("10.1.1.3")},
+					Type:      "Cisco Nexus Operating System (NX-OS) Software 7.0(3)I7(6)",
+					DeviceID:  "n9k-2",
+					ChassisID: "0022.bdd2.ab01",
+				},
+				"Eth1/50": &network.Node{
+					IP:        net.ParseIP("10.1.1.4"),
+					IPs:       []net.IP{net.ParseIP("10.1.1.4")},
+					Type:      "Cisco Nexus Operating System (NX-OS) Software 7.0(3)I7(6)",
+					DeviceID:  "n9k-3",
+					ChassisID: "0022.bdd2.ab02",
+				},
+			},
+			wantRemote: map[network.NodeInterface]network.NodeInterface{
+				"Eth1/49": "Ethernet1/1",
+				"Eth1/50": "Ethernet1/2",
+			},
+		},
+		{
+			desc: "Arista EOS",
+			output: `
+Interface Ethernet1 detected 1 LLDP neighbors:
+
+  Neighbor 001c.7300.0001/Ethernet1, age 3 seconds
+  Discovered 1 day, 2:03:04 ago; Last changed 1 day, 2:03:01 ago
+  - Chassis ID type: MAC address (4)
+    Chassis ID     : 001c.7300.0001
+  - Port ID type: Interface name (5)
+    Port ID     : "Ethernet1"
+  - Time To Live: 120 seconds
+  - Port Description: "to-leaf1"
+  - System Name: "spine1"
+  - System Description: "Arista Networks EOS version 4.20.1F running on an Arista Networks DCS-7050TX-64"
+  - System Capabilities : Bridge, Router
+    Enabled Capabilities: Bridge, Router
+  - Management Address Subtype: IPv4 (1)
+    Management Address        : 10.0.0.1
+    Interface Number Subtype  : ifIndex (2)
+    Interface Number          : 999001
+    OID String                :
+
+Interface Ethernet2 detected 0 LLDP neighbors:
+
+Interface Ethernet3 detected 1 LLDP neighbors:
+
+  Neighbor 001c.7300.0002/Ethernet1, age 3 seconds
+  - Chassis ID type: MAC address (4)
+    Chassis ID     : 001c.7300.0002
+  - Port ID type: Interface name (5)
+    Port ID     : "Ethernet1"
+  - System Name: "spine2"
+  - System Description: "Arista Networks EOS version 4.20.1F running on an Arista Networks DCS-7050TX-64"
+  - Management Address Subtype: IPv6 (2)
+    Management Address        : 2001:db8::2
+`,
+			want: map[network.NodeInterface]*network.Node{
+				"Ethernet1": &network.Node{
+					IP:        net.ParseIP("10.0.0.1"),
+					IPs:       []net.IP{net.ParseIP("10.0.0.1")},
+					Type:      "Arista Networks EOS version 4.20.1F running on an Arista Networks DCS-7050TX-64",
+					DeviceID:  "spine1",
+					ChassisID: "001c.7300.0001",
+				},
+				"Ethernet3": &network.Node{
+					IP:        net.ParseIP("2001:db8::2"),
+					IPs:       []net.IP{net.ParseIP("2001:db8::2")},
+					Type:      "Arista Networks EOS version 4.20.1F running on an Arista Networks DCS-7050TX-64",
+					DeviceID:  "spine2",
+					ChassisID: "001c.7300.0002",
+				},
+			},
+		},
+		{
+			desc: "HP/Aruba ProCurve",
+			output: `
+ LLDP Remote Device Information Detail
+
+  Local Port   : 23
+  ChassisType  : mac-address
+  ChassisId    : 00 1c 73 00 00 01
+  PortType     : local
+  PortId       : 23
+  SysName      : switch2
+  System Descr : HP J9773A 2530-24G-PoEP Switch, revision YA.16.02.0012, ROM YA.15.20
+  PortDescr    : 23
+
+  System Capabilities Supported  : bridge
+  System Capabilities Enabled    : bridge
+
+  Remote Management Address
+     Type    : ipv4
+     Address : 10.2.2.2
+`,
+			want: map[network.NodeInterface]*network.Node{
+				"23": &network.Node{
+					IP:        net.ParseIP("10.2.2.2"),
+					IPs:       []net.IP{net.ParseIP("10.2.2.2")},
+					Type:      "HP J9773A 2530-24G-PoEP Switch, revision YA.16.02.0012, ROM YA.15.20",
+					DeviceID:  "switch2",
+					ChassisID: "00 1c 73 00 00 01",
+				},
+			},
+		},
+		{
+			desc: "Juniper Junos",
+			output: `
+LLDP Neighbor Information:
+Local Information:
+Index: 2 Time to live: 120 Time mark: Fri Jan 11 10:30:10 2019 Age: 22 secs
+Local Interface    : ge-0/0/0
+Parent Interface   : -
+Local Port ID      : 513
+Ageout Count       : 0
+
+Neighbour Information:
+Chassis type       : Mac address
+Chassis ID         : 00:1c:73:00:00:03
+Port type          : Mac address
+Port ID            : 00:1c:73:00:00:04
+Port description   : ge-0/0/1
+System name        : ex2300
+
+System Description : Juniper Networks, Inc. ex2300-24t Ethernet Switch, kernel JUNOS 18.4R2
+
+System capabilities
+        Supported  : Bridge Router
+        Enabled    : Bridge Router
+
+Management Information
+  Address Type     : IPv4(1)
+  Address          : 10.3.3.3
+`,
+			want: map[network.NodeInterface]*network.Node{
+				"ge-0/0/0": &network.Node{
+					IP:        net.ParseIP("10.3.3.3"),
+					IPs:       []net.IP{net.ParseIP("10.3.3.3")},
+					Type:      "Juniper Networks, Inc. ex2300-24t Ethernet Switch, kernel JUNOS 18.4R2",
+					DeviceID:  "ex2300",
+					ChassisID: "00:1c:73:00:00:03",
+				},
+			},
+		},
+		{
+			desc:    "Not LLDP output",
+			output:  "% Invalid input detected at '^' marker.\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		node := &network.Node{IP: net.ParseIP("192.168.0.1"), Type: "root node"}
+		parser, err := halfpike.NewParser(test.output, node)
+		if err != nil {
+			t.Fatalf("TestLLDP(%s): got err == %s", test.desc, err)
+		}
+
+		sm := &LLDP{}
+
+		err = halfpike.Parse(ctx, parser, sm.Start)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestLLDP(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestLLDP(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if diff := pretty.Compare(test.want, node.Neighbors); diff != "" {
+			t.Errorf("TestLLDP(%s): -want/+got:\n%s", test.desc, diff)
+		}
+
+		if test.wantRemote == nil {
+			continue
+		}
+		gotRemote := map[network.NodeInterface]network.NodeInterface{}
+		for inter, d := range node.LinkDetails {
+			if d.Protocol != network.ProtoLLDP {
+				t.Errorf("TestLLDP(%s): link on %s had Protocol %q, want %q", test.desc, inter, d.Protocol, network.ProtoLLDP)
+			}
+			gotRemote[inter] = d.RemoteInterface
+		}
+		if diff := pretty.Compare(test.wantRemote, gotRemote); diff != "" {
+			t.Errorf("TestLLDP(%s): remote interfaces -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
@@ -1,11 +1,13 @@
-// Package statemachine provides a statemachine for processing CDP information into our network.Node.
+// Package statemachine provides statemachines for processing CDP and LLDP information into our network.Node.
 package statemachine
 
 import (
 	"context"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/johnsiilver/halfpike"
 	"github.com/johnsiilver/netcrawl/network"
@@ -15,10 +17,29 @@ import (
 // This is used in a halfpike.Parse() and not intended to run on its own.
 type CDP struct {
 	node         *network.Node
-	current      *network.Node
+	current      *cdpNeighbor
 	foundDevices bool
 }
 
+// cdpNeighbor holds what we know about a neighbor while we are reading its entry.
+type cdpNeighbor struct {
+	node  *network.Node
+	local string
+	link  *network.LinkDetail
+	// entryIPs are the addresses under "Entry address(es)". IPv4 is preferred for the
+	// node's IP, the explorer may choose another based on its config.
+	entryIPs []net.IP
+}
+
+// addrSection is the address list we are reading.
+type addrSection int
+
+const (
+	noAddrs addrSection = iota
+	entryAddrs
+	mgmtAddrs
+)
+
 var deviceStart = []string{"Device", "ID:"}
 
 // Start starts the statemachine through the text.
@@ -28,82 +49,156 @@ func (c *CDP) Start(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
 }
 
 func (c *CDP) findDeviceID(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
-	c.current = &network.Node{}
-
-	_, err := p.FindStart(deviceStart)
-	if err != nil {
-		if c.foundDevices {
-			return nil
-		} else {
+	for {
+		line := p.Next()
+		if p.EOF(line) {
+			if c.foundDevices {
+				return nil
+			}
 			return p.Errorf("did not find any devices listed")
 		}
+		if isDeviceStart(line.Raw) {
+			p.Backup()
+			c.foundDevices = true
+			return c.device
+		}
 	}
-	c.foundDevices = true
-	return c.findIP
 }
 
-var ipAddr = []string{"IP", "address:"}
+// device reads a device's entry until the next device starts.
+func (c *CDP) device(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
+	c.current = &cdpNeighbor{node: &network.Node{}, link: &network.LinkDetail{Protocol: network.ProtoCDP}}
+	cur := c.current
+	section := noAddrs
 
-func (c *CDP) findIP(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
-	line, until, err := p.FindUntil(ipAddr, deviceStart)
-	if err != nil {
-		log.Println("saw a device, but no IP listed")
-		return nil
-	}
-	if until {
-		log.Println("saw a device, but no IP listed")
-		return c.findDeviceID
-	}
-	ipStr := halfpike.ItemJoin(line, 2, len(line.Items))
+	for first := true; ; first = false {
+		line := p.Next()
+		if p.EOF(line) {
+			c.store()
+			return nil
+		}
+		if !first && isDeviceStart(line.Raw) {
+			p.Backup()
+			c.store()
+			return c.findDeviceID
+		}
+
+		key, val, ok := splitKey(line.Raw)
+		if !ok {
+			continue
+		}
 
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return p.Errorf("found an IP Address: line, but couldn't decode IP(%s)", ipStr)
+		switch key {
+		case "entry address(es)", "interface address(es)":
+			section = entryAddrs
+			continue
+		case "management address(es)", "mgmt address(es)":
+			section = mgmtAddrs
+			continue
+		case "ip address", "ipv4 address", "ipv6 address":
+			ip := net.ParseIP(strings.Fields(val + " ")[0])
+			if ip == nil {
+				return p.Errorf("found an IP Address: line, but couldn't decode IP(%s)", val)
+			}
+			switch section {
+			case entryAddrs:
+				cur.entryIPs = append(cur.entryIPs, ip)
+			case mgmtAddrs:
+				cur.node.ManagementIPs = append(cur.node.ManagementIPs, ip)
+			}
+			continue
+		case "device id":
+			cur.node.DeviceID = val
+			cur.node.Serial = serial(val)
+		case "platform":
+			platform, capabilities := val, ""
+			if i := strings.Index(val, "Capabilities:"); i >= 0 {
+				platform, capabilities = val[:i], val[i+len("Capabilities:"):]
+			}
+			cur.node.Type = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(platform), ","))
+			cur.node.Capabilities = strings.Fields(capabilities)
+		case "interface":
+			local, remote := val, ""
+			if i := strings.Index(val, "Port ID (outgoing port):"); i >= 0 {
+				local, remote = val[:i], val[i+len("Port ID (outgoing port):"):]
+			}
+			cur.local = strings.TrimRight(strings.TrimSpace(local), ",")
+			cur.link.RemoteInterface = network.NodeInterface(strings.TrimSpace(remote))
+		case "holdtime":
+			if f := strings.Fields(val); len(f) > 0 {
+				if secs, err := strconv.Atoi(f[0]); err == nil {
+					cur.link.Holdtime = time.Duration(secs) * time.Second
+				}
+			}
+		case "version":
+			cur.node.Version = readVersion(p, val)
+		case "native vlan":
+			if vlan, err := strconv.Atoi(val); err == nil {
+				cur.link.NativeVLAN = vlan
+			}
+		case "duplex":
+			cur.link.Duplex = val
+		case "vtp management domain":
+			cur.node.VTPDomain = strings.Trim(val, "'")
+		}
+		section = noAddrs
 	}
-	c.current.IP = ip
-	return c.findPlatform
 }
 
-var platform = []string{"Platform:"}
-
-func (c *CDP) findPlatform(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
-	line, until, err := p.FindUntil(platform, deviceStart)
-	if err != nil {
-		return p.Errorf("could not find the platform for a device")
-	}
-	if until {
-		log.Println("saw a device, but Platform was not listed")
-		return c.findDeviceID
+// readVersion reads the software version, which starts on the line after "Version :" and
+// ends at the "advertisement version" line or a blank line.
+func readVersion(p *halfpike.Parser, val string) string {
+	if val != "" {
+		return val
 	}
 
-	platform := ""
-	for i, item := range line.Items {
-		if item.Val == "Capabilities:" {
-			platform = strings.TrimRight(halfpike.ItemJoin(line, 1, i), ",")
-			break
+	var lines []string
+	for {
+		line := p.Next()
+		raw := strings.TrimSpace(line.Raw)
+		if p.EOF(line) || raw == "" || strings.HasPrefix(strings.ToLower(raw), "advertisement version") || isDeviceStart(raw) {
+			p.Backup()
+			return strings.Join(lines, "\n")
 		}
+		lines = append(lines, raw)
 	}
-	if platform == "" {
-		return p.Errorf("could not find the Platform in line: %s", line.Raw)
-	}
-	c.current.Type = platform
-
-	return c.findInterface
 }
 
-var inter = []string{"Interface:", halfpike.Skip, "Port", "ID"}
+// store adds the current device to our node.
+func (c *CDP) store() {
+	cur := c.current
+	c.current = nil
 
-func (c *CDP) findInterface(ctx context.Context, p *halfpike.Parser) halfpike.ParseFn {
-	line, until, err := p.FindUntil(inter, deviceStart)
-	if err != nil {
-		return p.Errorf("could not find the interface for a device")
-	}
-	if until {
+	switch {
+	case len(cur.entryIPs) == 0:
+		log.Println("saw a device, but no IP listed")
+		return
+	case cur.node.Type == "":
+		log.Println("saw a device, but Platform was not listed")
+		return
+	case cur.local == "":
 		log.Println("saw a device, but not what interface it was on")
-		return c.findDeviceID
+		return
 	}
+	cur.node.IP = network.PreferredIP(cur.entryIPs, false)
+	cur.node.IPs = cur.entryIPs
 
-	i := strings.TrimRight(line.Items[1].Val, ",")
-	c.node.SetNeighbor(network.NodeInterface(i), c.current)
-	return c.findDeviceID
+	inter := network.NodeInterface(cur.local)
+	c.node.SetNeighbor(inter, cur.node)
+	c.node.SetLinkDetail(inter, cur.link)
+}
+
+// isDeviceStart determines if raw starts a new device entry. NX-OS doesn't put a space
+// after "Device ID:".
+func isDeviceStart(raw string) bool {
+	return strings.HasPrefix(strings.TrimSpace(raw), strings.Join(deviceStart, " "))
+}
+
+// serial returns the serial number from an NX-OS Device ID such as "switch(FDO12345678)".
+func serial(deviceID string) string {
+	i := strings.LastIndex(deviceID, "(")
+	if i < 1 || !strings.HasSuffix(deviceID, ")") {
+		return ""
+	}
+	return deviceID[i+1 : len(deviceID)-1]
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/johnsiilver/netcrawl/network"
 
@@ -76,20 +77,175 @@ Management address(es):
 
 	want := map[network.NodeInterface]*network.Node{
 		"FastEthernet0/12": &network.Node{
-			IP:   net.ParseIP("192.168.1.243"),
-			Type: "cisco WS-C2950-12",
+			IP:           net.ParseIP("192.168.1.243"),
+			IPs:          []net.IP{net.ParseIP("192.168.1.243")},
+			Type:         "cisco WS-C2950-12",
+			DeviceID:     "Switch2",
+			Capabilities: []string{"Trans-Bridge", "Switch"},
+			Version: "Cisco Internetwork Operating System Software\n" +
+				"IOS (tm) C2950 Software (C2950-C3H2S-M), Version 12.0(5.3)WC(1), MAINTENANCE INTERIM SOFTWARE\n" +
+				"Copyright (c) 1986-2001 by cisco Systems, Inc.\n" +
+				"Compiled Mon 30-Apr-01 07:56 by devgoyal",
 		},
 		"FastEthernet0/3": &network.Node{
-			IP:   net.ParseIP("192.168.1.240"),
-			Type: "Cisco 2621XM",
+			IP:           net.ParseIP("192.168.1.240"),
+			IPs:          []net.IP{net.ParseIP("192.168.1.240")},
+			Type:         "Cisco 2621XM",
+			DeviceID:     "Router2",
+			Capabilities: []string{"Switch", "IGMP"},
+			Version: "Cisco IOS Software, C2600 Software (C2600-ADVIPSERVICESK9-M), Version 12.3(4)T4,  RELEASE SOFTWARE (fc2)\n" +
+				"Technical Support: http://www.cisco.com/techsupport\n" +
+				"Copyright (c) 1986-2004 by Cisco Systems, Inc.\n" +
+				"Compiled Thu 11-Mar-04 19:57 by eaarmas",
 		},
 		"FastEthernet0/1": &network.Node{
-			IP:   net.ParseIP("192.168.1.103"),
-			Type: "AIR-AP350",
+			IP:       net.ParseIP("192.168.1.103"),
+			IPs:      []net.IP{net.ParseIP("192.168.1.103")},
+			Type:     "AIR-AP350",
+			DeviceID: "RootBridge.edtetz.net",
+			Version:  "Cisco 350 Series AP 12.03T",
 		},
 	}
 
 	if diff := pretty.Compare(want, node.Neighbors); diff != "" {
 		t.Fatalf("TestEndToEnd: -want/+got:\n%s", diff)
 	}
+
+	wantLinks := map[network.NodeInterface]*network.LinkDetail{
+		"FastEthernet0/12": {Protocol: network.ProtoCDP, RemoteInterface: "FastEthernet0/1", Holdtime: 137 * time.Second},
+		"FastEthernet0/3":  {Protocol: network.ProtoCDP, RemoteInterface: "FastEthernet0/0", Holdtime: 142 * time.Second, Duplex: "full"},
+		"FastEthernet0/1":  {Protocol: network.ProtoCDP, RemoteInterface: "fec0", Holdtime: 131 * time.Second, Duplex: "full"},
+	}
+	if diff := pretty.Compare(wantLinks, node.LinkDetails); diff != "" {
+		t.Fatalf("TestEndToEnd: links -want/+got:\n%s", diff)
+	}
+}
+
+func TestNXOS(t *testing.T) {
+	routerOutput := `
+Capability Codes: R - Router, T - Trans-Bridge, B - Source-Route-Bridge
+                  S - Switch, H - Host, I - IGMP, r - Repeater,
+                  V - VoIP-Phone, D - Remotely-Managed-Device,
+                  s - Supports-STP-Dispute
+
+----------------------------------------
+Device ID:core2.example.com(FDO12345678)
+System Name: core2
+
+Interface address(es): 1
+    IPv4 Address: 10.0.0.2
+Platform: N9K-C93180YC-EX, Capabilities: Router Switch IGMP Filtering Supports-STP-Dispute
+Interface: Ethernet1/49, Port ID (outgoing port): Ethernet1/50
+Holdtime: 171 sec
+
+Version:
+Cisco Nexus Operating System (NX-OS) Software, Version 9.3(8)
+
+Advertisement Version: 2
+
+Native VLAN: 10
+Duplex: full
+
+MTU: 9216
+Mgmt address(es):
+    IPv4 Address: 172.16.0.2
+
+Total entries displayed: 1
+`
+
+	ctx := context.Background()
+	node := &network.Node{IP: net.ParseIP("10.0.0.1"), Type: "root node"}
+	parser, err := halfpike.NewParser(routerOutput, node)
+	if err != nil {
+		t.Fatalf("TestNXOS: got err == %s", err)
+	}
+
+	sm := &CDP{}
+	if err := halfpike.Parse(ctx, parser, sm.Start); err != nil {
+		t.Fatalf("TestNXOS: got err == %s", err)
+	}
+
+	want := map[network.NodeInterface]*network.Node{
+		"Ethernet1/49": &network.Node{
+			IP:            net.ParseIP("10.0.0.2"),
+			IPs:           []net.IP{net.ParseIP("10.0.0.2")},
+			Type:          "N9K-C93180YC-EX",
+			DeviceID:      "core2.example.com(FDO12345678)",
+			Serial:        "FDO12345678",
+			Capabilities:  []string{"Router", "Switch", "IGMP", "Filtering", "Supports-STP-Dispute"},
+			Version:       "Cisco Nexus Operating System (NX-OS) Software, Version 9.3(8)",
+			ManagementIPs: []net.IP{net.ParseIP("172.16.0.2")},
+		},
+	}
+	if diff := pretty.Compare(want, node.Neighbors); diff != "" {
+		t.Fatalf("TestNXOS: -want/+got:\n%s", diff)
+	}
+
+	wantLinks := map[network.NodeInterface]*network.LinkDetail{
+		"Ethernet1/49": {Protocol: network.ProtoCDP, RemoteInterface: "Ethernet1/50", Holdtime: 171 * time.Second, NativeVLAN: 10, Duplex: "full"},
+	}
+	if diff := pretty.Compare(wantLinks, node.LinkDetails); diff != "" {
+		t.Fatalf("TestNXOS: links -want/+got:\n%s", diff)
+	}
+}
+
+func TestIPv6(t *testing.T) {
+	routerOutput := `
+Device ID: dualstack
+Entry address(es):
+  IP address: 192.168.1.243
+  IPv6 address: FE80::21B:D4FF:FE8B:5C01  (link-local)
+  IPv6 address: 2001:DB8::243  (global unicast)
+Platform: cisco WS-C3850-24T,  Capabilities: Router Switch IGMP
+Interface: GigabitEthernet1/0/1,  Port ID (outgoing port): GigabitEthernet1/0/2
+Management address(es):
+  IPv6 address: 2001:DB8:FFFF::243  (global unicast)
+-------------------------
+Device ID: v6only
+Entry address(es):
+  IPv6 address: FE80::21B:D4FF:FE8B:5C02  (link-local)
+  IPv6 address: 2001:DB8::244  (global unicast)
+Platform: cisco WS-C3850-24T,  Capabilities: Router Switch IGMP
+Interface: GigabitEthernet1/0/2,  Port ID (outgoing port): GigabitEthernet1/0/1
+`
+
+	ctx := context.Background()
+	node := &network.Node{IP: net.ParseIP("192.168.0.1"), Type: "root node"}
+	parser, err := halfpike.NewParser(routerOutput, node)
+	if err != nil {
+		t.Fatalf("TestIPv6: got err == %s", err)
+	}
+
+	sm := &CDP{}
+	if err := halfpike.Parse(ctx, parser, sm.Start); err != nil {
+		t.Fatalf("TestIPv6: got err == %s", err)
+	}
+
+	want := map[network.NodeInterface]*network.Node{
+		"GigabitEthernet1/0/1": &network.Node{
+			IP: net.ParseIP("192.168.1.243"),
+			IPs: []net.IP{
+				net.ParseIP("192.168.1.243"),
+				net.ParseIP("fe80::21b:d4ff:fe8b:5c01"),
+				net.ParseIP("2001:db8::243"),
+			},
+			Type:          "cisco WS-C3850-24T",
+			DeviceID:      "dualstack",
+			Capabilities:  []string{"Router", "Switch", "IGMP"},
+			ManagementIPs: []net.IP{net.ParseIP("2001:db8:ffff::243")},
+		},
+		"GigabitEthernet1/0/2": &network.Node{
+			IP: net.ParseIP("2001:db8::244"),
+			IPs: []net.IP{
+				net.ParseIP("fe80::21b:d4ff:fe8b:5c02"),
+				net.ParseIP("2001:db8::244"),
+			},
+			Type:         "cisco WS-C3850-24T",
+			DeviceID:     "v6only",
+			Capabilities: []string{"Router", "Switch", "IGMP"},
+		},
+	}
+	if diff := pretty.Compare(want, node.Neighbors); diff != "" {
+		t.Fatalf("TestIPv6: -want/+got:\n%s", diff)
+	}
 }
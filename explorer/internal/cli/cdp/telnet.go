@@ -0,0 +1,250 @@
+package cdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sync"
+)
+
+// Telnet commands and options, see RFC 854 and RFC 857/858.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho = 1
+	telnetOptSGA  = 3
+)
+
+var (
+	// loginPrompt matches the prompt for the username.
+	loginPrompt = regexp.MustCompile(`(?i)(user ?name|login): ?$`)
+	// loginStep matches any prompt we can see while logging in.
+	loginStep = regexp.MustCompile(loginPrompt.String() + "|" + passwordPrompt.String() + "|" + anyPrompt.String())
+)
+
+// dialTelnet connects to addr with telnet and logs in with c.Config.User and c.Password.
+func dialTelnet(ctx context.Context, addr string, c Conn) (client, error) {
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := newTelnetConn(conn)
+	s := newShellIO(tc, tc, tc)
+	if err := telnetLogin(ctx, s, c.Config.User, c.Password); err != nil {
+		s.close()
+		return nil, fmt.Errorf("telnet login to %s: %w", addr, err)
+	}
+	return &telnetClient{shell: s}, nil
+}
+
+// telnetLogin answers the username and password prompts on s. The CLI prompt is left for
+// shell.start() to find.
+func telnetLogin(ctx context.Context, s *shell, user, pass string) error {
+	sentUser, sentPass := false, false
+	for {
+		out, err := s.readUntil(ctx, loginStep)
+		if err != nil {
+			return err
+		}
+		switch {
+		case loginPrompt.MatchString(out):
+			if sentUser {
+				return fmt.Errorf("username or password was not accepted")
+			}
+			sentUser = true
+			if _, err := io.WriteString(s.stdin, user+"\n"); err != nil {
+				return err
+			}
+		case passwordPrompt.MatchString(out):
+			if sentPass {
+				return fmt.Errorf("username or password was not accepted")
+			}
+			sentPass = true
+			if _, err := io.WriteString(s.stdin, pass+"\n"); err != nil {
+				return err
+			}
+		default:
+			s.buf = append([]byte(out), s.buf...)
+			return nil
+		}
+	}
+}
+
+// telnetClient implements client over a telnet connection. Telnet only has the one
+// shell, so it is shared by every session.
+type telnetClient struct {
+	shell *shell
+
+	mu      sync.Mutex
+	started bool
+}
+
+func (t *telnetClient) conn() conn {
+	return telnetClose{t.shell}
+}
+
+func (t *telnetClient) newSession() (session, error) {
+	return nil, fmt.Errorf("telnet does not support exec requests")
+}
+
+func (t *telnetClient) newShell(ctx context.Context, enable string) (session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.started {
+		if err := t.shell.start(ctx, enable); err != nil {
+			return nil, err
+		}
+		t.started = true
+	}
+	return telnetSession{t.shell}, nil
+}
+
+// telnetClose implements conn by closing the shell.
+type telnetClose struct {
+	shell *shell
+}
+
+func (t telnetClose) close() {
+	t.shell.close()
+}
+
+// telnetSession is a session on the telnet shell. Closing it leaves the shell open for
+// the next session, the shell is closed with the client's conn.
+type telnetSession struct {
+	shell *shell
+}
+
+func (t telnetSession) combinedOutput(ctx context.Context, cmd string) ([]byte, error) {
+	return t.shell.combinedOutput(ctx, cmd)
+}
+
+func (telnetSession) close() {}
+
+// telnetConn handles the telnet protocol on a net.Conn, so that reads and writes are just
+// the text. We refuse every option the server asks us to do, but let it echo and suppress
+// go-aheads, which is what a CLI expects.
+type telnetConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	// wmu protects writes, as Read() answers option negotiation.
+	wmu sync.Mutex
+}
+
+func newTelnetConn(conn net.Conn) *telnetConn {
+	return &telnetConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Read implements io.Reader.
+func (t *telnetConn) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		// Return what we have rather than block for more.
+		if n > 0 && t.r.Buffered() == 0 {
+			break
+		}
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+
+		switch b {
+		case telnetIAC:
+			cmd, err := t.r.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			switch cmd {
+			case telnetIAC:
+				p[n] = telnetIAC
+				n++
+			case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+				opt, err := t.r.ReadByte()
+				if err != nil {
+					return n, err
+				}
+				if err := t.negotiate(cmd, opt); err != nil {
+					return n, err
+				}
+			case telnetSB:
+				if err := t.skipSubnegotiation(); err != nil {
+					return n, err
+				}
+			}
+		case 0:
+			// Servers send NUL after a CR that isn't part of a CR LF.
+		default:
+			p[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// negotiate answers the server asking about opt.
+func (t *telnetConn) negotiate(cmd, opt byte) error {
+	var reply byte
+	switch cmd {
+	case telnetDO:
+		reply = telnetWONT
+	case telnetWILL:
+		reply = telnetDONT
+		if opt == telnetOptEcho || opt == telnetOptSGA {
+			reply = telnetDO
+		}
+	default:
+		// DONT and WONT are already what we want.
+		return nil
+	}
+	return t.writeRaw([]byte{telnetIAC, reply, opt})
+}
+
+// skipSubnegotiation reads past the rest of an IAC SB ... IAC SE sequence.
+func (t *telnetConn) skipSubnegotiation() error {
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != telnetIAC {
+			continue
+		}
+		b, err = t.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == telnetSE {
+			return nil
+		}
+	}
+}
+
+// Write implements io.Writer. Newlines are sent as CR LF and IAC bytes are escaped.
+func (t *telnetConn) Write(p []byte) (int, error) {
+	b := bytes.ReplaceAll(p, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})
+	b = bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+	if err := t.writeRaw(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *telnetConn) writeRaw(b []byte) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	_, err := t.Conn.Write(b)
+	return err
+}
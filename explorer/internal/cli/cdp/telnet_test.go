@@ -0,0 +1,182 @@
+package cdp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"golang.org/x/crypto/ssh"
+)
+
+// telnetServer is a telnet server on 127.0.0.1 in front of a shellDevice.
+type telnetServer struct {
+	port int
+
+	ln net.Listener
+	wg sync.WaitGroup
+}
+
+func newTelnetServer(t *testing.T, user, pass string, device shellDevice) *telnetServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &telnetServer{ln: ln, port: ln.Addr().(*net.TCPAddr).Port}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer conn.Close()
+				s.serve(conn, user, pass, device)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *telnetServer) serve(conn net.Conn, user, pass string, device shellDevice) {
+	// Like IOS, offer to echo and suppress go-ahead, and ask for the window size.
+	conn.Write([]byte{telnetIAC, telnetWILL, telnetOptEcho, telnetIAC, telnetWILL, telnetOptSGA, telnetIAC, telnetDO, 31})
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{&stripIAC{r: bufio.NewReader(conn)}, conn}
+	r := bufio.NewReader(rw.Reader)
+
+	io.WriteString(conn, "\r\n\r\nUser Access Verification\r\n\r\n")
+	for try := 0; try < 3; try++ {
+		io.WriteString(conn, "Username: ")
+		u, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "Password: ")
+		p, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(u) == user && strings.TrimSpace(p) == pass {
+			rw.Reader = r
+			device.shell(rw)
+			return
+		}
+		io.WriteString(conn, "\r\n% Login invalid\r\n\r\n")
+	}
+}
+
+func (s *telnetServer) close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// stripIAC removes the telnet commands the client sends us.
+type stripIAC struct {
+	r *bufio.Reader
+}
+
+func (s *stripIAC) Read(p []byte) (int, error) {
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b == telnetIAC {
+			s.r.ReadByte()
+			s.r.ReadByte()
+			continue
+		}
+		p[0] = b
+		return 1, nil
+	}
+}
+
+func TestTelnet(t *testing.T) {
+	device := shellDevice{secret: "secret"}
+	config := &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	// A port that nothing is listening on, so SSH fails.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	server := newTelnetServer(t, "user", "pass", device)
+	defer server.close()
+
+	telnet := Conn{Config: config, Port: server.port, Transport: TransportTelnet, Password: "pass", EnableSecret: "secret"}
+	badPass := telnet
+	badPass.Password = "wrong"
+	badSecret := telnet
+	badSecret.EnableSecret = "wrong"
+
+	tests := []struct {
+		desc    string
+		conns   []Conn
+		wantErr bool
+	}{
+		{desc: "Telnet", conns: []Conn{telnet}},
+		{desc: "Fallback from SSH", conns: []Conn{{Config: config, Port: closedPort}, telnet}},
+		{desc: "Bad password", conns: []Conn{badPass}, wantErr: true},
+		{desc: "Bad enable secret", conns: []Conn{badSecret}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		conns := test.conns
+		d, err := NewLLDP(func(*network.Node) []Conn { return conns }, WithCommandTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("TestTelnet(%s): NewLLDP() had error: %s", test.desc, err)
+		}
+		// LLDP isn't supported by the device, so this also checks that the telnet
+		// connection is shared by more than one command.
+		node := &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}
+		if err := d.Node(context.Background(), node); err == nil {
+			t.Errorf("TestTelnet(%s): LLDP Node(): got err == nil, want err != nil", test.desc)
+		}
+
+		d, err = New(func(*network.Node) []Conn { return conns }, WithCommandTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("TestTelnet(%s): New() had error: %s", test.desc, err)
+		}
+		node = &network.Node{IP: net.ParseIP("127.0.0.1"), Type: "RootNode"}
+		err = d.Node(context.Background(), node)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestTelnet(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestTelnet(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		n := node.Neighbors["FastEthernet0/12"]
+		if n == nil || n.DeviceID != "Switch2" || n.Type != "cisco WS-C2950-12" {
+			t.Errorf("TestTelnet(%s): did not get the neighbor from the device, got %v", test.desc, node.Neighbors)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package hostkey provides SSH host key verification policies: strict checking against
+// known_hosts files, trust-on-first-use (TOFU) and insecure (accept everything).
+package hostkey
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Error is returned when a host's key could not be verified.
+type Error struct {
+	// Host is the host:port that was dialed.
+	Host string
+	// Unknown indicates the host had no known key (only possible in strict mode). Otherwise the
+	// key did not match the known key, which could mean someone is intercepting our connection.
+	Unknown bool
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.Error().
+func (e *Error) Error() string {
+	if e.Unknown {
+		return fmt.Sprintf("host key for %s is not known: %s", e.Host, e.Err)
+	}
+	return fmt.Sprintf("host key for %s does not match the known key, possible man in the middle: %s", e.Host, e.Err)
+}
+
+// Unwrap allows errors.Is/As to see the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Insecure returns a callback that accepts any host key.
+func Insecure() ssh.HostKeyCallback {
+	return ssh.InsecureIgnoreHostKey()
+}
+
+// Strict returns a callback that only accepts host keys found in the known_hosts files.
+func Strict(files ...string) (ssh.HostKeyCallback, error) {
+	k, err := NewKnownHosts(files...)
+	if err != nil {
+		return nil, err
+	}
+	return k.Callback, nil
+}
+
+// KnownHosts provides strict host key checking against known_hosts files.
+type KnownHosts struct {
+	cb ssh.HostKeyCallback
+}
+
+// NewKnownHosts is the constructor for KnownHosts.
+func NewKnownHosts(files ...string) (*KnownHosts, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("strict host key checking requires at least one known_hosts file")
+	}
+	cb, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known_hosts: %s", err)
+	}
+	return &KnownHosts{cb: cb}, nil
+}
+
+// Callback implements ssh.HostKeyCallback.
+func (k *KnownHosts) Callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := k.cb(hostname, remote, key)
+	if err == nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		return &Error{Host: hostname, Unknown: len(keyErr.Want) == 0, Err: err}
+	}
+	return &Error{Host: hostname, Err: err}
+}
+
+// Algorithms returns the host key algorithms of the keys known for hostname (a host:port),
+// or nil if there are none. Like OpenSSH, set ssh.ClientConfig.HostKeyAlgorithms to these
+// so a host with several keys sends one we can verify.
+func (k *KnownHosts) Algorithms(hostname string) []string {
+	return knownAlgorithms(k.cb, hostname)
+}
+
+// probeKey is never a real host key, so checking it returns every key known for a host.
+var probeKey, _ = ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+
+// knownAlgorithms returns the algorithms of the keys cb knows for hostname.
+func knownAlgorithms(cb ssh.HostKeyCallback, hostname string) []string {
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return nil
+	}
+	p, _ := strconv.Atoi(port)
+	// knownhosts also checks the remote address, which is the same host for a direct dial.
+	remote := &net.TCPAddr{IP: net.ParseIP(host), Port: p}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(cb(hostname, remote, probeKey), &keyErr) {
+		return nil
+	}
+	var keys []ssh.PublicKey
+	for _, k := range keyErr.Want {
+		keys = append(keys, k.Key)
+	}
+	return algorithms(keys...)
+}
+
+// preference is the order algorithms returns host key algorithms in, strongest first.
+var preference = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoSKED25519,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoSKECDSA256,
+	ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSASHA256,
+	ssh.KeyAlgoRSA,
+	ssh.KeyAlgoDSA,
+}
+
+// rank returns where algo goes in preference. Algorithms not in it go last.
+func rank(algo string) int {
+	for i, a := range preference {
+		if a == algo {
+			return i
+		}
+	}
+	return len(preference)
+}
+
+// algorithms returns the host key algorithms that can be used with keys, without duplicates,
+// in the order of preference. knownhosts returns keys in no fixed order, so the order of
+// keys doesn't matter.
+func algorithms(keys ...ssh.PublicKey) []string {
+	var algos []string
+	for _, k := range keys {
+		algos = append(algos, keyAlgorithms(k.Type())...)
+	}
+	sort.Slice(algos, func(i, j int) bool {
+		ri, rj := rank(algos[i]), rank(algos[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return algos[i] < algos[j]
+	})
+
+	var out []string
+	for i, a := range algos {
+		if i == 0 || a != algos[i-1] {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// keyAlgorithms returns the signature algorithms for a key type. RSA keys can sign with
+// SHA-2 as well as SHA-1.
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// TOFU provides trust-on-first-use host key checking. Keys are checked against the known_hosts
+// files in known (which may be empty) and the netcrawl managed file. A host that is in neither
+// has its key added to the managed file. A host whose key doesn't match is rejected.
+type TOFU struct {
+	file string
+	cb   ssh.HostKeyCallback
+
+	mu sync.Mutex
+	// learned are keys added during this run, keyed by normalized address. knownhosts
+	// does not re-read the file, so we must track these ourselves.
+	learned map[string]ssh.PublicKey
+}
+
+// NewTOFU is the constructor for TOFU. file is created if it doesn't exist.
+func NewTOFU(file string, known ...string) (*TOFU, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, fmt.Errorf("could not create directory for %s: %s", file, err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open known_hosts file %s: %s", file, err)
+	}
+	f.Close()
+
+	cb, err := knownhosts.New(append(known, file)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known_hosts: %s", err)
+	}
+	return &TOFU{file: file, cb: cb, learned: map[string]ssh.PublicKey{}}, nil
+}
+
+// Callback implements ssh.HostKeyCallback.
+func (t *TOFU) Callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addr := knownhosts.Normalize(hostname)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if k, ok := t.learned[addr]; ok {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return nil
+		}
+		return &Error{Host: hostname, Err: fmt.Errorf("key was learned earlier in this crawl")}
+	}
+
+	err := t.cb(hostname, remote, key)
+	if err == nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+		return &Error{Host: hostname, Err: err}
+	}
+
+	// First time we've seen this host.
+	f, err := os.OpenFile(t.file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open %s to add host key: %s", t.file, err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{addr}, key)); err != nil {
+		return fmt.Errorf("could not add host key to %s: %s", t.file, err)
+	}
+	t.learned[addr] = key
+	return nil
+}
+
+// Algorithms returns the host key algorithms of the keys known for hostname (a host:port),
+// or nil if it hasn't been seen, in which case any key will be learned.
+func (t *TOFU) Algorithms(hostname string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if k, ok := t.learned[knownhosts.Normalize(hostname)]; ok {
+		return algorithms(k)
+	}
+	return knownAlgorithms(t.cb, hostname)
+}
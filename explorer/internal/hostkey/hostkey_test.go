@@ -0,0 +1,288 @@
+package hostkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestTOFU(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "netcrawl", "known_hosts")
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 22}
+	key, otherKey := newKey(t), newKey(t)
+
+	tofu, err := NewTOFU(file)
+	if err != nil {
+		t.Fatalf("TestTOFU: NewTOFU() had error: %s", err)
+	}
+
+	if err := tofu.Callback("192.168.0.1:22", remote, key); err != nil {
+		t.Fatalf("TestTOFU: first use: got err == %s, want err == nil", err)
+	}
+	if err := tofu.Callback("192.168.0.1:22", remote, key); err != nil {
+		t.Fatalf("TestTOFU: second use: got err == %s, want err == nil", err)
+	}
+
+	var hkErr *Error
+	err = tofu.Callback("192.168.0.1:22", remote, otherKey)
+	if !errors.As(err, &hkErr) || hkErr.Unknown {
+		t.Fatalf("TestTOFU: changed key: got err == %v, want mismatch *Error", err)
+	}
+
+	// A new run must use what was written to the file.
+	tofu, err = NewTOFU(file)
+	if err != nil {
+		t.Fatalf("TestTOFU: NewTOFU() had error: %s", err)
+	}
+	if err := tofu.Callback("192.168.0.1:22", remote, key); err != nil {
+		t.Fatalf("TestTOFU: new run: got err == %s, want err == nil", err)
+	}
+	err = tofu.Callback("192.168.0.1:22", remote, otherKey)
+	if !errors.As(err, &hkErr) || hkErr.Unknown {
+		t.Fatalf("TestTOFU: new run changed key: got err == %v, want mismatch *Error", err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, otherKey := newKey(t), newKey(t)
+
+	file := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("192.168.0.1:22")}, key)
+	if err := ioutil.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cb, err := Strict(file)
+	if err != nil {
+		t.Fatalf("TestStrict: Strict() had error: %s", err)
+	}
+
+	tests := []struct {
+		desc        string
+		host        string
+		key         ssh.PublicKey
+		wantErr     bool
+		wantUnknown bool
+	}{
+		{desc: "Known key", host: "192.168.0.1", key: key},
+		{desc: "Changed key", host: "192.168.0.1", key: otherKey, wantErr: true},
+		{desc: "Unknown host", host: "192.168.0.2", key: key, wantErr: true, wantUnknown: true},
+	}
+
+	for _, test := range tests {
+		remote := &net.TCPAddr{IP: net.ParseIP(test.host), Port: 22}
+		err := cb(test.host+":22", remote, test.key)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestStrict(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestStrict(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err == nil:
+			continue
+		}
+
+		var hkErr *Error
+		if !errors.As(err, &hkErr) {
+			t.Errorf("TestStrict(%s): got err type %T, want *Error", test.desc, err)
+			continue
+		}
+		if hkErr.Unknown != test.wantUnknown {
+			t.Errorf("TestStrict(%s): got Unknown == %v, want %v", test.desc, hkErr.Unknown, test.wantUnknown)
+		}
+	}
+}
+
+// newSigners returns an RSA, an ECDSA and an ed25519 host key.
+func newSigners(t *testing.T) (rsaKey, ecdsaKey, edKey ssh.Signer) {
+	t.Helper()
+
+	r, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signers []ssh.Signer
+	for _, k := range []interface{}{r, e, ed} {
+		s, err := ssh.NewSignerFromKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+	}
+	return signers[0], signers[1], signers[2]
+}
+
+func TestAlgorithms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, ecdsaKey, edKey := newSigners(t)
+	lines := []string{
+		knownhosts.Line([]string{knownhosts.Normalize("192.168.0.1:22")}, edKey.PublicKey()),
+		knownhosts.Line([]string{knownhosts.Normalize("192.168.0.1:22")}, rsaKey.PublicKey()),
+		knownhosts.Line([]string{knownhosts.Normalize("192.168.0.2:2222")}, ecdsaKey.PublicKey()),
+	}
+	file := filepath.Join(dir, "known_hosts")
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	known, err := NewKnownHosts(file)
+	if err != nil {
+		t.Fatalf("TestAlgorithms: NewKnownHosts() had error: %s", err)
+	}
+	tofu, err := NewTOFU(filepath.Join(dir, "netcrawl", "known_hosts"), file)
+	if err != nil {
+		t.Fatalf("TestAlgorithms: NewTOFU() had error: %s", err)
+	}
+	// TOFU learns this one during the crawl.
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.0.3"), Port: 22}
+	if err := tofu.Callback("192.168.0.3:22", remote, ecdsaKey.PublicKey()); err != nil {
+		t.Fatalf("TestAlgorithms: TOFU.Callback() had error: %s", err)
+	}
+
+	tests := []struct {
+		desc     string
+		host     string
+		want     []string
+		wantTOFU []string
+	}{
+		{
+			desc:     "Host with two keys",
+			host:     "192.168.0.1:22",
+			want:     []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+			wantTOFU: []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+		},
+		{
+			desc:     "Non-standard port",
+			host:     "192.168.0.2:2222",
+			want:     []string{ssh.KeyAlgoECDSA256},
+			wantTOFU: []string{ssh.KeyAlgoECDSA256},
+		},
+		{desc: "Port that isn't known", host: "192.168.0.2:22"},
+		{desc: "Learned by TOFU", host: "192.168.0.3:22", wantTOFU: []string{ssh.KeyAlgoECDSA256}},
+		{desc: "Unknown host", host: "192.168.0.4:22"},
+	}
+
+	for _, test := range tests {
+		if diff := pretty.Compare(test.want, known.Algorithms(test.host)); diff != "" {
+			t.Errorf("TestAlgorithms(%s): KnownHosts: -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantTOFU, tofu.Algorithms(test.host)); diff != "" {
+			t.Errorf("TestAlgorithms(%s): TOFU: -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+// TestAlgorithmsHandshake tests that a host with an RSA and an ed25519 key, of which only the
+// ed25519 key is known, can be logged into.
+func TestAlgorithmsHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, _, edKey := newSigners(t)
+	server := &ssh.ServerConfig{NoClientAuth: true}
+	server.AddHostKey(rsaKey)
+	server.AddHostKey(edKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sc, chans, reqs, err := ssh.NewServerConn(conn, server)
+				if err != nil {
+					return
+				}
+				defer sc.Close()
+				go ssh.DiscardRequests(reqs)
+				for c := range chans {
+					c.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().String()
+
+	file := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, edKey.PublicKey())
+	if err := ioutil.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	known, err := NewKnownHosts(file)
+	if err != nil {
+		t.Fatalf("TestAlgorithmsHandshake: NewKnownHosts() had error: %s", err)
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:              "user",
+		HostKeyCallback:   known.Callback,
+		HostKeyAlgorithms: known.Algorithms(addr),
+	})
+	if err != nil {
+		t.Fatalf("TestAlgorithmsHandshake: got err == %s, want err == nil", err)
+	}
+	client.Close()
+}
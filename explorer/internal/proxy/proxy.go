@@ -0,0 +1,150 @@
+// Package proxy provides dialers that connect through SOCKS5 and HTTP CONNECT proxies, for
+// management networks that are only reachable through a proxy.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// Dialer connects to an address. *net.Dialer implements it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// SOCKS5 returns a Dialer that connects through the SOCKS5 proxy at addr (host:port).
+// If user is set, it is used with pass to authenticate to the proxy. forward is used to
+// connect to the proxy, if nil a net.Dialer is used.
+func SOCKS5(addr, user, pass string, forward Dialer) (Dialer, error) {
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	var auth *xproxy.Auth
+	if user != "" {
+		auth = &xproxy.Auth{User: user, Password: pass}
+	}
+
+	d, err := xproxy.SOCKS5("tcp", addr, auth, contextDialer{forward})
+	if err != nil {
+		return nil, fmt.Errorf("bad SOCKS5 proxy %s: %s", addr, err)
+	}
+	cd, ok := d.(xproxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("bug: SOCKS5 dialer does not support DialContext()")
+	}
+	return cd, nil
+}
+
+// contextDialer lets a Dialer be used as the forward dialer of the x/net/proxy package,
+// which needs a Dial() method.
+type contextDialer struct {
+	Dialer
+}
+
+func (c contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return c.DialContext(context.Background(), network, addr)
+}
+
+// HTTPConnect returns a Dialer that connects through the HTTP proxy at addr (host:port)
+// using the CONNECT method. If user is set, it is used with pass for Basic authentication
+// to the proxy. forward is used to connect to the proxy, if nil a net.Dialer is used.
+func HTTPConnect(addr, user, pass string, forward Dialer) Dialer {
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	return httpConnect{addr: addr, user: user, pass: pass, forward: forward}
+}
+
+type httpConnect struct {
+	addr, user, pass string
+	forward          Dialer
+}
+
+// DialContext implements Dialer.DialContext().
+func (h httpConnect) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("HTTP CONNECT proxy cannot dial network %q", network)
+	}
+
+	conn, err := h.forward.DialContext(ctx, "tcp", h.addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to HTTP proxy %s: %w", h.addr, err)
+	}
+
+	// The proxy may never answer, so close the connection out from under us if ctx is done.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, err := h.connect(conn, addr)
+	close(done)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("HTTP proxy %s CONNECT to %s: %w", h.addr, addr, ctx.Err())
+		}
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy %s CONNECT to %s: %w", h.addr, addr, ctx.Err())
+	}
+	return c, nil
+}
+
+// connect asks the proxy on conn to connect us to addr.
+func (h httpConnect) connect(conn net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if h.user != "" {
+		cred := base64.StdEncoding.EncodeToString([]byte(h.user + ":" + h.pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("could not send CONNECT to HTTP proxy %s: %s", h.addr, err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CONNECT response from HTTP proxy %s: %s", h.addr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP proxy %s refused CONNECT to %s: %s", h.addr, addr, resp.Status)
+	}
+
+	// The server may have started talking (SSH servers send their banner first) and
+	// that could be sitting in our buffer.
+	if br.Buffered() > 0 {
+		return bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn that reads what is left in r before reading from Conn.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
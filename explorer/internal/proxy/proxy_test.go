@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listen starts a server on 127.0.0.1 that calls handle for each connection.
+func listen(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		ln.Close()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// banner is a server that talks first, like an SSH server, and then echoes.
+func banner(conn net.Conn) {
+	io.WriteString(conn, "hello\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, line)
+	}
+}
+
+// splice connects client to addr and copies between them.
+func splice(client net.Conn, addr string) {
+	server, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+	go func() {
+		io.Copy(server, client)
+		server.Close()
+	}()
+	io.Copy(client, server)
+}
+
+// socks5Server is a SOCKS5 proxy that requires user/pass if user is set.
+func socks5Server(user, pass string) func(net.Conn) {
+	return func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		buf := make([]byte, 262)
+
+		// Greeting: VER NMETHODS METHODS.
+		if _, err := io.ReadFull(r, buf[:2]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(r, buf[:buf[1]]); err != nil {
+			return
+		}
+		if user == "" {
+			conn.Write([]byte{5, 0})
+		} else {
+			conn.Write([]byte{5, 2})
+			// VER ULEN UNAME PLEN PASSWD.
+			if _, err := io.ReadFull(r, buf[:2]); err != nil {
+				return
+			}
+			u := make([]byte, buf[1])
+			io.ReadFull(r, u)
+			io.ReadFull(r, buf[:1])
+			p := make([]byte, buf[0])
+			io.ReadFull(r, p)
+			if string(u) != user || string(p) != pass {
+				conn.Write([]byte{1, 1})
+				return
+			}
+			conn.Write([]byte{1, 0})
+		}
+
+		// Request: VER CMD RSV ATYP DST.ADDR DST.PORT.
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return
+		}
+		var host string
+		switch buf[3] {
+		case 1:
+			io.ReadFull(r, buf[:4])
+			host = net.IP(buf[:4]).String()
+		case 4:
+			io.ReadFull(r, buf[:16])
+			host = net.IP(buf[:16]).String()
+		default:
+			return
+		}
+		io.ReadFull(r, buf[:2])
+		port := binary.BigEndian.Uint16(buf[:2])
+
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		splice(conn, net.JoinHostPort(host, strconv.Itoa(int(port))))
+	}
+}
+
+// httpServer is an HTTP CONNECT proxy that requires user/pass if user is set.
+func httpServer(user, pass string) func(net.Conn) {
+	return func(conn net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		if req.Method != http.MethodConnect {
+			io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+			return
+		}
+		if user != "" {
+			req.Header.Set("Authorization", req.Header.Get("Proxy-Authorization"))
+			u, p, ok := req.BasicAuth()
+			if !ok || u != user || p != pass {
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+				return
+			}
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		splice(conn, req.Host)
+	}
+}
+
+// stall is a proxy that never answers.
+func stall(conn net.Conn) {
+	io.Copy(io.Discard, conn)
+}
+
+func TestDialers(t *testing.T) {
+	target := listen(t, banner)
+
+	socks, err := SOCKS5(listen(t, socks5Server("", "")), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socksAuth, err := SOCKS5(listen(t, socks5Server("user", "pass")), "user", "pass", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socksBadAuth, err := SOCKS5(listen(t, socks5Server("user", "pass")), "user", "wrong", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc    string
+		dialer  Dialer
+		wantErr bool
+	}{
+		{desc: "SOCKS5", dialer: socks},
+		{desc: "SOCKS5 with auth", dialer: socksAuth},
+		{desc: "SOCKS5 with bad auth", dialer: socksBadAuth, wantErr: true},
+		{desc: "HTTP", dialer: HTTPConnect(listen(t, httpServer("", "")), "", "", nil)},
+		{desc: "HTTP with auth", dialer: HTTPConnect(listen(t, httpServer("user", "pass")), "user", "pass", nil)},
+		{desc: "HTTP with bad auth", dialer: HTTPConnect(listen(t, httpServer("user", "pass")), "user", "wrong", nil), wantErr: true},
+		{desc: "HTTP proxy that never answers", dialer: HTTPConnect(listen(t, stall), "", "", nil), wantErr: true},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		conn, err := test.dialer.DialContext(ctx, "tcp", target)
+		cancel()
+		switch {
+		case err == nil && test.wantErr:
+			conn.Close()
+			t.Errorf("TestDialers(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestDialers(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		r := bufio.NewReader(conn)
+		if got, err := r.ReadString('\n'); err != nil || got != "hello\n" {
+			t.Errorf("TestDialers(%s): got banner %q, %v, want %q", test.desc, got, err, "hello\n")
+		}
+		io.WriteString(conn, "echo\n")
+		if got, err := r.ReadString('\n'); err != nil || got != "echo\n" {
+			t.Errorf("TestDialers(%s): got echo %q, %v, want %q", test.desc, got, err, "echo\n")
+		}
+		conn.Close()
+	}
+}
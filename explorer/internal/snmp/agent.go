@@ -0,0 +1,164 @@
+package snmp
+
+/*
+Like the SSH code in cli/cdp, we don't want to need a real SNMP agent to test against. dialer()
+provides a real gosnmp connection by default, wrapped in our agent interface. Tests can switch
+this out with FakeAgents(), which provides an in-process agent that answers walks from a map of OIDs.
+*/
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+var fakeMap map[string]map[string]interface{}
+
+// dialer provides the function for connecting to an SNMP agent. Replaced during tests.
+var dialer = func(ctx context.Context, target string, conf *gosnmp.GoSNMP) (agent, error) {
+	g := Clone(conf)
+	g.Target = target
+	g.Context = ctx
+
+	if err := g.Connect(); err != nil {
+		return nil, err
+	}
+	return snmpAgent{ctx: ctx, g: g}, nil
+}
+
+// Clone makes a copy of a template GoSNMP for use against a single node. Only the settings
+// are copied, not the connection.
+func Clone(conf *gosnmp.GoSNMP) *gosnmp.GoSNMP {
+	g := &gosnmp.GoSNMP{
+		Port:           conf.Port,
+		Transport:      conf.Transport,
+		Community:      conf.Community,
+		Version:        conf.Version,
+		Timeout:        conf.Timeout,
+		Retries:        conf.Retries,
+		MaxOids:        conf.MaxOids,
+		MaxRepetitions: conf.MaxRepetitions,
+		MsgFlags:       conf.MsgFlags,
+		SecurityModel:  conf.SecurityModel,
+		ContextName:    conf.ContextName,
+	}
+	if conf.SecurityParameters != nil {
+		g.SecurityParameters = conf.SecurityParameters.Copy()
+	}
+	return g
+}
+
+type agent interface {
+	// bulkWalk returns all PDUs in the subtree rooted at oid.
+	bulkWalk(oid string) ([]gosnmp.SnmpPDU, error)
+	close()
+}
+
+// snmpAgent implements agent using the gosnmp library.
+type snmpAgent struct {
+	// ctx stops a walk when it is done. gosnmp only checks g.Context between retries.
+	ctx context.Context
+	g   *gosnmp.GoSNMP
+}
+
+// bulkWalk implements agent.bulkWalk().
+func (s snmpAgent) bulkWalk(oid string) ([]gosnmp.SnmpPDU, error) {
+	var pdus []gosnmp.SnmpPDU
+	walk := func(pdu gosnmp.SnmpPDU) error {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		pdus = append(pdus, pdu)
+		return nil
+	}
+
+	var err error
+	if s.g.Version == gosnmp.Version1 {
+		err = s.g.Walk(oid, walk)
+	} else {
+		err = s.g.BulkWalk(oid, walk)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pdus, nil
+}
+
+// close implements agent.close().
+func (s snmpAgent) close() {
+	s.g.Conn.Close()
+}
+
+// FakeAgents converts our internal dialer to connect to in-process agents. agents is keyed by
+// the node's IP and the value is a map of OIDs (dotted decimal, without a leading dot) to values.
+// Values should be a string, []byte or int. Dialing an IP that is not in agents results in an error.
+func FakeAgents(agents map[string]map[string]interface{}) {
+	fakeMap = agents
+
+	dialer = func(ctx context.Context, target string, conf *gosnmp.GoSNMP) (agent, error) {
+		if _, ok := fakeMap[target]; !ok {
+			return nil, fmt.Errorf("request timeout for agent %s", target)
+		}
+		return fakeAgent{ctx: ctx, target: target}, nil
+	}
+}
+
+type fakeAgent struct {
+	ctx    context.Context
+	target string
+}
+
+// bulkWalk implements agent.bulkWalk().
+func (f fakeAgent) bulkWalk(oid string) ([]gosnmp.SnmpPDU, error) {
+	if err := f.ctx.Err(); err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimPrefix(oid, ".") + "."
+
+	var names []string
+	for name := range fakeMap[f.target] {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return oidLess(names[i], names[j]) })
+
+	var pdus []gosnmp.SnmpPDU
+	for _, name := range names {
+		pdu := gosnmp.SnmpPDU{Name: "." + name}
+		switch v := fakeMap[f.target][name].(type) {
+		case string:
+			pdu.Type = gosnmp.OctetString
+			pdu.Value = []byte(v)
+		case []byte:
+			pdu.Type = gosnmp.OctetString
+			pdu.Value = v
+		case int:
+			pdu.Type = gosnmp.Integer
+			pdu.Value = v
+		default:
+			panic(fmt.Sprintf("unknown fake OID value type %T", v))
+		}
+		pdus = append(pdus, pdu)
+	}
+	return pdus, nil
+}
+
+func (fakeAgent) close() {}
+
+// oidLess compares OIDs numerically by sub-identifier, the way an agent orders a walk.
+func oidLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		if an != bn {
+			return an < bn
+		}
+	}
+	return len(as) < len(bs)
+}
@@ -0,0 +1,351 @@
+package snmp
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// OIDs from CISCO-CDP-MIB, LLDP-MIB and IF-MIB that we walk.
+const (
+	// cdpCacheEntry is indexed by cdpCacheIfIndex.cdpCacheDeviceIndex.
+	oidCDPCacheEntry = "1.3.6.1.4.1.9.9.23.1.2.1.1"
+
+	cdpCacheAddressType = 3
+	cdpCacheAddress     = 4
+	cdpCacheDeviceID    = 6
+	cdpCacheDevicePort  = 7
+	cdpCachePlatform    = 8
+
+	// lldpRemEntry is indexed by lldpRemTimeMark.lldpRemLocalPortNum.lldpRemIndex.
+	oidLLDPRemEntry = "1.0.8802.1.1.2.1.4.1.1"
+
+	lldpRemChassisIDSubtype = 4
+	lldpRemChassisID        = 5
+	lldpRemPortID           = 7
+	lldpRemSysName          = 9
+	lldpRemSysDesc          = 10
+
+	// lldpRemManAddrEntry is indexed like lldpRemEntry plus
+	// lldpRemManAddrSubtype.<address length>.<address bytes>.
+	oidLLDPRemManAddrEntry = "1.0.8802.1.1.2.1.4.2.1"
+
+	// lldpLocPortEntry is indexed by lldpLocPortNum.
+	oidLLDPLocPortEntry = "1.0.8802.1.1.2.1.3.7.1"
+
+	lldpLocPortIDSubtype = 2
+	lldpLocPortID        = 3
+	lldpLocPortDesc      = 4
+
+	oidIfName  = "1.3.6.1.2.1.31.1.1.1.1"
+	oidIfDescr = "1.3.6.1.2.1.2.2.1.2"
+)
+
+// CDP address types (CiscoNetworkProtocol).
+const (
+	cdpAddrIP   = 1
+	cdpAddrIPv6 = 20
+)
+
+// lldpChassisMAC is the LldpChassisIdSubtype for a MAC address.
+const lldpChassisMAC = 4
+
+// LldpPortIdSubtypes whose lldpLocPortId is an interface name.
+const (
+	lldpPortIfName = 5
+	lldpPortLocal  = 7
+)
+
+// LLDP management address subtypes (IANA AddressFamilyNumbers).
+const (
+	lldpAddrIPv4 = 1
+	lldpAddrIPv6 = 2
+)
+
+// neighbor is a neighbor we found in one of the MIB tables.
+type neighbor struct {
+	local network.NodeInterface
+	node  *network.Node
+	link  *network.LinkDetail
+}
+
+// row is a single conceptual row of a table, keyed by column number.
+type row map[int]gosnmp.SnmpPDU
+
+// table walks an SNMP table entry and returns the rows keyed by their index.
+func table(ag agent, entry string) (map[string]row, error) {
+	pdus, err := ag.bulkWalk(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := map[string]row{}
+	for _, pdu := range pdus {
+		col, index, err := splitOID(entry, pdu.Name)
+		if err != nil {
+			return nil, err
+		}
+		if rows[index] == nil {
+			rows[index] = row{}
+		}
+		rows[index][col] = pdu
+	}
+	return rows, nil
+}
+
+// splitOID splits name into the column and index parts found after entry.
+func splitOID(entry, name string) (col int, index string, err error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(name, "."), entry+".")
+	parts := strings.SplitN(rest, ".", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("OID %s is not a table column under %s", name, entry)
+	}
+	col, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("OID %s has a bad column: %s", name, err)
+	}
+	return col, parts[1], nil
+}
+
+// cdpNeighbors walks the cdpCacheTable.
+func cdpNeighbors(ag agent) ([]neighbor, error) {
+	rows, err := table(ag, oidCDPCacheEntry)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	names, err := ifNames(ag)
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []neighbor
+	for index, r := range rows {
+		ifIndex := strings.SplitN(index, ".", 2)[0]
+
+		var ip net.IP
+		switch pduInt(r[cdpCacheAddressType]) {
+		case cdpAddrIP, cdpAddrIPv6:
+			b := pduBytes(r[cdpCacheAddress])
+			if len(b) == net.IPv4len || len(b) == net.IPv6len {
+				ip = net.IP(b)
+			}
+		}
+		if ip == nil {
+			log.Println("saw a CDP neighbor via SNMP, but no IP listed")
+			continue
+		}
+
+		local := names[ifIndex]
+		if local == "" {
+			local = "ifIndex" + ifIndex
+		}
+
+		neighbors = append(
+			neighbors,
+			neighbor{
+				local: network.NodeInterface(local),
+				node: &network.Node{
+					IP:       ip,
+					IPs:      []net.IP{ip},
+					Type:     pduString(r[cdpCachePlatform]),
+					DeviceID: pduString(r[cdpCacheDeviceID]),
+				},
+				link: &network.LinkDetail{
+					Protocol:        network.ProtoCDP,
+					RemoteInterface: network.NodeInterface(pduString(r[cdpCacheDevicePort])),
+				},
+			},
+		)
+	}
+	sortNeighbors(neighbors)
+	return neighbors, nil
+}
+
+// ifNames returns a map of ifIndex to interface name, using ifName and falling back to ifDescr.
+func ifNames(ag agent) (map[string]string, error) {
+	names := map[string]string{}
+	for _, oid := range []string{oidIfDescr, oidIfName} {
+		pdus, err := ag.bulkWalk(oid)
+		if err != nil {
+			return nil, err
+		}
+		for _, pdu := range pdus {
+			index := strings.TrimPrefix(strings.TrimPrefix(pdu.Name, "."), oid+".")
+			if s := pduString(pdu); s != "" {
+				names[index] = s
+			}
+		}
+	}
+	return names, nil
+}
+
+// lldpNeighbors walks the lldpRemTable and lldpRemManAddrTable.
+func lldpNeighbors(ag agent) ([]neighbor, error) {
+	rows, err := table(ag, oidLLDPRemEntry)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	addrs, err := lldpManAddrs(ag)
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := table(ag, oidLLDPLocPortEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []neighbor
+	for index, r := range rows {
+		ip := addrs[index]
+		if ip == nil {
+			log.Println("saw an LLDP neighbor via SNMP, but no management IP listed")
+			continue
+		}
+
+		// index is lldpRemTimeMark.lldpRemLocalPortNum.lldpRemIndex.
+		parts := strings.Split(index, ".")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("lldpRemTable had unexpected index %s", index)
+		}
+		local := localPort(ports[parts[1]])
+		if local == "" {
+			local = "port" + parts[1]
+		}
+
+		platform := strings.TrimSpace(strings.SplitN(pduString(r[lldpRemSysDesc]), "\n", 2)[0])
+		if platform == "" {
+			platform = pduString(r[lldpRemSysName])
+		}
+
+		neighbors = append(
+			neighbors,
+			neighbor{
+				local: network.NodeInterface(local),
+				node: &network.Node{
+					IP:        ip,
+					IPs:       []net.IP{ip},
+					Type:      platform,
+					DeviceID:  pduString(r[lldpRemSysName]),
+					ChassisID: chassisID(r),
+				},
+				link: &network.LinkDetail{
+					Protocol:        network.ProtoLLDP,
+					RemoteInterface: network.NodeInterface(pduString(r[lldpRemPortID])),
+				},
+			},
+		)
+	}
+	sortNeighbors(neighbors)
+	return neighbors, nil
+}
+
+// localPort returns the name of the local port in r, a row of the lldpLocPortTable. The
+// lldpLocPortId is used when it is an interface name, as it matches what the CLI and the
+// far end call the port. Otherwise it is often a MAC address, so we fall back to the
+// lldpLocPortDesc, which on some platforms is free text.
+func localPort(r row) string {
+	switch pduInt(r[lldpLocPortIDSubtype]) {
+	case lldpPortIfName, lldpPortLocal:
+		if id := pduString(r[lldpLocPortID]); id != "" {
+			return id
+		}
+	}
+	if desc := pduString(r[lldpLocPortDesc]); desc != "" {
+		return desc
+	}
+	return pduString(r[lldpLocPortID])
+}
+
+// lldpManAddrs returns the management IP for each lldpRemTable index. IPv4 is preferred.
+func lldpManAddrs(ag agent) (map[string]net.IP, error) {
+	pdus, err := ag.bulkWalk(oidLLDPRemManAddrEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := map[string]net.IP{}
+	for _, pdu := range pdus {
+		_, index, err := splitOID(oidLLDPRemManAddrEntry, pdu.Name)
+		if err != nil {
+			return nil, err
+		}
+		// <timeMark>.<localPort>.<remIndex>.<subtype>.<len>.<addr...>
+		parts := strings.Split(index, ".")
+		if len(parts) < 5 {
+			continue
+		}
+		subtype, _ := strconv.Atoi(parts[3])
+		length, _ := strconv.Atoi(parts[4])
+		if len(parts) != 5+length {
+			continue
+		}
+
+		var ip net.IP
+		switch {
+		case subtype == lldpAddrIPv4 && length == net.IPv4len, subtype == lldpAddrIPv6 && length == net.IPv6len:
+			ip = make(net.IP, length)
+			for i, s := range parts[5:] {
+				b, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, fmt.Errorf("lldpRemManAddrTable had bad address in index %s", index)
+				}
+				ip[i] = byte(b)
+			}
+		default:
+			continue
+		}
+
+		key := strings.Join(parts[:3], ".")
+		if prev := addrs[key]; prev != nil && prev.To4() != nil {
+			continue
+		}
+		addrs[key] = ip
+	}
+	return addrs, nil
+}
+
+// chassisID returns the lldpRemChassisId in r as a string.
+func chassisID(r row) string {
+	b := pduBytes(r[lldpRemChassisID])
+	if pduInt(r[lldpRemChassisIDSubtype]) == lldpChassisMAC && len(b) == 6 {
+		return net.HardwareAddr(b).String()
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func sortNeighbors(n []neighbor) {
+	sort.Slice(n, func(i, j int) bool { return n[i].local < n[j].local })
+}
+
+func pduBytes(pdu gosnmp.SnmpPDU) []byte {
+	if b, ok := pdu.Value.([]byte); ok {
+		return b
+	}
+	return nil
+}
+
+func pduString(pdu gosnmp.SnmpPDU) string {
+	return strings.TrimSpace(string(pduBytes(pdu)))
+}
+
+func pduInt(pdu gosnmp.SnmpPDU) int {
+	if pdu.Value == nil {
+		return 0
+	}
+	return int(gosnmp.ToBigInt(pdu.Value).Int64())
+}
@@ -0,0 +1,105 @@
+// Package snmp provides a method for doing neighbor discovery by walking the CDP and LLDP
+// neighbor tables (CISCO-CDP-MIB and LLDP-MIB) of a device via SNMP v2c or v3.
+package snmp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/johnsiilver/netcrawl/network"
+	"golang.org/x/time/rate"
+)
+
+// Discover will try to discover a node's neighbors by walking its CDP and LLDP MIBs.
+type Discover struct {
+	configs []*gosnmp.GoSNMP
+	logins  *rate.Limiter
+}
+
+// Option is an optional argument to New().
+type Option func(d *Discover)
+
+// WithLoginLimiter limits how fast the Discover tries to login, each config tried is one
+// login. l may be shared by more than one Discover.
+func WithLoginLimiter(l *rate.Limiter) Option {
+	return func(d *Discover) {
+		d.logins = l
+	}
+}
+
+// New is the constructor for Discover. configs are templates, Target is ignored and
+// replaced with the IP of the node being discovered.
+func New(configs []*gosnmp.GoSNMP, options ...Option) (*Discover, error) {
+	d := &Discover{configs: configs}
+	for _, o := range options {
+		o(d)
+	}
+	return d, nil
+}
+
+// Node queries node.IP via SNMP and fills out our Neighbors.
+func (d *Discover) Node(ctx context.Context, node *network.Node) error {
+	var neighbors []neighbor
+	var err error
+
+	for _, conf := range d.configs {
+		neighbors, err = d.walkNeighbors(ctx, node, conf)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("could not query node(%s) via SNMP: %w", node.IP.String(), ctx.Err())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not query node(%s) via SNMP with any provided credentials, last error was: %s", node.IP.String(), err)
+	}
+
+	for _, n := range neighbors {
+		node.SetNeighbor(n.local, n.node)
+		node.SetLinkDetail(n.local, n.link)
+	}
+	return nil
+}
+
+func (d *Discover) walkNeighbors(ctx context.Context, node *network.Node, conf *gosnmp.GoSNMP) ([]neighbor, error) {
+	if d.logins != nil {
+		if err := d.logins.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ag, err := dialer(ctx, node.IP.String(), conf)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to SNMP agent: %s", err)
+	}
+	defer ag.close()
+
+	cdp, cdpErr := cdpNeighbors(ag)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	lldp, lldpErr := lldpNeighbors(ag)
+
+	// Empty tables are a device with no neighbors, like a leaf switch, not a failure.
+	if cdpErr != nil && lldpErr != nil {
+		return nil, fmt.Errorf("CDP walk error: %s, LLDP walk error: %s", cdpErr, lldpErr)
+	}
+
+	// CDP is preferred when a device speaks both, as it gives us a better platform string.
+	// The MIBs name local ports differently, so we also match LLDP neighbors on IP.
+	seen := map[string]bool{}
+	var neighbors []neighbor
+	for _, n := range cdp {
+		seen[string(n.local)] = true
+		seen[n.node.IP.String()] = true
+		neighbors = append(neighbors, n)
+	}
+	for _, n := range lldp {
+		if seen[string(n.local)] || seen[n.node.IP.String()] {
+			continue
+		}
+		neighbors = append(neighbors, n)
+	}
+	return neighbors, nil
+}
@@ -0,0 +1,235 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/johnsiilver/netcrawl/network"
+	"github.com/kylelemons/godebug/pretty"
+	"golang.org/x/time/rate"
+)
+
+func init() {
+	FakeAgents(
+		map[string]map[string]interface{}{
+			// A Cisco switch with two CDP neighbors, one of which also shows up in LLDP, plus
+			// an LLDP only neighbor.
+			"192.168.0.1": {
+				"1.3.6.1.2.1.31.1.1.1.1.1": "Fa0/1",
+				"1.3.6.1.2.1.31.1.1.1.1.2": "Fa0/2",
+				"1.3.6.1.2.1.2.2.1.2.1":    "FastEthernet0/1",
+				"1.3.6.1.2.1.2.2.1.2.2":    "FastEthernet0/2",
+
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.3.1.5":  1,
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.4.1.5":  []byte{192, 168, 0, 2},
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.6.1.5":  "nodeB",
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.7.1.5":  "FastEthernet0/1",
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.8.1.5":  "cisco WS-C2950-12",
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.3.2.10": 1,
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.4.2.10": []byte{192, 168, 0, 3},
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.6.2.10": "nodeC",
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.7.2.10": "GigabitEthernet0/1",
+				"1.3.6.1.4.1.9.9.23.1.2.1.1.8.2.10": "Cisco 2621XM",
+
+				"1.0.8802.1.1.2.1.3.7.1.2.1": 5,
+				"1.0.8802.1.1.2.1.3.7.1.3.1": "Fa0/1",
+				"1.0.8802.1.1.2.1.3.7.1.4.1": "FastEthernet0/1",
+				// The port ID is the interface name, the description is free text.
+				"1.0.8802.1.1.2.1.3.7.1.2.3": 5,
+				"1.0.8802.1.1.2.1.3.7.1.3.3": "Fa0/3",
+				"1.0.8802.1.1.2.1.3.7.1.4.3": "uplink to nodeD",
+				// The port ID is a MAC address, so the description is used.
+				"1.0.8802.1.1.2.1.3.7.1.2.4": 3,
+				"1.0.8802.1.1.2.1.3.7.1.3.4": []byte{0x00, 0x1c, 0x73, 0x00, 0x00, 0x04},
+				"1.0.8802.1.1.2.1.3.7.1.4.4": "Fa0/4",
+
+				"1.0.8802.1.1.2.1.4.1.1.9.0.1.1":  "nodeB",
+				"1.0.8802.1.1.2.1.4.1.1.10.0.1.1": "Cisco IOS Software",
+				"1.0.8802.1.1.2.1.4.1.1.4.0.3.2":  4,
+				"1.0.8802.1.1.2.1.4.1.1.5.0.3.2":  []byte{0x00, 0x1c, 0x73, 0x00, 0x00, 0x03},
+				"1.0.8802.1.1.2.1.4.1.1.7.0.3.2":  "ge-0/0/0",
+				"1.0.8802.1.1.2.1.4.1.1.9.0.3.2":  "nodeD",
+				"1.0.8802.1.1.2.1.4.1.1.10.0.3.2": "Juniper Networks, Inc. ex2300-24t\nJUNOS 18.4R2",
+				"1.0.8802.1.1.2.1.4.1.1.7.0.4.3":  "Ethernet1",
+				"1.0.8802.1.1.2.1.4.1.1.9.0.4.3":  "nodeE",
+				"1.0.8802.1.1.2.1.4.1.1.10.0.4.3": "Arista Networks EOS",
+
+				"1.0.8802.1.1.2.1.4.2.1.3.0.1.1.1.4.192.168.0.2":                          2,
+				"1.0.8802.1.1.2.1.4.2.1.3.0.3.2.2.16.32.1.13.184.0.0.0.0.0.0.0.0.0.0.0.4": 2,
+				"1.0.8802.1.1.2.1.4.2.1.3.0.3.2.1.4.192.168.0.4":                          2,
+				"1.0.8802.1.1.2.1.4.2.1.3.0.4.3.1.4.192.168.0.7":                          2,
+			},
+			// An agent that answers, but has no neighbor tables.
+			"192.168.0.5": {
+				"1.3.6.1.2.1.31.1.1.1.1.1": "Fa0/1",
+			},
+		},
+	)
+}
+
+func TestNode(t *testing.T) {
+	tests := []struct {
+		desc      string
+		ip        string
+		want      map[network.NodeInterface]*network.Node
+		wantLinks map[network.NodeInterface]*network.LinkDetail
+		wantErr   bool
+	}{
+		{
+			desc: "CDP and LLDP neighbors",
+			ip:   "192.168.0.1",
+			want: map[network.NodeInterface]*network.Node{
+				"Fa0/1": &network.Node{
+					IP:       net.IP{192, 168, 0, 2},
+					IPs:      []net.IP{{192, 168, 0, 2}},
+					Type:     "cisco WS-C2950-12",
+					DeviceID: "nodeB",
+				},
+				"Fa0/2": &network.Node{
+					IP:       net.IP{192, 168, 0, 3},
+					IPs:      []net.IP{{192, 168, 0, 3}},
+					Type:     "Cisco 2621XM",
+					DeviceID: "nodeC",
+				},
+				"Fa0/3": &network.Node{
+					IP:        net.IP{192, 168, 0, 4},
+					IPs:       []net.IP{{192, 168, 0, 4}},
+					Type:      "Juniper Networks, Inc. ex2300-24t",
+					DeviceID:  "nodeD",
+					ChassisID: "00:1c:73:00:00:03",
+				},
+				"Fa0/4": &network.Node{
+					IP:       net.IP{192, 168, 0, 7},
+					IPs:      []net.IP{{192, 168, 0, 7}},
+					Type:     "Arista Networks EOS",
+					DeviceID: "nodeE",
+				},
+			},
+			wantLinks: map[network.NodeInterface]*network.LinkDetail{
+				"Fa0/1": {Protocol: network.ProtoCDP, RemoteInterface: "FastEthernet0/1"},
+				"Fa0/2": {Protocol: network.ProtoCDP, RemoteInterface: "GigabitEthernet0/1"},
+				"Fa0/3": {Protocol: network.ProtoLLDP, RemoteInterface: "ge-0/0/0"},
+				"Fa0/4": {Protocol: network.ProtoLLDP, RemoteInterface: "Ethernet1"},
+			},
+		},
+		{
+			desc: "No neighbors",
+			ip:   "192.168.0.5",
+		},
+		{
+			desc:    "Agent doesn't answer",
+			ip:      "192.168.0.6",
+			wantErr: true,
+		},
+	}
+
+	d, err := New(nil)
+	if err != nil {
+		t.Fatalf("TestNode: New() had error: %s", err)
+	}
+	// We need at least one credential to try, the fake ignores it.
+	d.configs = append(d.configs, nil)
+
+	for _, test := range tests {
+		node := &network.Node{IP: net.ParseIP(test.ip), Type: "RootNode"}
+		err := d.Node(context.Background(), node)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestNode(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestNode(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if diff := pretty.Compare(test.want, node.Neighbors); diff != "" {
+			t.Errorf("TestNode(%s): -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantLinks, node.LinkDetails); diff != "" {
+			t.Errorf("TestNode(%s): links -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	fakeDialer := dialer
+	defer func() { dialer = fakeDialer }()
+	logins := 0
+	dialer = func(ctx context.Context, target string, conf *gosnmp.GoSNMP) (agent, error) {
+		logins++
+		return fakeDialer(ctx, target, conf)
+	}
+
+	// Only two logins are allowed for the rest of the test.
+	d, err := New(nil, WithLoginLimiter(rate.NewLimiter(rate.Every(time.Hour), 2)))
+	if err != nil {
+		t.Fatalf("TestLoginLimiter: New() had error: %s", err)
+	}
+	d.configs = append(d.configs, nil, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Node(ctx, &network.Node{IP: net.ParseIP("192.168.0.6"), Type: "RootNode"}); err == nil {
+		t.Fatalf("TestLoginLimiter: got err == nil, want err != nil")
+	}
+	if logins != 2 {
+		t.Errorf("TestLoginLimiter: got %d logins, want 2", logins)
+	}
+}
+
+// cancelAgent cancels the walk's Context after its first walk, and counts the walks that
+// were answered.
+type cancelAgent struct {
+	agent
+	cancel context.CancelFunc
+	walks  *int
+}
+
+func (c cancelAgent) bulkWalk(oid string) ([]gosnmp.SnmpPDU, error) {
+	defer c.cancel()
+	pdus, err := c.agent.bulkWalk(oid)
+	if err == nil {
+		*c.walks++
+	}
+	return pdus, err
+}
+
+func TestNodeCancel(t *testing.T) {
+	fakeDialer := dialer
+	defer func() { dialer = fakeDialer }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logins, walks := 0, 0
+	dialer = func(ctx context.Context, target string, conf *gosnmp.GoSNMP) (agent, error) {
+		logins++
+		ag, err := fakeDialer(ctx, target, conf)
+		if err != nil {
+			return nil, err
+		}
+		return cancelAgent{agent: ag, cancel: cancel, walks: &walks}, nil
+	}
+
+	d, err := New(nil)
+	if err != nil {
+		t.Fatalf("TestNodeCancel: New() had error: %s", err)
+	}
+	d.configs = append(d.configs, nil, nil)
+
+	err = d.Node(ctx, &network.Node{IP: net.ParseIP("192.168.0.1"), Type: "RootNode"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("TestNodeCancel: got err == %v, want context.Canceled", err)
+	}
+	if walks != 1 {
+		t.Errorf("TestNodeCancel: got %d walks, want 1", walks)
+	}
+	if logins != 1 {
+		t.Errorf("TestNodeCancel: got %d logins, want 1", logins)
+	}
+}
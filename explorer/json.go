@@ -0,0 +1,92 @@
+package explorer
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// resultsJSON is the JSON representation of Results.
+type resultsJSON struct {
+	Topology      network.Topology
+	LoginDeny     []LoginDeny `json:",omitempty"`
+	ParseErrors   []string    `json:",omitempty"`
+	HostKeyErrors []LoginDeny `json:",omitempty"`
+	Incomplete    bool        `json:",omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The NetworkMap and Seeds are output as a
+// network.Topology, Graph is rebuilt from it by UnmarshalJSON.
+func (r Results) MarshalJSON() ([]byte, error) {
+	rj := resultsJSON{
+		LoginDeny:     r.LoginDeny,
+		HostKeyErrors: r.HostKeyErrors,
+		Incomplete:    r.Incomplete,
+	}
+	switch {
+	case len(r.Seeds) > 0:
+		rj.Topology = network.ToTopology(r.Seeds...)
+	case r.NetworkMap != nil:
+		rj.Topology = network.ToTopology(r.NetworkMap)
+	}
+	for _, err := range r.ParseErrors {
+		rj.ParseErrors = append(rj.ParseErrors, err.Error())
+	}
+	return json.Marshal(rj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Results) UnmarshalJSON(b []byte) error {
+	rj := resultsJSON{}
+	if err := json.Unmarshal(b, &rj); err != nil {
+		return err
+	}
+
+	seeds, err := rj.Topology.SeedGraph()
+	if err != nil {
+		return err
+	}
+
+	*r = Results{
+		NetworkMap:    seeds[0],
+		Seeds:         seeds,
+		Graph:         network.NewGraph(seeds...),
+		LoginDeny:     rj.LoginDeny,
+		HostKeyErrors: rj.HostKeyErrors,
+		Incomplete:    rj.Incomplete,
+	}
+	for _, s := range rj.ParseErrors {
+		r.ParseErrors = append(r.ParseErrors, errors.New(s))
+	}
+	return nil
+}
+
+type loginDenyJSON struct {
+	IP  net.IP
+	Err string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (l LoginDeny) MarshalJSON() ([]byte, error) {
+	lj := loginDenyJSON{IP: l.IP}
+	if l.Err != nil {
+		lj.Err = l.Err.Error()
+	}
+	return json.Marshal(lj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (l *LoginDeny) UnmarshalJSON(b []byte) error {
+	lj := loginDenyJSON{}
+	if err := json.Unmarshal(b, &lj); err != nil {
+		return err
+	}
+	l.IP = lj.IP
+	l.Err = nil
+	if lj.Err != "" {
+		l.Err = errors.New(lj.Err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package explorer
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/johnsiilver/netcrawl/explorer/config"
+)
+
+// limiter bounds how many nodes we discover at once, overall and per subnet. How fast we
+// log into them is limited by the Discoveries, as a node may take several logins.
+type limiter struct {
+	workers chan struct{}
+
+	subnetMax int
+	subnetV4  net.IPMask
+	subnetV6  net.IPMask
+
+	mu      sync.Mutex
+	subnets map[string]chan struct{}
+}
+
+func newLimiter(l config.Limits) *limiter {
+	v4, v6 := l.SubnetPrefixLen()
+	return &limiter{
+		workers:   make(chan struct{}, l.WorkerLimit()),
+		subnetMax: l.SubnetConcurrency,
+		subnetV4:  net.CIDRMask(v4, 32),
+		subnetV6:  net.CIDRMask(v6, 128),
+		subnets:   map[string]chan struct{}{},
+	}
+}
+
+// acquire blocks until we are allowed to discover the node at ip. release must be called
+// when discovery is done.
+func (l *limiter) acquire(ctx context.Context, ip net.IP) (release func(), err error) {
+	var subnet chan struct{}
+	if l.subnetMax > 0 {
+		subnet = l.subnet(ip)
+		select {
+		case subnet <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	releaseSubnet := func() {
+		if subnet != nil {
+			<-subnet
+		}
+	}
+
+	select {
+	case l.workers <- struct{}{}:
+	case <-ctx.Done():
+		releaseSubnet()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-l.workers
+		releaseSubnet()
+	}, nil
+}
+
+// subnet returns the semaphore for the subnet ip is in.
+func (l *limiter) subnet(ip net.IP) chan struct{} {
+	var key string
+	if ip4 := ip.To4(); ip4 != nil {
+		key = ip4.Mask(l.subnetV4).String()
+	} else {
+		key = ip.Mask(l.subnetV6).String()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.subnets[key]
+	if !ok {
+		s = make(chan struct{}, l.subnetMax)
+		l.subnets[key] = s
+	}
+	return s
+}
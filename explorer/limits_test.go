@@ -0,0 +1,51 @@
+package explorer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/johnsiilver/netcrawl/explorer/config"
+)
+
+func TestLimiter(t *testing.T) {
+	lim := newLimiter(config.Limits{Workers: 2, SubnetConcurrency: 1})
+
+	// tryAcquire returns true if we could acquire a slot for ip without blocking for long.
+	tryAcquire := func(ip string) (func(), bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		release, err := lim.acquire(ctx, net.ParseIP(ip))
+		if err != nil {
+			return nil, false
+		}
+		return release, true
+	}
+
+	releaseA, ok := tryAcquire("192.168.0.1")
+	if !ok {
+		t.Fatalf("TestLimiter: could not acquire first slot")
+	}
+
+	if _, ok := tryAcquire("192.168.0.2"); ok {
+		t.Fatalf("TestLimiter: acquired a second slot in the same subnet, SubnetConcurrency should have blocked")
+	}
+
+	releaseB, ok := tryAcquire("192.168.1.1")
+	if !ok {
+		t.Fatalf("TestLimiter: could not acquire a slot in a different subnet")
+	}
+
+	if _, ok := tryAcquire("192.168.2.1"); ok {
+		t.Fatalf("TestLimiter: acquired a third slot, Workers should have blocked")
+	}
+
+	releaseA()
+	releaseB()
+
+	if _, ok := tryAcquire("192.168.0.2"); !ok {
+		t.Fatalf("TestLimiter: could not acquire a slot after releasing")
+	}
+}
@@ -0,0 +1,94 @@
+package explorer
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/johnsiilver/netcrawl/explorer/config"
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// scope is the compiled form of config.Scope.
+type scope struct {
+	include  []*net.IPNet
+	exclude  []*net.IPNet
+	maxDepth int
+	skip     []*regexp.Regexp
+}
+
+func newScope(conf config.Scope) (*scope, error) {
+	s := &scope{maxDepth: conf.MaxDepth}
+
+	var err error
+	if s.include, err = parseCIDRs(conf.Include); err != nil {
+		return nil, fmt.Errorf("Scope.Include: %s", err)
+	}
+	if s.exclude, err = parseCIDRs(conf.Exclude); err != nil {
+		return nil, fmt.Errorf("Scope.Exclude: %s", err)
+	}
+	for _, p := range conf.SkipPlatforms {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Scope.SkipPlatforms: %s", err)
+		}
+		s.skip = append(s.skip, re)
+	}
+	return s, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// tooDeep returns true if a node depth hops from the root is past MaxDepth.
+func (s *scope) tooDeep(depth int) bool {
+	return s.maxDepth > 0 && depth > s.maxDepth
+}
+
+func (s *scope) depthReason() string {
+	return fmt.Sprintf("more than %d hops from the root", s.maxDepth)
+}
+
+// excluded returns why n should not be explored no matter how it was reached, or an empty
+// string. A node is in a prefix if any of its addresses is.
+func (s *scope) excluded(n *network.Node) string {
+	ips := n.AllIPs()
+	for _, ipNet := range s.exclude {
+		for _, ip := range ips {
+			if ipNet.Contains(ip) {
+				return fmt.Sprintf("in excluded prefix %s", ipNet)
+			}
+		}
+	}
+
+	if len(s.include) > 0 {
+		included := false
+		for _, ipNet := range s.include {
+			for _, ip := range ips {
+				if ipNet.Contains(ip) {
+					included = true
+					break
+				}
+			}
+		}
+		if !included {
+			return "not in an included prefix"
+		}
+	}
+
+	for _, re := range s.skip {
+		if re.MatchString(n.Type) {
+			return fmt.Sprintf("platform %q matches skipped platform %q", n.Type, re.String())
+		}
+	}
+	return ""
+}
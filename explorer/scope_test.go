@@ -0,0 +1,65 @@
+package explorer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/johnsiilver/netcrawl/explorer/config"
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+func TestExcluded(t *testing.T) {
+	s, err := newScope(config.Scope{Include: []string{"10.0.0.0/8"}, Exclude: []string{"10.9.0.0/16"}, SkipPlatforms: []string{"(?i)phone"}})
+	if err != nil {
+		t.Fatalf("TestExcluded: newScope() had error: %s", err)
+	}
+
+	tests := []struct {
+		desc string
+		ips  []string
+		typ  string
+		want bool
+	}{
+		{desc: "Included", ips: []string{"10.0.0.1"}},
+		{desc: "Not included", ips: []string{"192.168.0.1"}, want: true},
+		{desc: "Other address included", ips: []string{"192.168.0.1", "10.0.0.1"}},
+		{desc: "Excluded", ips: []string{"10.9.0.1"}, want: true},
+		{desc: "Other address excluded", ips: []string{"10.0.0.1", "10.9.0.1"}, want: true},
+		{desc: "Skipped platform", ips: []string{"10.0.0.1"}, typ: "Cisco IP Phone 7960", want: true},
+	}
+
+	for _, test := range tests {
+		n := &network.Node{Type: test.typ}
+		for _, ip := range test.ips {
+			n.IPs = append(n.IPs, net.ParseIP(ip))
+		}
+		n.IP = n.IPs[0]
+
+		got := s.excluded(n)
+		if (got != "") != test.want {
+			t.Errorf("TestExcluded(%s): got %q, want excluded == %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestTooDeep(t *testing.T) {
+	tests := []struct {
+		maxDepth int
+		depth    int
+		want     bool
+	}{
+		{maxDepth: 0, depth: 100},
+		{maxDepth: 2, depth: 2},
+		{maxDepth: 2, depth: 3, want: true},
+	}
+
+	for _, test := range tests {
+		s, err := newScope(config.Scope{MaxDepth: test.maxDepth})
+		if err != nil {
+			t.Fatalf("TestTooDeep: newScope() had error: %s", err)
+		}
+		if got := s.tooDeep(test.depth); got != test.want {
+			t.Errorf("TestTooDeep(MaxDepth %d, depth %d): got %v, want %v", test.maxDepth, test.depth, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Package sweep finds devices in a set of prefixes by probing the ports that network devices
+// are managed on: SSH (TCP/22), telnet (TCP/23) and SNMP (UDP/161). Devices that don't run
+// CDP or LLDP never show up as a neighbor, so a sweep of the management networks is how
+// those orphans get into a crawl, as extra seeds.
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/johnsiilver/netcrawl/explorer/internal/snmp"
+)
+
+// Service is a management service a host answered on.
+type Service string
+
+// Services that are probed.
+const (
+	SSH    Service = "ssh"
+	Telnet Service = "telnet"
+	SNMP   Service = "snmp"
+)
+
+// Defaults for Sweeper.
+const (
+	DefaultConcurrency = 64
+	DefaultTimeout     = time.Second
+	DefaultMaxHosts    = 65536
+	DefaultSSHPort     = 22
+	DefaultTelnetPort  = 23
+)
+
+// sysObjectID is asked for by the SNMP probe, every agent has it.
+const sysObjectID = ".1.3.6.1.2.1.1.2.0"
+
+// Host is a host that answered on at least one Service.
+type Host struct {
+	IP       net.IP
+	Services []Service
+}
+
+// Sweeper probes the hosts in prefixes for management services.
+type Sweeper struct {
+	// Concurrency is the maximum number of probes in flight. Defaults to DefaultConcurrency.
+	Concurrency int
+	// Timeout is how long a single probe waits for an answer. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// MaxHosts is the most addresses a sweep may probe, so a typo like /8 doesn't probe
+	// millions of hosts. Defaults to DefaultMaxHosts.
+	MaxHosts int
+
+	// SSHPort and TelnetPort are the TCP ports probed. Default to DefaultSSHPort and
+	// DefaultTelnetPort.
+	SSHPort, TelnetPort int
+	// Ports, if set, returns the SSH and telnet ports to probe on ip instead of SSHPort and
+	// TelnetPort. A host answers on a service if any of its ports does.
+	Ports func(ip net.IP) (ssh, telnet []int)
+	// SNMP are templates for the SNMP probe, Target is ignored. A host answers on SNMP if
+	// any of them gets a response. If empty, v2c with community "public" is used.
+	SNMP []*gosnmp.GoSNMP
+	// SNMPPort, if set, overrides the port of the SNMP templates.
+	SNMPPort int
+}
+
+// probe is a single service to probe on a single host.
+type probe struct {
+	ip      net.IP
+	service Service
+}
+
+// Sweep probes every host address in prefixes and returns the hosts that answered, sorted
+// by IP. Sweep only fails if a prefix is bad or ctx is done before the sweep finishes.
+func (s *Sweeper) Sweep(ctx context.Context, prefixes ...string) ([]Host, error) {
+	max := s.MaxHosts
+	if max <= 0 {
+		max = DefaultMaxHosts
+	}
+
+	var ips []net.IP
+	seen := map[string]bool{}
+	for _, p := range prefixes {
+		hosts, err := Hosts(p, max)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range hosts {
+			if !seen[ip.String()] {
+				seen[ip.String()] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) > max {
+		return nil, fmt.Errorf("prefixes have more than %d hosts", max)
+	}
+
+	workers := s.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+
+	probes := make(chan probe)
+	found := map[string]*Host{}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range probes {
+				if !s.probe(ctx, p) {
+					continue
+				}
+				mu.Lock()
+				h, ok := found[p.ip.String()]
+				if !ok {
+					h = &Host{IP: p.ip}
+					found[p.ip.String()] = h
+				}
+				h.Services = append(h.Services, p.service)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, ip := range ips {
+		for _, svc := range []Service{SSH, Telnet, SNMP} {
+			select {
+			case <-ctx.Done():
+				break feed
+			case probes <- probe{ip: ip, service: svc}:
+			}
+		}
+	}
+	close(probes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("sweep did not finish: %s", err)
+	}
+
+	hosts := make([]Host, 0, len(found))
+	for _, h := range found {
+		sort.Slice(h.Services, func(i, j int) bool { return order(h.Services[i]) < order(h.Services[j]) })
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := hosts[i].IP, hosts[j].IP
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return new(big.Int).SetBytes(a).Cmp(new(big.Int).SetBytes(b)) < 0
+	})
+	return hosts, nil
+}
+
+// order returns where svc goes in Host.Services.
+func order(svc Service) int {
+	switch svc {
+	case SSH:
+		return 0
+	case Telnet:
+		return 1
+	}
+	return 2
+}
+
+// probe returns true if p.ip answers on p.service.
+func (s *Sweeper) probe(ctx context.Context, p probe) bool {
+	if p.service == SNMP {
+		return s.probeSNMP(ctx, p.ip)
+	}
+	for _, port := range s.ports(p) {
+		if s.probeTCP(ctx, p.ip, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// ports returns the TCP ports to probe for p.
+func (s *Sweeper) ports(p probe) []int {
+	if s.Ports != nil {
+		ssh, telnet := s.Ports(p.ip)
+		if p.service == SSH {
+			return ssh
+		}
+		return telnet
+	}
+	if p.service == SSH {
+		return []int{PortOr(s.SSHPort, DefaultSSHPort)}
+	}
+	return []int{PortOr(s.TelnetPort, DefaultTelnetPort)}
+}
+
+// probeTCP returns true if a TCP connection to ip:port can be made.
+func (s *Sweeper) probeTCP(ctx context.Context, ip net.IP, port int) bool {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// probeSNMP returns true if the agent on ip answers a GET with any of the SNMP templates.
+func (s *Sweeper) probeSNMP(ctx context.Context, ip net.IP) bool {
+	templates := s.SNMP
+	if len(templates) == 0 {
+		templates = []*gosnmp.GoSNMP{{Port: 161, Transport: "udp", Version: gosnmp.Version2c, Community: "public"}}
+	}
+	for _, t := range templates {
+		if ctx.Err() != nil {
+			return false
+		}
+		g := snmp.Clone(t)
+		g.Target = ip.String()
+		g.Context = ctx
+		g.Timeout = s.timeout()
+		g.Retries = 0
+		if s.SNMPPort > 0 {
+			g.Port = uint16(s.SNMPPort)
+		}
+		if g.Port == 0 {
+			g.Port = 161
+		}
+		if err := g.Connect(); err != nil {
+			continue
+		}
+		_, err := g.Get([]string{sysObjectID})
+		g.Conn.Close()
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sweeper) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// PortOr returns port, or def if port isn't set.
+func PortOr(port, def int) int {
+	if port > 0 {
+		return port
+	}
+	return def
+}
+
+// Hosts returns the host addresses in cidr. For IPv4 prefixes shorter than /31, the network
+// and broadcast addresses are left out. It is an error for cidr to have more than max hosts.
+func Hosts(cidr string, max int) ([]net.IP, error) {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := n.Mask.Size()
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	first, last := big.NewInt(0), size
+	if bits == 32 && ones < 31 {
+		first, last = big.NewInt(1), new(big.Int).Sub(size, big.NewInt(1))
+	}
+	if count := new(big.Int).Sub(last, first); count.Cmp(big.NewInt(int64(max))) > 0 {
+		return nil, fmt.Errorf("%s has more than %d hosts", cidr, max)
+	}
+
+	base := new(big.Int).SetBytes(n.IP)
+	var hosts []net.IP
+	for i := new(big.Int).Set(first); i.Cmp(last) < 0; i.Add(i, big.NewInt(1)) {
+		b := new(big.Int).Add(base, i).Bytes()
+		ip := make(net.IP, len(n.IP))
+		copy(ip[len(ip)-len(b):], b)
+		hosts = append(hosts, ip)
+	}
+	return hosts, nil
+}
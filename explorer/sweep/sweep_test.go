@@ -0,0 +1,194 @@
+package sweep
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// listenTCP starts a TCP listener on addr that accepts and closes connections.
+func listenTCP(t *testing.T, addr string) (net.Listener, int) {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l, l.Addr().(*net.TCPAddr).Port
+}
+
+// listenSNMP starts an SNMP agent on addr that answers GETs with community.
+func listenSNMP(t *testing.T, addr, community string) (net.PacketConn, int) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		dec := &gosnmp.GoSNMP{Version: gosnmp.Version2c}
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := dec.SnmpDecodePacket(buf[:n])
+			if err != nil || req.Community != community {
+				continue
+			}
+			req.PDUType = gosnmp.GetResponse
+			for i := range req.Variables {
+				req.Variables[i].Type = gosnmp.ObjectIdentifier
+				req.Variables[i].Value = ".1.3.6.1.4.1.9.1.1"
+			}
+			b, err := req.MarshalMsg()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(b, from)
+		}
+	}()
+	return conn, conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestSweep(t *testing.T) {
+	ssh, sshPort := listenTCP(t, "127.0.0.2:0")
+	defer ssh.Close()
+	telnet, telnetPort := listenTCP(t, "127.0.0.3:0")
+	defer telnet.Close()
+	both, _ := listenTCP(t, net.JoinHostPort("127.0.0.5", strconv.Itoa(sshPort)))
+	defer both.Close()
+	snmp, snmpPort := listenSNMP(t, "127.0.0.4:0", "test")
+	defer snmp.Close()
+	// This agent only answers a community the sweep doesn't have.
+	other, _ := listenSNMP(t, net.JoinHostPort("127.0.0.6", strconv.Itoa(snmpPort)), "other")
+	defer other.Close()
+	snmpBoth, _ := listenSNMP(t, net.JoinHostPort("127.0.0.5", strconv.Itoa(snmpPort)), "test")
+	defer snmpBoth.Close()
+
+	s := &Sweeper{
+		Concurrency: 4,
+		Timeout:     500 * time.Millisecond,
+		SSHPort:     sshPort,
+		TelnetPort:  telnetPort,
+		SNMP: []*gosnmp.GoSNMP{
+			{Version: gosnmp.Version2c, Transport: "udp", Community: "wrong"},
+			{Version: gosnmp.Version2c, Transport: "udp", Community: "test"},
+		},
+		SNMPPort: snmpPort,
+	}
+
+	got, err := s.Sweep(context.Background(), "127.0.0.0/29", "127.0.0.2/32")
+	if err != nil {
+		t.Fatalf("TestSweep: had error: %s", err)
+	}
+	want := []Host{
+		{IP: net.ParseIP("127.0.0.2").To4(), Services: []Service{SSH}},
+		{IP: net.ParseIP("127.0.0.3").To4(), Services: []Service{Telnet}},
+		{IP: net.ParseIP("127.0.0.4").To4(), Services: []Service{SNMP}},
+		{IP: net.ParseIP("127.0.0.5").To4(), Services: []Service{SSH, SNMP}},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestSweep: -want/+got:\n%s", diff)
+	}
+
+	s.MaxHosts = 4
+	if _, err := s.Sweep(context.Background(), "127.0.0.0/29"); err == nil {
+		t.Errorf("TestSweep(too many hosts): got err == nil, want err != nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.MaxHosts = 0
+	if _, err := s.Sweep(ctx, "127.0.0.0/29"); err == nil {
+		t.Errorf("TestSweep(cancelled): got err == nil, want err != nil")
+	}
+}
+
+func TestSweepPorts(t *testing.T) {
+	ssh, sshPort := listenTCP(t, "127.0.0.2:0")
+	defer ssh.Close()
+	telnet, telnetPort := listenTCP(t, "127.0.0.3:0")
+	defer telnet.Close()
+	closed, closedPort := listenTCP(t, "127.0.0.2:0")
+	closed.Close()
+
+	s := &Sweeper{
+		Timeout: 500 * time.Millisecond,
+		// Nothing answers SNMP on the SSH port.
+		SNMPPort: sshPort,
+		Ports: func(ip net.IP) ([]int, []int) {
+			switch ip.String() {
+			case "127.0.0.2":
+				return []int{closedPort, sshPort}, []int{sshPort}
+			case "127.0.0.3":
+				return nil, []int{telnetPort}
+			}
+			return nil, nil
+		},
+	}
+
+	got, err := s.Sweep(context.Background(), "127.0.0.2/31")
+	if err != nil {
+		t.Fatalf("TestSweepPorts: had error: %s", err)
+	}
+	want := []Host{
+		{IP: net.ParseIP("127.0.0.2").To4(), Services: []Service{SSH, Telnet}},
+		{IP: net.ParseIP("127.0.0.3").To4(), Services: []Service{Telnet}},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestSweepPorts: -want/+got:\n%s", diff)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		desc string
+		cidr string
+		max  int
+		want []string
+		err  bool
+	}{
+		{desc: "IPv4 /30", cidr: "10.0.0.0/30", max: 10, want: []string{"10.0.0.1", "10.0.0.2"}},
+		{desc: "IPv4 /31", cidr: "10.0.0.0/31", max: 10, want: []string{"10.0.0.0", "10.0.0.1"}},
+		{desc: "IPv4 /32", cidr: "10.0.0.7/32", max: 10, want: []string{"10.0.0.7"}},
+		{desc: "IPv6 /126", cidr: "2001:db8::/126", max: 10, want: []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{desc: "Too many hosts", cidr: "10.0.0.0/8", max: 4096, err: true},
+		{desc: "IPv6 too many hosts", cidr: "2001:db8::/32", max: 4096, err: true},
+		{desc: "Bad CIDR", cidr: "10.0.0.0", max: 10, err: true},
+	}
+
+	for _, test := range tests {
+		ips, err := Hosts(test.cidr, test.max)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestHosts(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestHosts(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		var got []string
+		for _, ip := range ips {
+			got = append(got, ip.String())
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestHosts(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/johnsiilver/netcrawl/explorer/config/secrets"
+	"golang.org/x/term"
+)
+
+// passphraseEnv is the environment variable that holds the keystore passphrase, for
+// when netcrawl isn't run from a terminal.
+const passphraseEnv = "NETCRAWL_KEYSTORE_PASSPHRASE"
+
+const keystoreUsage = `usage: netcrawl keystore [--keystore path] [--config path] set|delete|list [name]
+
+  set <name>     stores a secret, read from the terminal or stdin, creating the keystore if needed
+  delete <name>  removes a secret
+  list           lists the names of the secrets
+
+Reference a secret in netcrawl.conf with "keystore:<name>".`
+
+// keystorePassphrase returns the keystore passphrase from passphraseEnv, or asks for it
+// on the terminal.
+func keystorePassphrase() (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	return readSecret("Keystore passphrase: ")
+}
+
+// stdin is shared by reads of secrets, so that a passphrase and a secret can both be piped in.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readSecret reads a secret from the terminal without echoing it. If stdin isn't a terminal,
+// a line is read from it instead.
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("could not read secret from stdin: %s", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// runKeystore runs the keystore subcommand.
+func runKeystore(args []string) {
+	fs := flag.NewFlagSet("keystore", flag.ExitOnError)
+	path := fs.String("keystore", "", "The path to the keystore. Defaults to Secrets.Keystore in the config")
+	confPath := fs.String("config", "", "A config file, merged over "+localConfig+" and "+etcConfig)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, keystoreUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *path == "" {
+		conf, err := loadConfig(*confPath)
+		if err != nil {
+			exitf("--keystore not given and could not read the config:\n%s", err)
+		}
+		*path = conf.Secrets.Keystore
+	}
+	if *path == "" {
+		exitf("--keystore not given and the config has no Secrets.Keystore")
+	}
+
+	cmd, name := fs.Arg(0), fs.Arg(1)
+	switch {
+	case cmd == "list" && fs.NArg() == 1:
+	case (cmd == "set" || cmd == "delete") && fs.NArg() == 2 && name != "":
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	pass, err := keystorePassphrase()
+	if err != nil {
+		exitf("could not read the keystore passphrase: %s", err)
+	}
+
+	var ks *secrets.Keystore
+	if _, err := os.Stat(*path); os.IsNotExist(err) && cmd == "set" {
+		ks, err = secrets.CreateKeystore(*path, pass)
+		if err != nil {
+			exitf(err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "creating keystore %s\n", *path)
+	} else {
+		ks, err = secrets.OpenKeystore(*path, pass)
+		if err != nil {
+			exitf(err.Error())
+		}
+	}
+
+	switch cmd {
+	case "list":
+		for _, n := range ks.Names() {
+			fmt.Println(n)
+		}
+		return
+	case "set":
+		secret, err := readSecret(fmt.Sprintf("Secret for %s: ", name))
+		if err != nil {
+			exitf(err.Error())
+		}
+		if secret == "" {
+			exitf("secret must not be empty")
+		}
+		ks.Set(name, secret)
+	case "delete":
+		if !ks.Delete(name) {
+			exitf("keystore does not have secret %q", name)
+		}
+	}
+	if err := ks.Save(); err != nil {
+		exitf(err.Error())
+	}
+}
@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/johnsiilver/netcrawl/explorer"
 	"github.com/johnsiilver/netcrawl/explorer/config"
+	"github.com/johnsiilver/netcrawl/network"
+	"github.com/johnsiilver/netcrawl/network/render"
 )
 
 var (
-	rootNode = flag.String("root", "", "The IP/Hostname of the root device")
+	rootNode = flag.String("root", "", "The IP/Hostname of the root device, the first seed")
+	format   = flag.String("format", "text", "The output format: text, json, dot (Graphviz) or mermaid")
+	confPath = flag.String("config", "", "A config file, merged over "+localConfig+" and "+etcConfig)
 )
 
 func exitf(s string, a ...interface{}) {
@@ -22,67 +27,167 @@ func exitf(s string, a ...interface{}) {
 	os.Exit(1)
 }
 
-func loadConfig() (config.Config, error) {
-	const withBinary = "./netcrawl.conf"
-	const inETC = "/etc/netcrawl.conf"
+// Standard config file locations. The local file overrides the one in /etc.
+const (
+	localConfig = "./netcrawl.conf"
+	etcConfig   = "/etc/netcrawl.conf"
+)
 
-	conf := config.Config{}
-	if _, err := os.Stat(withBinary); err == nil {
-		b, err := ioutil.ReadFile(withBinary)
-		if err != nil {
-			return conf, err
+// configExts are the extensions a standard config file may have instead of .conf, for
+// YAML and TOML configs. The first one found at a location is used.
+var configExts = []string{".yaml", ".yml", ".toml"}
+
+// configFiles returns the config files to load, lowest precedence first: /etc/netcrawl.conf,
+// then ./netcrawl.conf, then path if it isn't empty. path must exist, the others are optional.
+func configFiles(path string) ([]string, error) {
+	var files []string
+	for _, loc := range []string{etcConfig, localConfig} {
+		candidates := []string{loc}
+		for _, ext := range configExts {
+			candidates = append(candidates, strings.TrimSuffix(loc, ".conf")+ext)
 		}
-		if err := json.Unmarshal(b, &conf); err != nil {
-			return conf, err
+		for _, f := range candidates {
+			if _, err := os.Stat(f); err == nil {
+				files = append(files, f)
+				break
+			}
 		}
 	}
-	if _, err := os.Stat(inETC); err == nil {
-		b, err := ioutil.ReadFile(inETC)
-		if err != nil {
-			return conf, err
-		}
-		if err := json.Unmarshal(b, &conf); err != nil {
-			return conf, err
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("--config: %s", err)
 		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config: pass --config or create %s or %s", localConfig, etcConfig)
 	}
+	return files, nil
+}
 
-	return conf, fmt.Errorf("netcrawl.conf not found in local directory or in etc")
+// loadConfig loads and merges the config files, see configFiles().
+func loadConfig(path string) (config.Config, error) {
+	files, err := configFiles(path)
+	if err != nil {
+		return config.Config{}, err
+	}
+	return config.Load(files...)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "keystore":
+			runKeystore(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		}
+	}
+	flag.Parse()
 	ctx := context.Background()
 
-	if *rootNode == "" {
-		exitf("must pass a non-blank --root")
+	seedList, err := seeds(*rootNode)
+	if err != nil {
+		exitf(err.Error())
+	}
+	switch *format {
+	case "text", "json", "dot", "mermaid":
+	default:
+		exitf("--format must be text, json, dot or mermaid, was %q", *format)
 	}
 
-	conf, err := loadConfig()
+	conf, err := loadConfig(*confPath)
 	if err != nil {
-		exitf(err.Error())
+		exitf("bad config:\n%s", err)
+	}
+	conf, err = conf.ResolveSecrets(ctx, keystorePassphrase)
+	if err != nil {
+		exitf("could not resolve secrets in the config: %s", err)
+	}
+
+	swept, err := sweepSeeds(ctx, conf)
+	if err != nil {
+		exitf("could not sweep for devices: %s", err)
+	}
+	seedList = dedupe(append(seedList, swept...))
+	if len(seedList) == 0 {
+		exitf("must pass --root, --seed, --seeds-file, --seed-cidr or --sweep, or the sweep found no devices")
 	}
 
-	ex, err := explorer.New(*rootNode, conf)
+	ex, err := explorer.NewSeeds(seedList, conf)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
 	results, err := ex.Explore(ctx)
+	ex.Close()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	if results.Incomplete {
+		fmt.Fprintln(os.Stderr, "WARNING: crawl deadline reached, the network was only partially explored")
+	}
 
-	l := explorer.List{}
-	for _, node := range l.List(results.NetworkMap) {
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			exitf("could not convert results to JSON: %s", err)
+		}
+		fmt.Println(string(b))
+	case "dot":
+		if err := render.DOT(os.Stdout, network.ToTopology(results.Seeds...)); err != nil {
+			exitf("could not render DOT: %s", err)
+		}
+	case "mermaid":
+		if err := render.Mermaid(os.Stdout, network.ToTopology(results.Seeds...)); err != nil {
+			exitf("could not render Mermaid: %s", err)
+		}
+	default:
+		printText(results)
+	}
+}
+
+func printText(results explorer.Results) {
+	for _, node := range results.Graph.Nodes {
 		fmt.Println("Node: ", node.IP.String())
+		if node.DeviceID != "" {
+			fmt.Println("\tDevice ID: ", node.DeviceID)
+		}
 		fmt.Println("\tType: ", node.Type)
-		if node.Error != nil {
+		if node.Seed != "" {
+			fmt.Println("\tSeed: ", node.Seed)
+		}
+		if ips := node.AllIPs(); len(ips) > 1 {
+			fmt.Println("\tIPs: ", ips)
+		}
+		if node.OutOfScope != "" {
+			fmt.Println("\tOut of scope: ", node.OutOfScope)
+		} else if node.Error != nil {
 			fmt.Println("\tError: ", node.Error)
 		} else {
 			fmt.Println("\tNeighbors:")
-			for k, v := range node.Neighbors {
-				fmt.Println("\t\t", k, ":", v.IP.String())
+			neighbors := node.CopyNeighbors()
+			inters := make([]network.NodeInterface, 0, len(neighbors))
+			for k := range neighbors {
+				inters = append(inters, k)
+			}
+			sort.Slice(inters, func(i, j int) bool { return inters[i] < inters[j] })
+			for _, k := range inters {
+				n := neighbors[k]
+				remote := ""
+				if d := node.LinkDetail(k); d != nil && d.RemoteInterface != "" {
+					remote = fmt.Sprintf(" (%s)", d.RemoteInterface)
+				}
+				name := n.IP.String()
+				if n.DeviceID != "" {
+					name = fmt.Sprintf("%s %s", n.DeviceID, name)
+				}
+				fmt.Printf("\t\t %s : %s%s\n", k, name, remote)
 			}
 		}
 	}
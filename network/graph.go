@@ -0,0 +1,152 @@
+package network
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Protocols that a link can be discovered by.
+const (
+	ProtoCDP  = "CDP"
+	ProtoLLDP = "LLDP"
+)
+
+// Endpoint is one end of a Link.
+type Endpoint struct {
+	Node *Node
+	// Interface is the interface on Node the link is connected to. May be empty if not known.
+	Interface NodeInterface
+}
+
+// Link is a link between two nodes.
+type Link struct {
+	// Local is the end the link was discovered from.
+	Local Endpoint
+	// Remote is the neighbor's end.
+	Remote Endpoint
+	// Bidirectional is set if the link was discovered from both ends.
+	Bidirectional bool
+	// Protocol is the protocol the link was discovered by, such as ProtoCDP. May be empty.
+	Protocol string
+	// Detail holds the link's attributes as announced by the remote end. May be nil.
+	Detail *LinkDetail
+	// RemoteDetail holds the link's attributes as announced by the local end, as the remote
+	// end has them. May be nil, it is only known if the link is Bidirectional.
+	RemoteDetail *LinkDetail
+}
+
+// Graph holds all the nodes reachable from one or more roots and the links between them. Unlike
+// Node.Neighbors, a Graph has the interface on both ends of a link.
+type Graph struct {
+	// Root is the node the graph was built from. If it was built from several, this is the first.
+	Root *Node
+	// Roots are all the nodes the graph was built from.
+	Roots []*Node
+	// Nodes are the nodes in the graph, sorted by IP.
+	Nodes []*Node
+	// Links are the links in the graph, sorted by Local node then interface. A link that was
+	// discovered from both ends is only listed once.
+	Links []*Link
+}
+
+// NewGraph builds a Graph from the nodes reachable from roots, such as the seeds of a crawl
+// that found separate parts of a network.
+func NewGraph(roots ...*Node) *Graph {
+	g := &Graph{}
+	seen := map[*Node]bool{}
+	var queue []*Node
+	for _, r := range roots {
+		if r == nil || seen[r] {
+			continue
+		}
+		g.Roots = append(g.Roots, r)
+		seen[r] = true
+		queue = append(queue, r)
+	}
+	if len(g.Roots) == 0 {
+		return g
+	}
+	g.Root = g.Roots[0]
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		g.Nodes = append(g.Nodes, n)
+		for _, neigh := range n.CopyNeighbors() {
+			if neigh != nil && !seen[neigh] {
+				seen[neigh] = true
+				queue = append(queue, neigh)
+			}
+		}
+	}
+	sort.SliceStable(g.Nodes, func(i, j int) bool { return bytes.Compare(g.Nodes[i].IP.To16(), g.Nodes[j].IP.To16()) < 0 })
+
+	// used records the interfaces that are already the remote end of a link.
+	used := map[Endpoint]bool{}
+	for _, n := range g.Nodes {
+		neighbors := n.CopyNeighbors()
+		for _, inter := range sortedInterfaces(neighbors) {
+			local := Endpoint{Node: n, Interface: inter}
+			if used[local] || neighbors[inter] == nil {
+				continue
+			}
+
+			l := &Link{Local: local, Remote: Endpoint{Node: neighbors[inter]}, Detail: n.LinkDetail(inter)}
+			if l.Detail != nil {
+				l.Protocol = l.Detail.Protocol
+				l.Remote.Interface = l.Detail.RemoteInterface
+			}
+			if remote, ok := matchRemote(local, l.Remote.Node, used); ok {
+				l.Remote.Interface = remote
+				l.Bidirectional = true
+				l.RemoteDetail = l.Remote.Node.LinkDetail(remote)
+				used[Endpoint{Node: l.Remote.Node, Interface: remote}] = true
+			}
+			g.Links = append(g.Links, l)
+		}
+	}
+	return g
+}
+
+// matchRemote finds the interface on neighbor that is the other end of the link at local.
+// ok is false if neighbor doesn't have local as a neighbor or we can't tell which of
+// several parallel links it is.
+func matchRemote(local Endpoint, neighbor *Node, used map[Endpoint]bool) (inter NodeInterface, ok bool) {
+	var candidates []NodeInterface
+	for k, v := range neighbor.CopyNeighbors() {
+		if v == local.Node && !used[Endpoint{Node: neighbor, Interface: k}] {
+			candidates = append(candidates, k)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	// Use what either end announced about the link to pair them.
+	if d := local.Node.LinkDetail(local.Interface); d != nil && d.RemoteInterface != "" {
+		for _, c := range candidates {
+			if c == d.RemoteInterface {
+				return c, true
+			}
+		}
+	}
+	for _, c := range candidates {
+		if d := neighbor.LinkDetail(c); d != nil && d.RemoteInterface == local.Interface {
+			return c, true
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return "", false
+}
+
+// LinksOf returns the links that have n at either end.
+func (g *Graph) LinksOf(n *Node) []*Link {
+	var links []*Link
+	for _, l := range g.Links {
+		if l.Local.Node == n || l.Remote.Node == n {
+			links = append(links, l)
+		}
+	}
+	return links
+}
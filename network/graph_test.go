@@ -0,0 +1,64 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestNewGraph(t *testing.T) {
+	nodeA := &Node{IP: net.ParseIP("192.168.0.1"), Type: "RootNode"}
+	nodeB := &Node{IP: net.ParseIP("192.168.0.2"), Type: "cisco WS-C2950-12"}
+	nodeC := &Node{IP: net.ParseIP("192.168.0.3"), Type: "Cisco IP Phone"}
+
+	// Two parallel links between A and B, which can only be paired using what CDP told us.
+	nodeA.SetNeighbor("Fa0/1", nodeB)
+	nodeA.SetLinkDetail("Fa0/1", &LinkDetail{Protocol: ProtoCDP, RemoteInterface: "Fa0/2"})
+	nodeA.SetNeighbor("Fa0/2", nodeB)
+	nodeA.SetLinkDetail("Fa0/2", &LinkDetail{Protocol: ProtoCDP, RemoteInterface: "Fa0/1"})
+	nodeB.SetNeighbor("Fa0/1", nodeA)
+	nodeB.SetNeighbor("Fa0/2", nodeA)
+	// C was never logged into, so we only know the link from B's end.
+	nodeB.SetNeighbor("Fa0/3", nodeC)
+	nodeB.SetLinkDetail("Fa0/3", &LinkDetail{Protocol: ProtoLLDP, RemoteInterface: "port 1"})
+
+	g := NewGraph(nodeA)
+
+	var gotNodes []string
+	for _, n := range g.Nodes {
+		gotNodes = append(gotNodes, n.IP.String())
+	}
+	wantNodes := []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"}
+	if diff := pretty.Compare(wantNodes, gotNodes); diff != "" {
+		t.Errorf("TestNewGraph: nodes -want/+got:\n%s", diff)
+	}
+
+	str := func(l *Link) string {
+		return fmt.Sprintf(
+			"%s(%s) - %s(%s) %s bidirectional=%v",
+			l.Local.Node.IP, l.Local.Interface, l.Remote.Node.IP, l.Remote.Interface, l.Protocol, l.Bidirectional,
+		)
+	}
+	var gotLinks []string
+	for _, l := range g.Links {
+		gotLinks = append(gotLinks, str(l))
+	}
+	wantLinks := []string{
+		"192.168.0.1(Fa0/1) - 192.168.0.2(Fa0/2) CDP bidirectional=true",
+		"192.168.0.1(Fa0/2) - 192.168.0.2(Fa0/1) CDP bidirectional=true",
+		"192.168.0.2(Fa0/3) - 192.168.0.3(port 1) LLDP bidirectional=false",
+	}
+	if diff := pretty.Compare(wantLinks, gotLinks); diff != "" {
+		t.Errorf("TestNewGraph: links -want/+got:\n%s", diff)
+	}
+
+	var gotC []string
+	for _, l := range g.LinksOf(nodeC) {
+		gotC = append(gotC, str(l))
+	}
+	if diff := pretty.Compare(wantLinks[2:], gotC); diff != "" {
+		t.Errorf("TestNewGraph: LinksOf() -want/+got:\n%s", diff)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 )
 
 // NodeInterface is a vendor specific network interface now.
@@ -13,6 +14,8 @@ type NodeInterface string
 type Node struct {
 	// IP is the IP the Node is connected with.
 	IP net.IP
+	// IPs are all the addresses the Node is known by, including IP.
+	IPs []net.IP
 	// Type is the type of device.  In a real version of this, this should be an enumerator
 	// an this should probably based on protocol buffers.
 	Type string
@@ -23,9 +26,53 @@ type Node struct {
 	// Error indicates errors associates with logging into the node or parsing CDP.
 	Error error
 
+	// OutOfScope is the reason the node was not explored because it is outside the crawl's
+	// configured scope. Empty if the node was in scope.
+	OutOfScope string
+
+	// Seed is the seed of the crawl, as it was given, that the node was first reached from.
+	// It is only set when a crawl has several seeds.
+	Seed string
+
+	// The following are what a neighbor announced about this node via CDP or LLDP. They are
+	// empty if not known.
+
+	// DeviceID is the CDP Device ID or LLDP System Name, usually the hostname.
+	DeviceID string
+	// ChassisID is the LLDP Chassis ID, usually a MAC address.
+	ChassisID string
+	// Serial is the serial number, which NX-OS includes in its CDP Device ID.
+	Serial string
+	// Capabilities are what the node can do, such as Router or Switch.
+	Capabilities []string
+	// Version is the software version text.
+	Version string
+	// VTPDomain is the VTP management domain.
+	VTPDomain string
+	// ManagementIPs are the node's management addresses.
+	ManagementIPs []net.IP
+
+	// LinkDetails holds what we know about the link to a neighbor, keyed by the same
+	// interface as Neighbors. Not every neighbor has an entry.
+	LinkDetails map[NodeInterface]*LinkDetail
+
 	mu sync.Mutex
 }
 
+// LinkDetail describes the link between a Node and one of its neighbors.
+type LinkDetail struct {
+	// Protocol is the protocol the link was discovered by, such as ProtoCDP.
+	Protocol string `json:",omitempty"`
+	// RemoteInterface is the neighbor's interface on the link (CDP Port ID).
+	RemoteInterface NodeInterface `json:",omitempty"`
+	// Holdtime is how long the neighbor's announcement is valid for.
+	Holdtime time.Duration `json:",omitempty"`
+	// NativeVLAN is the native VLAN the neighbor has on the link, 0 if not known.
+	NativeVLAN int `json:",omitempty"`
+	// Duplex is the duplex the neighbor has on the link, such as "full".
+	Duplex string `json:",omitempty"`
+}
+
 // SetNeighbor sets a Neighbor at inter to node.
 func (n *Node) SetNeighbor(inter NodeInterface, node *Node) {
 	n.mu.Lock()
@@ -36,6 +83,120 @@ func (n *Node) SetNeighbor(inter NodeInterface, node *Node) {
 	n.mu.Unlock()
 }
 
+// SetLinkDetail sets the LinkDetail for the neighbor at inter.
+func (n *Node) SetLinkDetail(inter NodeInterface, d *LinkDetail) {
+	n.mu.Lock()
+	if n.LinkDetails == nil {
+		n.LinkDetails = map[NodeInterface]*LinkDetail{}
+	}
+	n.LinkDetails[inter] = d
+	n.mu.Unlock()
+}
+
+// LinkDetail returns the LinkDetail for the neighbor at inter or nil if there isn't one.
+func (n *Node) LinkDetail(inter NodeInterface) *LinkDetail {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.LinkDetails[inter]
+}
+
+// AllIPs returns IP and IPs without duplicates.
+func (n *Node) AllIPs() []net.IP {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.allIPs()
+}
+
+func (n *Node) allIPs() []net.IP {
+	var ips []net.IP
+	seen := map[string]bool{}
+	for _, ip := range append([]net.IP{n.IP}, n.IPs...) {
+		if ip == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// PreferredIP returns the first address in ips of the preferred family, IPv6 if v6 is set
+// or IPv4 if not. If there is none of that family, the first address is returned. IPv6 link
+// local addresses are only returned if there is nothing else, as they can't be dialed
+// without a zone.
+func PreferredIP(ips []net.IP, v6 bool) net.IP {
+	var fallback net.IP
+	for _, ip := range ips {
+		if ip == nil {
+			continue
+		}
+		if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+			if fallback == nil {
+				fallback = ip
+			}
+			continue
+		}
+		if (ip.To4() == nil) == v6 {
+			return ip
+		}
+		if fallback == nil || (fallback.To4() == nil && fallback.IsLinkLocalUnicast()) {
+			fallback = ip
+		}
+	}
+	return fallback
+}
+
+// Merge adds what o knows about the same device to n: its addresses and any identity or
+// detail fields n doesn't have. Neighbors are not merged.
+func (n *Node) Merge(o *Node) {
+	oIPs := o.AllIPs()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.IPs = n.allIPs()
+	seen := map[string]bool{}
+	for _, ip := range n.IPs {
+		seen[ip.String()] = true
+	}
+	for _, ip := range oIPs {
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			n.IPs = append(n.IPs, ip)
+		}
+	}
+
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&n.DeviceID, o.DeviceID)
+	fill(&n.ChassisID, o.ChassisID)
+	fill(&n.Serial, o.Serial)
+	fill(&n.Version, o.Version)
+	fill(&n.VTPDomain, o.VTPDomain)
+	if len(n.Capabilities) == 0 {
+		n.Capabilities = o.Capabilities
+	}
+	if len(n.ManagementIPs) == 0 {
+		n.ManagementIPs = o.ManagementIPs
+	}
+}
+
+// CopyNeighbors returns a copy of Neighbors that is safe to range over while other
+// goroutines call SetNeighbor.
+func (n *Node) CopyNeighbors() map[NodeInterface]*Node {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	m := make(map[NodeInterface]*Node, len(n.Neighbors))
+	for k, v := range n.Neighbors {
+		m[k] = v
+	}
+	return m
+}
+
 // Validate vlaidates that this Node is valid.
 func (n *Node) Validate() error {
 	if n.IP == nil {
@@ -0,0 +1,32 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPreferredIP(t *testing.T) {
+	v4 := net.ParseIP("192.168.0.1")
+	v6 := net.ParseIP("2001:db8::1")
+	linkLocal := net.ParseIP("fe80::1")
+
+	tests := []struct {
+		desc string
+		ips  []net.IP
+		v6   bool
+		want net.IP
+	}{
+		{desc: "Prefer IPv4", ips: []net.IP{v6, v4}, want: v4},
+		{desc: "Prefer IPv6", ips: []net.IP{v4, v6}, v6: true, want: v6},
+		{desc: "Only other family", ips: []net.IP{v6}, want: v6},
+		{desc: "Skip link local", ips: []net.IP{linkLocal, v4}, v6: true, want: v4},
+		{desc: "Only link local", ips: []net.IP{linkLocal}, want: linkLocal},
+		{desc: "None", ips: nil, want: nil},
+	}
+
+	for _, test := range tests {
+		if got := PreferredIP(test.ips, test.v6); !got.Equal(test.want) {
+			t.Errorf("TestPreferredIP(%s): got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
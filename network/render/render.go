@@ -0,0 +1,173 @@
+// Package render provides renderers that turn a network.Topology into diagram text for
+// Graphviz (DOT) and Mermaid.
+//
+// Nodes are filled with a color for their platform. Nodes that could not be logged into
+// or had other errors have a red dashed outline, out of scope nodes are greyed out.
+// Edges are labelled with the interface names at each end.
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// palette are the fill colors assigned to platforms, in order of the sorted platform names.
+var palette = []string{
+	"#8dd3c7", "#ffffb3", "#bebada", "#fb8072", "#80b1d3",
+	"#fdb462", "#b3de69", "#fccde5", "#bc80bd", "#ccebc5",
+}
+
+const (
+	errorColor      = "#dd0000"
+	outOfScopeFill  = "#eeeeee"
+	outOfScopeColor = "#888888"
+)
+
+// platformColors assigns a palette color to each platform in t.
+func platformColors(t network.Topology) map[string]string {
+	set := map[string]bool{}
+	for _, n := range t.Nodes {
+		set[n.Type] = true
+	}
+	platforms := make([]string, 0, len(set))
+	for p := range set {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+
+	colors := map[string]string{}
+	for i, p := range platforms {
+		colors[p] = palette[i%len(palette)]
+	}
+	return colors
+}
+
+// nodeLines are the lines of text used to label a node.
+func nodeLines(n network.TopologyNode) []string {
+	lines := []string{n.IP}
+	if n.DeviceID != "" {
+		lines = []string{n.DeviceID, n.IP}
+	}
+	if n.Type != "" {
+		lines = append(lines, n.Type)
+	}
+	switch {
+	case n.OutOfScope != "":
+		lines = append(lines, "out of scope")
+	case n.Error != "":
+		lines = append(lines, "not explored: error")
+	}
+	return lines
+}
+
+// edgeLabel is the label for an edge, naming the interface at both ends if known.
+func edgeLabel(e network.TopologyEdge) string {
+	if e.Remote() == "" {
+		return string(e.LocalInterface)
+	}
+	return fmt.Sprintf("%s - %s", e.LocalInterface, e.Remote())
+}
+
+// DOT writes t to w in Graphviz DOT format.
+func DOT(w io.Writer, t network.Topology) error {
+	colors := platformColors(t)
+
+	b := &strings.Builder{}
+	b.WriteString("graph netcrawl {\n")
+	b.WriteString("\tnode [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+	b.WriteString("\tedge [fontname=\"Helvetica\", fontsize=10];\n")
+
+	for _, n := range t.Nodes {
+		attrs := []string{
+			fmt.Sprintf("label=%s", dotQuote(strings.Join(nodeLines(n), "\n"))),
+			fmt.Sprintf("fillcolor=%s", dotQuote(colors[n.Type])),
+		}
+		switch {
+		case n.OutOfScope != "":
+			attrs[1] = fmt.Sprintf("fillcolor=%s", dotQuote(outOfScopeFill))
+			attrs = append(attrs, fmt.Sprintf("color=%s", dotQuote(outOfScopeColor)), fmt.Sprintf("fontcolor=%s", dotQuote(outOfScopeColor)), `style="rounded,filled,dotted"`)
+		case n.Error != "":
+			attrs = append(attrs, fmt.Sprintf("color=%s", dotQuote(errorColor)), "penwidth=2", `style="rounded,filled,dashed"`)
+		}
+		fmt.Fprintf(b, "\t%s [%s];\n", dotQuote(n.ID), strings.Join(attrs, ", "))
+	}
+
+	for _, e := range t.Edges {
+		attrs := []string{fmt.Sprintf("taillabel=%s", dotQuote(string(e.LocalInterface)))}
+		if e.Remote() != "" {
+			attrs = append(attrs, fmt.Sprintf("headlabel=%s", dotQuote(string(e.Remote()))))
+		}
+		fmt.Fprintf(b, "\t%s -- %s [%s];\n", dotQuote(e.From), dotQuote(e.To), strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// Mermaid writes t to w as a Mermaid flowchart.
+func Mermaid(w io.Writer, t network.Topology) error {
+	colors := platformColors(t)
+
+	// Mermaid IDs can't have most punctuation, so we number the nodes.
+	ids := map[string]string{}
+	for i, n := range t.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("flowchart LR\n")
+
+	for _, n := range t.Nodes {
+		fmt.Fprintf(b, "\t%s[\"%s\"]\n", ids[n.ID], mermaidEscape(strings.Join(nodeLines(n), "<br/>")))
+	}
+
+	for _, e := range t.Edges {
+		fmt.Fprintf(b, "\t%s ---|\"%s\"| %s\n", ids[e.From], mermaidEscape(edgeLabel(e)), ids[e.To])
+	}
+
+	// Class definitions for platforms, sorted so that output is stable.
+	platformClass := map[string]string{}
+	var platforms []string
+	for p := range colors {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+	for i, p := range platforms {
+		platformClass[p] = fmt.Sprintf("platform%d", i)
+		fmt.Fprintf(b, "\tclassDef %s fill:%s,stroke:#333333\n", platformClass[p], colors[p])
+	}
+	fmt.Fprintf(b, "\tclassDef error stroke:%s,stroke-width:2px,stroke-dasharray:5 5\n", errorColor)
+	fmt.Fprintf(b, "\tclassDef outOfScope fill:%s,stroke:%s,color:%s,stroke-dasharray:2 2\n", outOfScopeFill, outOfScopeColor, outOfScopeColor)
+
+	for _, n := range t.Nodes {
+		switch {
+		case n.OutOfScope != "":
+			fmt.Fprintf(b, "\tclass %s outOfScope\n", ids[n.ID])
+		case n.Error != "":
+			// class statements add to a node's classes, so this gets both.
+			fmt.Fprintf(b, "\tclass %s %s\n", ids[n.ID], platformClass[n.Type])
+			fmt.Fprintf(b, "\tclass %s error\n", ids[n.ID])
+		default:
+			fmt.Fprintf(b, "\tclass %s %s\n", ids[n.ID], platformClass[n.Type])
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
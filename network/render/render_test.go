@@ -0,0 +1,75 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var topo = network.Topology{
+	Root: "192.168.0.1",
+	Nodes: []network.TopologyNode{
+		{ID: "192.168.0.1", IP: "192.168.0.1", Type: "RootNode"},
+		{ID: "192.168.0.2", IP: "192.168.0.2", Type: `cisco "WS-C2950-12"`},
+		{ID: "192.168.0.3", IP: "192.168.0.3", Type: `cisco "WS-C2950-12"`, Error: "login failed"},
+		{ID: "192.168.0.4", IP: "192.168.0.4", Type: "Cisco IP Phone", OutOfScope: "platform"},
+	},
+	Edges: []network.TopologyEdge{
+		{From: "192.168.0.1", LocalInterface: "Fa0/1", To: "192.168.0.2", RemoteInterface: "Fa0/2"},
+		{From: "192.168.0.2", LocalInterface: "Fa0/3", To: "192.168.0.3"},
+		{From: "192.168.0.2", LocalInterface: "Fa0/4", To: "192.168.0.4"},
+	},
+}
+
+func TestDOT(t *testing.T) {
+	want := `graph netcrawl {
+	node [shape=box, style="rounded,filled", fontname="Helvetica"];
+	edge [fontname="Helvetica", fontsize=10];
+	"192.168.0.1" [label="192.168.0.1\nRootNode", fillcolor="#ffffb3"];
+	"192.168.0.2" [label="192.168.0.2\ncisco \"WS-C2950-12\"", fillcolor="#bebada"];
+	"192.168.0.3" [label="192.168.0.3\ncisco \"WS-C2950-12\"\nnot explored: error", fillcolor="#bebada", color="#dd0000", penwidth=2, style="rounded,filled,dashed"];
+	"192.168.0.4" [label="192.168.0.4\nCisco IP Phone\nout of scope", fillcolor="#eeeeee", color="#888888", fontcolor="#888888", style="rounded,filled,dotted"];
+	"192.168.0.1" -- "192.168.0.2" [taillabel="Fa0/1", headlabel="Fa0/2"];
+	"192.168.0.2" -- "192.168.0.3" [taillabel="Fa0/3"];
+	"192.168.0.2" -- "192.168.0.4" [taillabel="Fa0/4"];
+}
+`
+	buff := &bytes.Buffer{}
+	if err := DOT(buff, topo); err != nil {
+		t.Fatalf("TestDOT: got err == %s", err)
+	}
+	if diff := pretty.Compare(want, buff.String()); diff != "" {
+		t.Errorf("TestDOT: -want/+got:\n%s", diff)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	want := `flowchart LR
+	n0["192.168.0.1<br/>RootNode"]
+	n1["192.168.0.2<br/>cisco #quot;WS-C2950-12#quot;"]
+	n2["192.168.0.3<br/>cisco #quot;WS-C2950-12#quot;<br/>not explored: error"]
+	n3["192.168.0.4<br/>Cisco IP Phone<br/>out of scope"]
+	n0 ---|"Fa0/1 - Fa0/2"| n1
+	n1 ---|"Fa0/3"| n2
+	n1 ---|"Fa0/4"| n3
+	classDef platform0 fill:#8dd3c7,stroke:#333333
+	classDef platform1 fill:#ffffb3,stroke:#333333
+	classDef platform2 fill:#bebada,stroke:#333333
+	classDef error stroke:#dd0000,stroke-width:2px,stroke-dasharray:5 5
+	classDef outOfScope fill:#eeeeee,stroke:#888888,color:#888888,stroke-dasharray:2 2
+	class n0 platform1
+	class n1 platform2
+	class n2 platform2
+	class n2 error
+	class n3 outOfScope
+`
+	buff := &bytes.Buffer{}
+	if err := Mermaid(buff, topo); err != nil {
+		t.Fatalf("TestMermaid: got err == %s", err)
+	}
+	if diff := pretty.Compare(want, buff.String()); diff != "" {
+		t.Errorf("TestMermaid: -want/+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,234 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// Topology is a serializable form of a Node graph. A Node graph can't be marshalled directly
+// because Neighbors has cycles. Here each node is listed once and the links between them
+// are listed as edges that refer to nodes by ID.
+type Topology struct {
+	// Root is the ID of the root node.
+	Root string
+	// Seeds are the IDs of the root nodes of a graph that was built from several, Root first.
+	// Empty if there was only one.
+	Seeds []string `json:",omitempty"`
+	// Nodes are the nodes in the graph, sorted by IP.
+	Nodes []TopologyNode
+	// Edges are the links between nodes.
+	Edges []TopologyEdge
+}
+
+// TopologyNode is a Node in a Topology.
+type TopologyNode struct {
+	// ID uniquely identifies the node in the Topology.
+	ID   string
+	IP   string
+	Type string
+	// Error is the text of Node.Error.
+	Error      string `json:",omitempty"`
+	OutOfScope string `json:",omitempty"`
+	// Seed is the seed the node was first reached from, see Node.Seed.
+	Seed string `json:",omitempty"`
+
+	// IPs are all the node's addresses if it has more than IP.
+	IPs           []string `json:",omitempty"`
+	DeviceID      string   `json:",omitempty"`
+	ChassisID     string   `json:",omitempty"`
+	Serial        string   `json:",omitempty"`
+	Capabilities  []string `json:",omitempty"`
+	Version       string   `json:",omitempty"`
+	VTPDomain     string   `json:",omitempty"`
+	ManagementIPs []string `json:",omitempty"`
+}
+
+// TopologyEdge is a link between two nodes in a Topology. If RemoteInterface is set, the
+// link is known from both ends and To also has From as a neighbor on RemoteInterface.
+type TopologyEdge struct {
+	// From is the ID of the node that has the neighbor.
+	From string
+	// LocalInterface is the interface on From the neighbor is on.
+	LocalInterface NodeInterface
+	// To is the ID of the neighbor.
+	To string
+	// RemoteInterface is the interface on To that From is on. May be empty if not known.
+	RemoteInterface NodeInterface `json:",omitempty"`
+	// Detail is what From's neighbor announced about the link, if known.
+	Detail *LinkDetail `json:",omitempty"`
+	// RemoteDetail is what From announced about the link to To, if known. It is only set
+	// with RemoteInterface.
+	RemoteDetail *LinkDetail `json:",omitempty"`
+}
+
+// Remote returns the interface on To for the link, from RemoteInterface or failing that
+// from Detail. Empty if not known.
+func (e TopologyEdge) Remote() NodeInterface {
+	if e.RemoteInterface == "" && e.Detail != nil {
+		return e.Detail.RemoteInterface
+	}
+	return e.RemoteInterface
+}
+
+// ToTopology converts the graph reachable from roots into a Topology. The output is
+// deterministic for the same graph.
+func ToTopology(roots ...*Node) Topology {
+	g := NewGraph(roots...)
+
+	ids := map[*Node]string{}
+	used := map[string]bool{}
+	t := Topology{}
+	for _, n := range g.Nodes {
+		// IPs should be unique, but don't lose a node if they aren't.
+		id := n.IP.String()
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s#%d", n.IP.String(), i)
+		}
+		ids[n] = id
+		used[id] = true
+
+		tn := TopologyNode{
+			ID:           id,
+			IP:           n.IP.String(),
+			Type:         n.Type,
+			OutOfScope:   n.OutOfScope,
+			Seed:         n.Seed,
+			DeviceID:     n.DeviceID,
+			ChassisID:    n.ChassisID,
+			Serial:       n.Serial,
+			Capabilities: n.Capabilities,
+			Version:      n.Version,
+			VTPDomain:    n.VTPDomain,
+		}
+		if ips := n.AllIPs(); len(ips) > 1 {
+			for _, ip := range ips {
+				tn.IPs = append(tn.IPs, ip.String())
+			}
+		}
+		if n.Error != nil {
+			tn.Error = n.Error.Error()
+		}
+		for _, ip := range n.ManagementIPs {
+			tn.ManagementIPs = append(tn.ManagementIPs, ip.String())
+		}
+		t.Nodes = append(t.Nodes, tn)
+	}
+	t.Root = ids[g.Root]
+	if len(g.Roots) > 1 {
+		for _, r := range g.Roots {
+			t.Seeds = append(t.Seeds, ids[r])
+		}
+	}
+
+	for _, l := range g.Links {
+		edge := TopologyEdge{From: ids[l.Local.Node], LocalInterface: l.Local.Interface, To: ids[l.Remote.Node], Detail: l.Detail}
+		if l.Bidirectional {
+			edge.RemoteInterface = l.Remote.Interface
+			edge.RemoteDetail = l.RemoteDetail
+		}
+		t.Edges = append(t.Edges, edge)
+	}
+	return t
+}
+
+func sortedInterfaces(m map[NodeInterface]*Node) []NodeInterface {
+	inters := make([]NodeInterface, 0, len(m))
+	for k := range m {
+		inters = append(inters, k)
+	}
+	sort.Slice(inters, func(i, j int) bool { return inters[i] < inters[j] })
+	return inters
+}
+
+// Graph converts the Topology back into a Node graph and returns the root node.
+func (t Topology) Graph() (*Node, error) {
+	roots, err := t.SeedGraph()
+	if err != nil {
+		return nil, err
+	}
+	return roots[0], nil
+}
+
+// SeedGraph converts the Topology back into a Node graph and returns the root node of each
+// of Seeds, or just the root node if there are no Seeds.
+func (t Topology) SeedGraph() ([]*Node, error) {
+	nodes := map[string]*Node{}
+	for _, tn := range t.Nodes {
+		if _, ok := nodes[tn.ID]; ok {
+			return nil, fmt.Errorf("node ID %s is listed more than once", tn.ID)
+		}
+		ip := net.ParseIP(tn.IP)
+		if ip == nil {
+			return nil, fmt.Errorf("node %s has invalid IP %q", tn.ID, tn.IP)
+		}
+		n := &Node{
+			IP:           ip,
+			Type:         tn.Type,
+			OutOfScope:   tn.OutOfScope,
+			Seed:         tn.Seed,
+			DeviceID:     tn.DeviceID,
+			ChassisID:    tn.ChassisID,
+			Serial:       tn.Serial,
+			Capabilities: tn.Capabilities,
+			Version:      tn.Version,
+			VTPDomain:    tn.VTPDomain,
+		}
+		if tn.Error != "" {
+			n.Error = errors.New(tn.Error)
+		}
+		for _, s := range tn.IPs {
+			aip := net.ParseIP(s)
+			if aip == nil {
+				return nil, fmt.Errorf("node %s has invalid IP %q", tn.ID, s)
+			}
+			n.IPs = append(n.IPs, aip)
+		}
+		for _, s := range tn.ManagementIPs {
+			mip := net.ParseIP(s)
+			if mip == nil {
+				return nil, fmt.Errorf("node %s has invalid management IP %q", tn.ID, s)
+			}
+			n.ManagementIPs = append(n.ManagementIPs, mip)
+		}
+		nodes[tn.ID] = n
+	}
+
+	for _, e := range t.Edges {
+		from, to := nodes[e.From], nodes[e.To]
+		if from == nil || to == nil {
+			return nil, fmt.Errorf("edge %s(%s) -> %s refers to a node that doesn't exist", e.From, e.LocalInterface, e.To)
+		}
+		from.SetNeighbor(e.LocalInterface, to)
+		if e.Detail != nil {
+			from.SetLinkDetail(e.LocalInterface, e.Detail)
+		}
+		if e.RemoteInterface != "" {
+			to.SetNeighbor(e.RemoteInterface, from)
+			if e.RemoteDetail != nil {
+				to.SetLinkDetail(e.RemoteInterface, e.RemoteDetail)
+			}
+		}
+	}
+
+	root := nodes[t.Root]
+	if root == nil {
+		return nil, fmt.Errorf("root node %s doesn't exist", t.Root)
+	}
+	if len(t.Seeds) == 0 {
+		return []*Node{root}, nil
+	}
+	var roots []*Node
+	for _, id := range t.Seeds {
+		n := nodes[id]
+		if n == nil {
+			return nil, fmt.Errorf("seed node %s doesn't exist", id)
+		}
+		roots = append(roots, n)
+	}
+	if roots[0] != root {
+		return nil, fmt.Errorf("the first seed node %s is not the root node %s", t.Seeds[0], t.Root)
+	}
+	return roots, nil
+}
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestTopologyRoundTrip(t *testing.T) {
+	nodeA := &Node{IP: net.ParseIP("192.168.0.1"), Type: "RootNode"}
+	nodeB := &Node{
+		IP:            net.ParseIP("192.168.0.2"),
+		Type:          "cisco WS-C2950-12",
+		IPs:           []net.IP{net.ParseIP("192.168.0.2"), net.ParseIP("10.1.1.2")},
+		DeviceID:      "Switch2",
+		ChassisID:     "00:1c:73:00:00:01",
+		Serial:        "FOC1234X0AB",
+		Capabilities:  []string{"Trans-Bridge", "Switch"},
+		Version:       "IOS (tm) C2950 Software",
+		VTPDomain:     "lab",
+		ManagementIPs: []net.IP{net.ParseIP("10.0.0.2")},
+	}
+	nodeC := &Node{IP: net.ParseIP("192.168.0.3"), Type: "cisco WS-C2950-12"}
+	nodeD := &Node{IP: net.ParseIP("192.168.0.4"), Type: "Cisco IP Phone", OutOfScope: "platform matches"}
+	nodeE := &Node{IP: net.ParseIP("192.168.0.5"), Type: "cisco WS-C2950-12", Error: errors.New("login failed")}
+
+	nodeA.SetNeighbor("Fa0/1", nodeB)
+	nodeA.SetLinkDetail("Fa0/1", &LinkDetail{RemoteInterface: "Fa0/1", Holdtime: 137 * time.Second, NativeVLAN: 1, Duplex: "full"})
+	nodeA.SetNeighbor("Fa0/2", nodeC)
+	nodeB.SetNeighbor("Fa0/1", nodeA)
+	nodeB.SetLinkDetail("Fa0/1", &LinkDetail{RemoteInterface: "Fa0/1", Holdtime: 120 * time.Second, NativeVLAN: 1, Duplex: "half"})
+	// Parallel links between B and C.
+	nodeB.SetNeighbor("Fa0/2", nodeC)
+	nodeB.SetNeighbor("Fa0/3", nodeC)
+	nodeC.SetNeighbor("Fa0/1", nodeA)
+	nodeC.SetNeighbor("Fa0/2", nodeB)
+	nodeC.SetNeighbor("Fa0/3", nodeB)
+	nodeC.SetNeighbor("Fa0/4", nodeD)
+	nodeC.SetNeighbor("Fa0/5", nodeE)
+
+	topo := ToTopology(nodeA)
+
+	wantEdges := []TopologyEdge{
+		{
+			From: "192.168.0.1", LocalInterface: "Fa0/1", To: "192.168.0.2", RemoteInterface: "Fa0/1",
+			Detail:       &LinkDetail{RemoteInterface: "Fa0/1", Holdtime: 137 * time.Second, NativeVLAN: 1, Duplex: "full"},
+			RemoteDetail: &LinkDetail{RemoteInterface: "Fa0/1", Holdtime: 120 * time.Second, NativeVLAN: 1, Duplex: "half"},
+		},
+		{From: "192.168.0.1", LocalInterface: "Fa0/2", To: "192.168.0.3", RemoteInterface: "Fa0/1"},
+		{From: "192.168.0.2", LocalInterface: "Fa0/2", To: "192.168.0.3"},
+		{From: "192.168.0.2", LocalInterface: "Fa0/3", To: "192.168.0.3"},
+		{From: "192.168.0.3", LocalInterface: "Fa0/2", To: "192.168.0.2"},
+		{From: "192.168.0.3", LocalInterface: "Fa0/3", To: "192.168.0.2"},
+		{From: "192.168.0.3", LocalInterface: "Fa0/4", To: "192.168.0.4"},
+		{From: "192.168.0.3", LocalInterface: "Fa0/5", To: "192.168.0.5"},
+	}
+	if diff := pretty.Compare(wantEdges, topo.Edges); diff != "" {
+		t.Fatalf("TestTopologyRoundTrip: edges -want/+got:\n%s", diff)
+	}
+
+	b, err := json.Marshal(topo)
+	if err != nil {
+		t.Fatalf("TestTopologyRoundTrip: json.Marshal() had error: %s", err)
+	}
+
+	got := Topology{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("TestTopologyRoundTrip: json.Unmarshal() had error: %s", err)
+	}
+
+	root, err := got.Graph()
+	if err != nil {
+		t.Fatalf("TestTopologyRoundTrip: Graph() had error: %s", err)
+	}
+
+	if diff := pretty.Compare(topo, ToTopology(root)); diff != "" {
+		t.Errorf("TestTopologyRoundTrip: -want/+got:\n%s", diff)
+	}
+
+	// The link between A and B has a detail on both ends.
+	if diff := pretty.Compare(nodeA.LinkDetail("Fa0/1"), root.LinkDetail("Fa0/1")); diff != "" {
+		t.Errorf("TestTopologyRoundTrip: 192.168.0.1 Fa0/1 detail -want/+got:\n%s", diff)
+	}
+	if diff := pretty.Compare(nodeB.LinkDetail("Fa0/1"), root.Neighbors["Fa0/1"].LinkDetail("Fa0/1")); diff != "" {
+		t.Errorf("TestTopologyRoundTrip: 192.168.0.2 Fa0/1 detail -want/+got:\n%s", diff)
+	}
+
+	if root.Neighbors["Fa0/2"].Neighbors["Fa0/5"].Error == nil {
+		t.Errorf("TestTopologyRoundTrip: node 192.168.0.5 lost its Error")
+	}
+}
+
+func TestTopologySeeds(t *testing.T) {
+	a := &Node{IP: net.ParseIP("10.2.0.1"), Type: "RootNode", Seed: "core.lon"}
+	b := &Node{IP: net.ParseIP("10.1.0.1"), Type: "RootNode", Seed: "10.1.0.1"}
+	c := &Node{IP: net.ParseIP("10.2.0.2"), Type: "router", Seed: "core.lon"}
+	a.SetNeighbor("Gi1", c)
+	c.SetNeighbor("Gi1", a)
+
+	topo := ToTopology(a, b, a)
+	if diff := pretty.Compare([]string{"10.2.0.1", "10.1.0.1"}, topo.Seeds); diff != "" {
+		t.Fatalf("TestTopologySeeds: Seeds -want/+got:\n%s", diff)
+	}
+	if len(topo.Nodes) != 3 {
+		t.Fatalf("TestTopologySeeds: got %d nodes, want 3", len(topo.Nodes))
+	}
+
+	seeds, err := topo.SeedGraph()
+	if err != nil {
+		t.Fatalf("TestTopologySeeds: SeedGraph() had error: %s", err)
+	}
+	if diff := pretty.Compare(topo, ToTopology(seeds...)); diff != "" {
+		t.Errorf("TestTopologySeeds: -want/+got:\n%s", diff)
+	}
+	if seeds[1].Seed != "10.1.0.1" {
+		t.Errorf("TestTopologySeeds: got Seed %q, want %q", seeds[1].Seed, "10.1.0.1")
+	}
+
+	topo.Seeds = []string{"10.1.0.1", "10.2.0.1"}
+	if _, err := topo.SeedGraph(); err == nil {
+		t.Errorf("TestTopologySeeds(Root not first): got err == nil, want err != nil")
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Package traverse walks a network.Node graph without falling into the loops that neighbors
+create.
+
+Every traversal is deterministic: a node's neighbors are visited in IP order (ties broken by
+local interface name), so the same graph always produces the same order.
+
+	it := traverse.BFS(root)
+	for it.Next() {
+		s := it.Step()
+		fmt.Println(s.Hops, s.Node.IP)
+	}
+*/
+package traverse
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/johnsiilver/netcrawl/network"
+)
+
+// Step is a single node reached during a traversal.
+type Step struct {
+	// Node is the node that was reached.
+	Node *network.Node
+	// Hops is the number of links between the root and Node along the path the traversal
+	// took. For BFS this is the shortest path.
+	Hops int
+	// Parent is the node Node was reached from. nil for the root.
+	Parent *network.Node
+	// Interface is the interface on Parent that Node is on. Empty for the root.
+	Interface network.NodeInterface
+}
+
+// Iterator returns the nodes of a graph one Step at a time. Each node is returned once.
+type Iterator struct {
+	bfs     bool
+	pending []Step
+	seen    map[*network.Node]bool
+	cur     Step
+	skip    bool
+}
+
+// BFS returns an Iterator that walks the graph from root breadth first.
+func BFS(root *network.Node) *Iterator {
+	return newIterator(root, true)
+}
+
+// DFS returns an Iterator that walks the graph from root depth first (pre-order).
+func DFS(root *network.Node) *Iterator {
+	return newIterator(root, false)
+}
+
+func newIterator(root *network.Node, bfs bool) *Iterator {
+	it := &Iterator{bfs: bfs, seen: map[*network.Node]bool{}}
+	if root != nil {
+		it.pending = []Step{{Node: root}}
+	}
+	return it
+}
+
+// Next advances to the next node, returning false when there are no more.
+func (it *Iterator) Next() bool {
+	if it.cur.Node != nil && !it.skip {
+		it.expand(it.cur)
+	}
+	it.cur, it.skip = Step{}, false
+
+	for len(it.pending) > 0 {
+		var s Step
+		if it.bfs {
+			s, it.pending = it.pending[0], it.pending[1:]
+		} else {
+			s, it.pending = it.pending[len(it.pending)-1], it.pending[:len(it.pending)-1]
+		}
+		if it.seen[s.Node] {
+			continue
+		}
+		it.seen[s.Node] = true
+		it.cur = s
+		return true
+	}
+	return false
+}
+
+// Step returns the current Step. Only valid after Next has returned true.
+func (it *Iterator) Step() Step {
+	return it.cur
+}
+
+// SkipNeighbors stops the traversal from continuing through the current node. Its
+// neighbors may still be reached through other nodes.
+func (it *Iterator) SkipNeighbors() {
+	it.skip = true
+}
+
+// expand queues the neighbors of s.
+func (it *Iterator) expand(s Step) {
+	steps := neighbors(s)
+	if it.bfs {
+		it.pending = append(it.pending, steps...)
+		return
+	}
+	// Push in reverse so the lowest IP is popped first.
+	for i := len(steps) - 1; i >= 0; i-- {
+		it.pending = append(it.pending, steps[i])
+	}
+}
+
+// neighbors returns the Steps to the unvisited neighbors of s in IP order.
+func neighbors(s Step) []Step {
+	var steps []Step
+	for inter, n := range s.Node.CopyNeighbors() {
+		if n == nil {
+			continue
+		}
+		steps = append(steps, Step{Node: n, Hops: s.Hops + 1, Parent: s.Node, Interface: inter})
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		if c := compareIP(steps[i].Node, steps[j].Node); c != 0 {
+			return c < 0
+		}
+		return steps[i].Interface < steps[j].Interface
+	})
+	return steps
+}
+
+// SkipNeighbors can be returned by a Visitor to not continue the walk through the node
+// it was called with.
+var SkipNeighbors = errors.New("skip neighbors")
+
+// Stop can be returned by a Visitor to end the walk early without an error.
+var Stop = errors.New("stop walk")
+
+// Visitor is called for each Step in a walk. Returning SkipNeighbors or Stop changes how
+// the walk continues, any other error ends the walk and is returned by it.
+type Visitor func(s Step) error
+
+// WalkBFS calls v for each node reachable from root in breadth first order.
+func WalkBFS(root *network.Node, v Visitor) error {
+	return walk(BFS(root), v)
+}
+
+// WalkDFS calls v for each node reachable from root in depth first order.
+func WalkDFS(root *network.Node, v Visitor) error {
+	return walk(DFS(root), v)
+}
+
+func walk(it *Iterator, v Visitor) error {
+	for it.Next() {
+		switch err := v(it.Step()); err {
+		case nil:
+		case SkipNeighbors:
+			it.SkipNeighbors()
+		case Stop:
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Sorted returns every node reachable from root sorted by IP.
+func Sorted(root *network.Node) []*network.Node {
+	var nodes []*network.Node
+	for it := BFS(root); it.Next(); {
+		nodes = append(nodes, it.Step().Node)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return compareIP(nodes[i], nodes[j]) < 0 })
+	return nodes
+}
+
+func compareIP(a, b *network.Node) int {
+	return bytes.Compare(a.IP.To16(), b.IP.To16())
+}
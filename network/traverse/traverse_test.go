@@ -0,0 +1,137 @@
+package traverse
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/johnsiilver/netcrawl/network"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// graph returns:
+//
+//	.1 -- .3 -- .4
+//	 |     |
+//	.2 ----+     .5 (only reachable through .4)
+func graph() *network.Node {
+	nodes := map[string]*network.Node{}
+	for _, ip := range []string{"1", "2", "3", "4", "5"} {
+		nodes[ip] = &network.Node{IP: net.ParseIP("192.168.0." + ip), Type: "cisco"}
+	}
+	link := func(a network.NodeInterface, na string, b network.NodeInterface, nb string) {
+		nodes[na].SetNeighbor(a, nodes[nb])
+		nodes[nb].SetNeighbor(b, nodes[na])
+	}
+	// Interface names are chosen so that name order and IP order disagree.
+	link("Fa0/1", "1", "Fa0/1", "3")
+	link("Fa0/2", "1", "Fa0/1", "2")
+	link("Fa0/2", "2", "Fa0/2", "3")
+	link("Fa0/3", "3", "Fa0/1", "4")
+	link("Fa0/2", "4", "Fa0/1", "5")
+	return nodes["1"]
+}
+
+type hop struct {
+	IP   string
+	Hops int
+}
+
+func collect(it *Iterator) []hop {
+	var got []hop
+	for it.Next() {
+		got = append(got, hop{it.Step().Node.IP.String(), it.Step().Hops})
+	}
+	return got
+}
+
+func TestIterators(t *testing.T) {
+	tests := []struct {
+		desc string
+		it   *Iterator
+		want []hop
+	}{
+		{
+			desc: "BFS",
+			it:   BFS(graph()),
+			want: []hop{
+				{"192.168.0.1", 0},
+				{"192.168.0.2", 1},
+				{"192.168.0.3", 1},
+				{"192.168.0.4", 2},
+				{"192.168.0.5", 3},
+			},
+		},
+		{
+			desc: "DFS",
+			it:   DFS(graph()),
+			want: []hop{
+				{"192.168.0.1", 0},
+				{"192.168.0.2", 1},
+				{"192.168.0.3", 2},
+				{"192.168.0.4", 3},
+				{"192.168.0.5", 4},
+			},
+		},
+		{
+			desc: "nil root",
+			it:   BFS(nil),
+		},
+	}
+
+	for _, test := range tests {
+		if diff := pretty.Compare(test.want, collect(test.it)); diff != "" {
+			t.Errorf("TestIterators(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var got []string
+	err := WalkBFS(graph(), func(s Step) error {
+		got = append(got, s.Node.IP.String())
+		if s.Node.IP.String() == "192.168.0.3" {
+			return SkipNeighbors
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestWalk(SkipNeighbors): got err == %s", err)
+	}
+	want := []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestWalk(SkipNeighbors): -want/+got:\n%s", diff)
+	}
+
+	got = nil
+	err = WalkDFS(graph(), func(s Step) error {
+		got = append(got, s.Node.IP.String())
+		if len(got) == 2 {
+			return Stop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestWalk(Stop): got err == %s", err)
+	}
+	want = []string{"192.168.0.1", "192.168.0.2"}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestWalk(Stop): -want/+got:\n%s", diff)
+	}
+
+	wantErr := errors.New("error")
+	if err := WalkBFS(graph(), func(s Step) error { return wantErr }); err != wantErr {
+		t.Errorf("TestWalk(error): got err == %v, want %v", err, wantErr)
+	}
+}
+
+func TestSorted(t *testing.T) {
+	var got []string
+	for _, n := range Sorted(graph()) {
+		got = append(got, n.IP.String())
+	}
+	want := []string{"192.168.0.1", "192.168.0.2", "192.168.0.3", "192.168.0.4", "192.168.0.5"}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestSorted: -want/+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/johnsiilver/netcrawl/explorer/config"
+	"github.com/johnsiilver/netcrawl/explorer/sweep"
+)
+
+// maxCIDRHosts is the most hosts a --seed-cidr may have, so a typo like /8 doesn't
+// start millions of logins.
+const maxCIDRHosts = 4096
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+var (
+	seedFlags  stringList
+	cidrFlags  stringList
+	sweepFlags stringList
+	seedsFile  = flag.String("seeds-file", "", "A file of seed devices, one IP, hostname or CIDR per line. # starts a comment")
+)
+
+func init() {
+	flag.Var(&seedFlags, "seed", "A seed device to crawl from, may be given more than once")
+	flag.Var(&cidrFlags, "seed-cidr", "A CIDR whose addresses are all seeds, may be given more than once")
+	flag.Var(&sweepFlags, "sweep", "A CIDR to sweep for devices answering on SSH, telnet or SNMP, which become seeds. May be given more than once")
+}
+
+// seeds returns the seeds to crawl from: root, then the --seed flags, the --seeds-file and
+// the addresses in the --seed-cidr flags. Duplicates are removed.
+func seeds(root string) ([]string, error) {
+	var all []string
+	if root != "" {
+		all = append(all, root)
+	}
+	all = append(all, seedFlags...)
+
+	if *seedsFile != "" {
+		s, err := readSeeds(*seedsFile)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, s...)
+	}
+	for _, c := range cidrFlags {
+		hosts, err := cidrHosts(c)
+		if err != nil {
+			return nil, fmt.Errorf("--seed-cidr: %s", err)
+		}
+		all = append(all, hosts...)
+	}
+	return dedupe(all), nil
+}
+
+// dedupe returns seeds without duplicates, in the order they were first seen.
+func dedupe(seeds []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range seeds {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// readSeeds reads a seeds file: one IP, hostname or CIDR per line. Blank lines and
+// anything after a # are ignored.
+func readSeeds(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open seeds file: %s", err)
+	}
+	defer f.Close()
+
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := scanner.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+		case strings.Contains(s, "/"):
+			hosts, err := cidrHosts(s)
+			if err != nil {
+				return nil, fmt.Errorf("seeds file %s line %d: %s", path, line, err)
+			}
+			out = append(out, hosts...)
+		default:
+			out = append(out, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read seeds file: %s", err)
+	}
+	return out, nil
+}
+
+// cidrHosts returns the host addresses in cidr. For IPv4 prefixes shorter than /31, the
+// network and broadcast addresses are left out.
+func cidrHosts(cidr string) ([]string, error) {
+	ips, err := sweep.Hosts(cidr, maxCIDRHosts)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts, nil
+}
+
+// sweepSeeds sweeps the --sweep flags and the config's Sweep.Prefixes and returns the
+// devices that answered, to crawl from as extra seeds.
+func sweepSeeds(ctx context.Context, conf config.Config) ([]string, error) {
+	prefixes := append(append([]string{}, conf.Sweep.Prefixes...), sweepFlags...)
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+	s, err := conf.Sweeper()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := s.Sweep(ctx, prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		out = append(out, h.IP.String())
+	}
+	fmt.Fprintf(os.Stderr, "sweep of %s found %d devices\n", strings.Join(prefixes, ", "), len(out))
+	return out, nil
+}